@@ -4,16 +4,92 @@ import (
 	"time"
 
 	"github.com/kelseyhightower/envconfig"
+	"github.com/laouji/git-repo-searcher/pkg/gitea"
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/gitlab"
 	"github.com/pkg/errors"
 )
 
+const (
+	authModeApp   = "app"
+	authModeToken = "token"
+	authModeNone  = "none"
+
+	enrichmentREST    = "rest"
+	enrichmentGraphQL = "graphql"
+
+	// providerEnterprise names the GitHub Enterprise Server searched next to the main github instance
+	providerEnterprise = "ghes"
+)
+
 type Config struct {
-	Port             int           `envconfig:"PORT" default:"5000"`
-	GithubURL        string        `envconfig:"GITHUB_API_URL" default:"https://api.github.com"`
-	ClientTimeout    time.Duration `envconfig:"CLIENT_TIMEOUT" default:"3s"`
-	WorkerCount      int           `envconfig:"WORKER_COUNT" default:"50"`
-	GithubAppID      string        `envconfig:"GITHUB_APP_ID"`
-	GithubPrivateKey string        `envconfig:"GITHUB_PRIVATE_KEY"`
+	Port int `envconfig:"PORT" default:"5000"`
+	// GRPCPort serves the search API over gRPC next to the HTTP server, 0 disables it
+	GRPCPort      int           `envconfig:"GRPC_PORT" default:"5001"`
+	GithubURL     string        `envconfig:"GITHUB_API_URL" default:"https://api.github.com"`
+	ClientTimeout time.Duration `envconfig:"CLIENT_TIMEOUT" default:"3s"`
+	WorkerCount   int           `envconfig:"WORKER_COUNT" default:"50"`
+
+	// ReposMaxAge is how long clients may reuse a /repos response, ReposCacheTTL enables
+	// the server side cache of the responses when it isn't zero
+	ReposMaxAge    time.Duration `envconfig:"REPOS_MAX_AGE" default:"10s"`
+	ReposCacheTTL  time.Duration `envconfig:"REPOS_CACHE_TTL" default:"0s"`
+	ReposCacheSize int           `envconfig:"REPOS_CACHE_SIZE" default:"1000"`
+
+	// DefaultProvider is a forge name, a comma separated list of them or all
+	DefaultProvider       string        `envconfig:"DEFAULT_PROVIDER" default:"github"`
+	SourceTimeout         time.Duration `envconfig:"SOURCE_TIMEOUT" default:"10s"`
+	GitlabURL             string        `envconfig:"GITLAB_API_URL"`
+	GitlabToken           string        `envconfig:"GITLAB_TOKEN"`
+	GiteaURL              string        `envconfig:"GITEA_API_URL"`
+	GiteaToken            string        `envconfig:"GITEA_TOKEN"`
+	GithubEnterpriseURL   string        `envconfig:"GITHUB_ENTERPRISE_API_URL"`
+	GithubEnterpriseToken string        `envconfig:"GITHUB_ENTERPRISE_TOKEN"`
+
+	GithubCABundle    string            `envconfig:"GITHUB_CA_BUNDLE"`
+	GithubProxyURL    string            `envconfig:"GITHUB_PROXY_URL"`
+	GithubAPIVersion  string            `envconfig:"GITHUB_API_VERSION" default:"2022-11-28"`
+	GithubAPIVersions map[string]string `envconfig:"GITHUB_API_VERSIONS"`
+	// GithubEnrichment is either rest or graphql, see newGitHubForge
+	GithubEnrichment string `envconfig:"GITHUB_ENRICHMENT" default:"rest"`
+	// GithubOffline replaces github with a local fake serving recorded fixtures, or those of GithubFixtures
+	GithubOffline  bool   `envconfig:"GITHUB_OFFLINE"`
+	GithubFixtures string `envconfig:"GITHUB_FIXTURES"`
+
+	// GithubAuthMode is one of app, token or none, when empty it is inferred from the credentials set
+	GithubAuthMode   string   `envconfig:"GITHUB_AUTH_MODE"`
+	GithubAppID      string   `envconfig:"GITHUB_APP_ID"`
+	GithubPrivateKey []string `envconfig:"GITHUB_PRIVATE_KEY"`
+	GithubExtraApps  []string `envconfig:"GITHUB_EXTRA_APPS"`
+	GithubToken      string   `envconfig:"GITHUB_TOKEN"`
+
+	// GraphQLMaxDepth and GraphQLMaxComplexity bound the queries of /graphql, a live search costs 500
+	GraphQLMaxDepth      int `envconfig:"GRAPHQL_MAX_DEPTH" default:"10"`
+	GraphQLMaxComplexity int `envconfig:"GRAPHQL_MAX_COMPLEXITY" default:"2500"`
+
+	KeyReloadInterval time.Duration `envconfig:"KEY_RELOAD_INTERVAL" default:"30s"`
+
+	// GithubWebhookSecret enables the webhook receiver, github allows redelivering events for 3 days
+	GithubWebhookSecret string        `envconfig:"GITHUB_WEBHOOK_SECRET"`
+	WebhookDeliveryTTL  time.Duration `envconfig:"WEBHOOK_DELIVERY_TTL" default:"72h"`
+
+	// SavedSearchRetryDelay doubles after each failed attempt to notify a saved search target
+	SavedSearchInterval    time.Duration `envconfig:"SAVED_SEARCH_INTERVAL" default:"1m"`
+	SavedSearchMaxAttempts int           `envconfig:"SAVED_SEARCH_MAX_ATTEMPTS" default:"5"`
+	SavedSearchRetryDelay  time.Duration `envconfig:"SAVED_SEARCH_RETRY_DELAY" default:"2s"`
+	// SavedSearchAllowInternalTargets lets saved searches post to loopback, link-local and private addresses
+	SavedSearchAllowInternalTargets bool `envconfig:"SAVED_SEARCH_ALLOW_INTERNAL_TARGETS" default:"false"`
+
+	// APIKeys and APIKeysFile enable API key authentication, the limits apply to each key
+	// unless the file sets its own. The quota counts calls made to github for the key
+	APIKeys           []string      `envconfig:"API_KEYS"`
+	APIKeysFile       string        `envconfig:"API_KEYS_FILE"`
+	APIKeyRate        float64       `envconfig:"API_KEY_RATE" default:"5"`
+	APIKeyBurst       int           `envconfig:"API_KEY_BURST" default:"20"`
+	APIKeyQuota       int           `envconfig:"API_KEY_QUOTA" default:"1000"`
+	APIKeyQuotaWindow time.Duration `envconfig:"API_KEY_QUOTA_WINDOW" default:"1h"`
+	// APIAdminKeys names the keys which can read the admin endpoints and every saved search
+	APIAdminKeys []string `envconfig:"API_ADMIN_KEYS"`
 
 	AuthInterval      time.Duration `envconfig:"AUTH_INTERVAL" default:"5m"`
 	AuthRefreshBuffer time.Duration `envconfig:"AUTH_REFRESH_BUFFER" default:"10m"`
@@ -27,5 +103,48 @@ func newConfig() (*Config, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "fail to build config from env")
 	}
+
+	if cfg.GithubEnrichment != enrichmentREST && cfg.GithubEnrichment != enrichmentGraphQL {
+		return nil, errors.Errorf("unknown GITHUB_ENRICHMENT %q, expected %s or %s", cfg.GithubEnrichment, enrichmentREST, enrichmentGraphQL)
+	}
+	// the fake doesn't serve the graphql API
+	if cfg.GithubOffline && cfg.GithubEnrichment == enrichmentGraphQL {
+		return nil, errors.Errorf("GITHUB_OFFLINE requires GITHUB_ENRICHMENT=%s", enrichmentREST)
+	}
+	// the other forges would still be searched over the network
+	if cfg.GithubOffline {
+		for name, url := range map[string]string{
+			"GITHUB_ENTERPRISE_API_URL": cfg.GithubEnterpriseURL,
+			"GITLAB_API_URL":            cfg.GitlabURL,
+			"GITEA_API_URL":             cfg.GiteaURL,
+		} {
+			if url != "" {
+				return nil, errors.Errorf("GITHUB_OFFLINE can't be used along with %s", name)
+			}
+		}
+	}
+
+	cfg.GithubURL, err = github.NormalizeBaseURL(cfg.GithubURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid GITHUB_API_URL")
+	}
+	if cfg.GithubEnterpriseURL != "" {
+		cfg.GithubEnterpriseURL, err = github.NormalizeBaseURL(cfg.GithubEnterpriseURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid GITHUB_ENTERPRISE_API_URL")
+		}
+	}
+	if cfg.GitlabURL != "" {
+		cfg.GitlabURL, err = gitlab.NormalizeBaseURL(cfg.GitlabURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid GITLAB_API_URL")
+		}
+	}
+	if cfg.GiteaURL != "" {
+		cfg.GiteaURL, err = gitea.NormalizeBaseURL(cfg.GiteaURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid GITEA_API_URL")
+		}
+	}
 	return &cfg, nil
 }
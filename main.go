@@ -2,22 +2,37 @@ package main
 
 import (
 	"context"
-	"crypto/rsa"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/Scalingo/go-handlers"
 	"github.com/Scalingo/go-utils/logger"
-	"github.com/golang-jwt/jwt"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
 	"github.com/laouji/git-repo-searcher/pkg/authentication"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/fulltext"
+	"github.com/laouji/git-repo-searcher/pkg/gitea"
 	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/laouji/git-repo-searcher/pkg/githubtest"
+	"github.com/laouji/git-repo-searcher/pkg/gitlab"
+	"github.com/laouji/git-repo-searcher/pkg/graphqlapi"
 	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/httpcache"
+	"github.com/laouji/git-repo-searcher/pkg/openapi"
+	"github.com/laouji/git-repo-searcher/pkg/rpc"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
 func main() {
@@ -29,17 +44,52 @@ func main() {
 		os.Exit(1)
 	}
 
-	var privateKey *rsa.PrivateKey
-	if cfg.GithubAppID != "" {
-		privateKey, err = readAPIPrivateKey(cfg.GithubPrivateKey)
+	if cfg.GithubOffline {
+		fake, err := offlineGitHub(cfg)
+		if err != nil {
+			log.WithError(err).Error("Failed to start the offline github")
+			os.Exit(2)
+		}
+		defer fake.Close()
+		log.WithField("github_api_url", cfg.GithubURL).Info("Serving github from fixtures, no request leaves the machine")
+	}
+
+	// the app keys are only read, watched and listed when the apps are used to authenticate
+	var apps []auth.App
+	if authMode(cfg) == authModeApp {
+		apps, err = githubApps(cfg, log)
 		if err != nil {
-			log.WithError(err).Errorf("Failed to read file: %s", cfg.GithubPrivateKey)
+			log.WithError(err).Error("Failed to read github app credentials")
 			os.Exit(2)
 		}
 	}
 
+	httpClient, err := github.NewHTTPClient(github.TransportConfig{
+		Timeout:     cfg.ClientTimeout,
+		CABundle:    cfg.GithubCABundle,
+		ProxyURL:    cfg.GithubProxyURL,
+		APIVersion:  cfg.GithubAPIVersion,
+		APIVersions: cfg.GithubAPIVersions,
+	})
+	if err != nil {
+		log.WithError(err).Error("Failed to configure github http client")
+		os.Exit(2)
+	}
+
+	// the tokens are refreshed with a copy of the client which isn't metered, so that a refresh
+	// triggered by a 401 during an API request isn't charged to its key
+	authClient := *httpClient
+	// calls made while serving an API request count against the quota of its key
+	httpClient.Transport = apikey.Metered(httpClient.Transport)
+
+	provider, err := authProvider(cfg, &authClient, apps)
+	if err != nil {
+		log.WithError(err).Error("Failed to configure github authentication")
+		os.Exit(2)
+	}
+
 	appCtx, cancel := context.WithCancel(context.Background())
-	server, err := configureServer(appCtx, cfg, log, privateKey)
+	server, grpcServer, err := configureServer(appCtx, cfg, log, httpClient, provider, apps)
 	if err != nil {
 		log.WithError(err).Error("Failed to configure web server")
 		os.Exit(2)
@@ -58,6 +108,22 @@ func main() {
 		log.Info("Web server stopped receiving new conns")
 	}()
 
+	if grpcServer != nil {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+		if err != nil {
+			log.WithError(err).Errorf("Failed to listen to the given gRPC port: %d", cfg.GRPCPort)
+			os.Exit(2)
+		}
+		go func() {
+			log.Info("Listening for gRPC...")
+			if err := grpcServer.Serve(listener); err != nil {
+				log.WithError(err).Error("Failed to serve gRPC")
+				os.Exit(2)
+			}
+			log.Info("gRPC server stopped receiving new conns")
+		}()
+	}
+
 	// block until signal is received
 	<-signalCh
 	cancel() // stop authenticator loop
@@ -65,48 +131,303 @@ func main() {
 	shutdownCtx, release := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer release()
 
+	// the gRPC streams drain while the HTTP server shuts down
+	grpcStopped := make(chan struct{})
+	if grpcServer != nil {
+		go func() {
+			grpcServer.GracefulStop()
+			close(grpcStopped)
+		}()
+	}
+
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.WithError(err).Error("Failed to gracefully shutdown server")
 		os.Exit(2)
 	}
+	if grpcServer != nil {
+		select {
+		case <-grpcStopped:
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+			log.Error("Failed to gracefully shutdown gRPC server")
+			os.Exit(2)
+		}
+	}
 	log.Info("Graceful shutdown complete")
 }
 
-func readAPIPrivateKey(path string) (key *rsa.PrivateKey, err error) {
-	fh, err := os.Open(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open private key file: %w", err)
+// authMode is how requests to the github API are authenticated. Unless the mode
+// is set explicitly, app credentials take precedence over a static token
+func authMode(cfg *Config) string {
+	switch {
+	case cfg.GithubAuthMode != "":
+		return cfg.GithubAuthMode
+	case cfg.GithubAppID != "" || len(cfg.GithubExtraApps) > 0:
+		return authModeApp
+	case cfg.GithubToken != "":
+		return authModeToken
+	}
+	return authModeNone
+}
+
+// authProvider builds the provider of the auth mode, apps are only needed in app mode
+func authProvider(cfg *Config, httpClient *http.Client, apps []auth.App) (auth.Provider, error) {
+	mode := authMode(cfg)
+	switch mode {
+	case authModeApp:
+		if len(apps) == 0 {
+			return nil, fmt.Errorf("auth mode %q requires GITHUB_APP_ID or GITHUB_EXTRA_APPS", mode)
+		}
+		return auth.NewAppInstallation(httpClient, cfg.GithubURL, apps...), nil
+	case authModeToken:
+		if cfg.GithubToken == "" {
+			return nil, fmt.Errorf("auth mode %q requires GITHUB_TOKEN", mode)
+		}
+		return auth.NewStaticToken(cfg.GithubToken), nil
+	case authModeNone:
+		return auth.NewUnauthenticated(), nil
+	}
+	return nil, fmt.Errorf("unknown auth mode %q", mode)
+}
+
+// offlineGitHub starts the fake github and points the configuration to it
+func offlineGitHub(cfg *Config) (*githubtest.Server, error) {
+	fixtures := githubtest.Recorded()
+	if cfg.GithubFixtures != "" {
+		var err error
+		fixtures, err = githubtest.LoadFixtures(cfg.GithubFixtures)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fake := githubtest.NewServer(fixtures)
+	cfg.GithubURL = fake.URL
+	return fake, nil
+}
+
+// githubApps collects the credentials of the main app and of any extra apps whose
+// installations should join the token pool
+func githubApps(cfg *Config, log logrus.FieldLogger) (apps []auth.App, err error) {
+	if cfg.GithubAppID != "" {
+		keys, err := auth.NewKeyRing(log.WithField("app_id", cfg.GithubAppID), cfg.GithubPrivateKey...)
+		if err != nil {
+			return apps, fmt.Errorf("failed to read private keys %v: %w", cfg.GithubPrivateKey, err)
+		}
+		apps = append(apps, auth.App{ID: cfg.GithubAppID, Keys: keys})
+	}
+
+	for _, extra := range cfg.GithubExtraApps {
+		appID, path, found := strings.Cut(extra, ":")
+		if !found || appID == "" || path == "" {
+			return apps, fmt.Errorf("invalid extra app %q, expected APP_ID:PRIVATE_KEY_PATH", extra)
+		}
+		keys, err := auth.NewKeyRing(log.WithField("app_id", appID), path)
+		if err != nil {
+			return apps, fmt.Errorf("failed to read private key %s: %w", path, err)
+		}
+		apps = append(apps, auth.App{ID: appID, Keys: keys})
+	}
+	return apps, nil
+}
+
+// newGitHubForge picks how the languages of github repositories are fetched, graphql needs
+// a single query per hundred repositories instead of a REST request for each one
+func newGitHubForge(cfg *Config, client github.Client, provider auth.Provider) (forge.Forge, error) {
+	if cfg.GithubEnrichment != enrichmentGraphQL {
+		return forge.NewGitHub(client), nil
+	}
+	// the graphql API rejects anonymous requests
+	if auth.IsAnonymous(provider) {
+		return nil, fmt.Errorf("GITHUB_ENRICHMENT=%s requires github credentials", enrichmentGraphQL)
 	}
-	pemBytes, err := ioutil.ReadAll(fh)
+	return forge.NewGitHubGraphQL(client), nil
+}
+
+// apiKeyring gathers the keys of the environment and of the keys file
+func apiKeyring(cfg *Config) (*apikey.Keyring, error) {
+	keys, err := apikey.Parse(cfg.APIKeys)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
+		return nil, fmt.Errorf("invalid API_KEYS: %w", err)
+	}
+	if cfg.APIKeysFile != "" {
+		fileKeys, err := apikey.Load(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+
+	admins := make(map[string]bool, len(cfg.APIAdminKeys))
+	for _, name := range cfg.APIAdminKeys {
+		admins[strings.TrimSpace(name)] = false
 	}
-	return jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+	for i := range keys {
+		if _, ok := admins[keys[i].Name]; ok {
+			keys[i].Admin = true
+			admins[keys[i].Name] = true
+		}
+	}
+	for name, found := range admins {
+		if !found {
+			return nil, fmt.Errorf("invalid API_ADMIN_KEYS: no API key is named %q", name)
+		}
+	}
+	return apikey.NewKeyring(keys, apikey.Limits{
+		Rate:   cfg.APIKeyRate,
+		Burst:  cfg.APIKeyBurst,
+		Quota:  cfg.APIKeyQuota,
+		Window: cfg.APIKeyQuotaWindow,
+	})
 }
 
 func configureServer(
 	ctx context.Context,
 	cfg *Config,
 	log logrus.FieldLogger,
-	privateKey *rsa.PrivateKey,
-) (*http.Server, error) {
-	githubClient := github.NewClient(cfg.ClientTimeout, cfg.GithubURL, cfg.GithubAppID, privateKey)
-	authenticator := authentication.NewAuthenticator(githubClient, log)
+	httpClient *http.Client,
+	provider auth.Provider,
+	apps []auth.App,
+) (*http.Server, *grpc.Server, error) {
+	githubClient := github.NewClient(httpClient, cfg.GithubURL, provider)
+
+	// only tokens which expire need the refresh lifecycle
+	if provider.Expires() {
+		authenticator := authentication.NewAuthenticator(githubClient, log)
+		if err := authenticator.Authenticate(ctx, cfg.AuthInterval, cfg.AuthRefreshBuffer); err != nil {
+			return nil, nil, fmt.Errorf("failed to authenticate with github API: %w", err)
+		}
+	}
+
+	if len(apps) > 0 {
+		rings := make([]*auth.KeyRing, 0, len(apps))
+		for _, app := range apps {
+			rings = append(rings, app.Keys)
+		}
+		reloadCh := make(chan os.Signal, 1)
+		signal.Notify(reloadCh, syscall.SIGHUP)
+		authentication.NewKeyWatcher(rings, log).Watch(ctx, cfg.KeyReloadInterval, reloadCh)
+	}
+
+	text := fulltext.New()
+	index := fulltext.Indexed(store.NewMemory(), text)
 
-	if err := authenticator.Authenticate(ctx, cfg.AuthInterval, cfg.AuthRefreshBuffer); err != nil {
-		return nil, fmt.Errorf("failed to authenticate with github API: %w", err)
+	spec, err := openapi.Load()
+	if err != nil {
+		return nil, nil, err
 	}
 
 	log.Info("Initializing routes")
 	router := handlers.NewRouter(log)
+	keyring, err := apiKeyring(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if keyring.Len() > 0 {
+		log.WithField("keys", keyring.Len()).Info("API keys are required")
+		// the middlewares added first wrap the ones added after them, so the key is checked before
+		// the parameters and unknown clients don't get to learn about them
+		router.Use(handler.RequireAPIKey(keyring, "/ping", "/openapi.json", "/webhooks/github"))
+		router.Use(handler.RequireAdminKey("/admin/keys", "/health/tokens"))
+	}
+	router.Use(handler.ValidateRequest(spec))
 	router.HandleFunc("/ping", handler.Pong)
 	// Initialize web server and configure the following routes:
-	router.HandleFunc("/repos", handler.Repos(log, githubClient, cfg.WorkerCount))
+	githubForge, err := newGitHubForge(cfg, githubClient, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+	forges := map[string]forge.Forge{
+		forge.ProviderGitHub: githubForge,
+	}
+	if cfg.GithubEnterpriseURL != "" {
+		// the enterprise server is searched alongside the main github instance, with its own token
+		enterpriseProvider := auth.NewUnauthenticated()
+		if cfg.GithubEnterpriseToken != "" {
+			enterpriseProvider = auth.NewStaticToken(cfg.GithubEnterpriseToken)
+		}
+		enterpriseClient := github.NewClient(httpClient, cfg.GithubEnterpriseURL, enterpriseProvider)
+		enterpriseForge, err := newGitHubForge(cfg, enterpriseClient, enterpriseProvider)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid github enterprise configuration: %w", err)
+		}
+		forges[providerEnterprise] = forge.Named(enterpriseForge, providerEnterprise)
+	}
+	if cfg.GitlabURL != "" {
+		gitlabClient := gitlab.NewClient(&http.Client{Timeout: cfg.ClientTimeout}, cfg.GitlabURL, cfg.GitlabToken)
+		forges[forge.ProviderGitLab] = forge.NewGitLab(gitlabClient)
+	}
+	if cfg.GiteaURL != "" {
+		giteaClient := gitea.NewClient(&http.Client{Timeout: cfg.ClientTimeout}, cfg.GiteaURL, cfg.GiteaToken)
+		forges[forge.ProviderGitea] = forge.NewGitea(giteaClient)
+	}
+	search := handler.Search{
+		Forges:          forges,
+		DefaultProvider: cfg.DefaultProvider,
+		WorkerCount:     cfg.WorkerCount,
+		SourceTimeout:   cfg.SourceTimeout,
+		Index:           index,
+		Text:            text,
+		Flights:         federation.NewFlights(),
+		MaxAge:          cfg.ReposMaxAge,
+		Private:         keyring.Len() > 0,
+	}
+	if cfg.ReposCacheTTL > 0 {
+		search.Cache = httpcache.New(cfg.ReposCacheTTL, cfg.ReposCacheSize)
+	}
+	router.HandleFunc("/repos", handler.Repos(search))
+	router.HandleFunc("/repos/feed.atom", handler.ReposFeed(search, handler.FeedAtom))
+	router.HandleFunc("/repos/feed.rss", handler.ReposFeed(search, handler.FeedRSS))
+	executor, err := graphqlapi.NewExecutor(search.Searcher, index, graphqlapi.Limits{
+		MaxDepth:      cfg.GraphQLMaxDepth,
+		MaxComplexity: cfg.GraphQLMaxComplexity,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	router.HandleFunc("/graphql", handler.GraphQL(executor)).Methods(http.MethodGet, http.MethodPost)
+	router.HandleFunc("/stats/languages", handler.LanguageStats(index))
+	router.HandleFunc("/health/tokens", handler.TokenHealth(githubClient))
+	if cfg.GithubWebhookSecret != "" {
+		processor := webhook.NewProcessor(index, forge.ProviderGitHub, log)
+		deliveries := webhook.NewDeliveries(cfg.WebhookDeliveryTTL)
+		router.HandleFunc("/webhooks/github", handler.GithubWebhook([]byte(cfg.GithubWebhookSecret), deliveries, processor)).
+			Methods(http.MethodPost)
+	}
+
+	registry := savedsearch.NewRegistry()
+	if cfg.SavedSearchAllowInternalTargets {
+		registry.AllowInternalTargets()
+	}
+	deliveries := savedsearch.NewLog()
+	targetClient := savedsearch.TargetClient(cfg.ClientTimeout, cfg.SavedSearchAllowInternalTargets)
+	deliverer := savedsearch.NewDeliverer(targetClient, cfg.SavedSearchMaxAttempts, cfg.SavedSearchRetryDelay)
+	savedsearch.NewEvaluator(registry, index, deliverer, deliveries, log).Run(ctx, cfg.SavedSearchInterval)
+	router.HandleFunc("/searches", handler.ListSearches(registry)).Methods(http.MethodGet)
+	router.HandleFunc("/searches", handler.CreateSearch(registry)).Methods(http.MethodPost)
+	router.HandleFunc("/searches/{id}", handler.GetSearch(registry)).Methods(http.MethodGet)
+	router.HandleFunc("/searches/{id}", handler.UpdateSearch(registry)).Methods(http.MethodPut)
+	router.HandleFunc("/searches/{id}", handler.DeleteSearch(registry, deliveries)).Methods(http.MethodDelete)
+	router.HandleFunc("/searches/{id}/deliveries", handler.SearchDeliveries(registry, deliveries)).Methods(http.MethodGet)
+	router.HandleFunc("/admin/keys", handler.Keys(apps))
+	router.HandleFunc("/openapi.json", handler.OpenAPI)
 
 	log = log.WithField("port", cfg.Port)
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Port),
 		Handler: router,
 	}
-	return server, nil
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != 0 {
+		var opts []grpc.ServerOption
+		if keyring.Len() > 0 {
+			opts = append(opts,
+				grpc.ChainUnaryInterceptor(rpc.UnaryAPIKey(keyring)),
+				grpc.ChainStreamInterceptor(rpc.StreamAPIKey(keyring)),
+			)
+		}
+		grpcServer = grpc.NewServer(opts...)
+		rpc.NewServer(search, log).Register(grpcServer)
+	}
+	return server, grpcServer, nil
 }
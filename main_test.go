@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/gorilla/mux"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/openapi"
+	"github.com/stretchr/testify/suite"
+)
+
+type serverTestSuite struct {
+	suite.Suite
+	server *http.Server
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, new(serverTestSuite))
+}
+
+func (s *serverTestSuite) SetupTest() {
+	// every optional route is enabled
+	s.T().Setenv("GITHUB_WEBHOOK_SECRET", "secret")
+	cfg, err := newConfig()
+	s.Require().NoError(err)
+
+	s.server, _, err = configureServer(context.Background(), cfg, logger.Default(), http.DefaultClient, auth.NewUnauthenticated(), nil)
+	s.Require().NoError(err)
+}
+
+// every route must be documented and every documented operation routed
+func (s *serverTestSuite) TestRoutes_MatchOpenAPI() {
+	doc, err := openapi.Load()
+	s.Require().NoError(err)
+
+	var routed []string
+	err = s.server.Handler.(*handlers.Router).Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// routes accepting any method are documented as GET
+			methods = []string{http.MethodGet}
+		}
+		for _, method := range methods {
+			routed = append(routed, strings.ToLower(method)+" "+path)
+		}
+		return nil
+	})
+	s.Require().NoError(err)
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			documented = append(documented, method+" "+path)
+		}
+	}
+	sort.Strings(routed)
+	sort.Strings(documented)
+	s.Equal(documented, routed)
+}
+
+// the whole service runs against the fake github without any network
+func (s *serverTestSuite) TestOffline_SearchesTheFixtures() {
+	s.T().Setenv("GITHUB_OFFLINE", "true")
+	cfg, err := newConfig()
+	s.Require().NoError(err)
+	fake, err := offlineGitHub(cfg)
+	s.Require().NoError(err)
+	defer fake.Close()
+
+	server, _, err := configureServer(context.Background(), cfg, logger.Default(), http.DefaultClient, auth.NewUnauthenticated(), nil)
+	s.Require().NoError(err)
+
+	res := httptest.NewRecorder()
+	server.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/repos?language=go", nil))
+	s.Require().Equal(http.StatusOK, res.Code)
+	var repos []model.Repository
+	s.Require().NoError(json.Unmarshal(res.Body.Bytes(), &repos))
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.FullName)
+	}
+	s.ElementsMatch([]string{"quillstack/quill", "tidewater-labs/tide-gauge"}, names)
+	s.Equal(1, fake.Requests("/repositories"))
+}
+
+// clients without a key are turned away before their parameters are validated
+func (s *serverTestSuite) TestAPIKeys_CheckedBeforeValidation() {
+	s.T().Setenv("API_KEYS", "ci:s3cr3t")
+	cfg, err := newConfig()
+	s.Require().NoError(err)
+	server, _, err := configureServer(context.Background(), cfg, logger.Default(), http.DefaultClient, auth.NewUnauthenticated(), nil)
+	s.Require().NoError(err)
+
+	res := httptest.NewRecorder()
+	server.Handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/repos?facet_limit=many", nil))
+	s.Equal(http.StatusUnauthorized, res.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/repos?facet_limit=many", nil)
+	req.Header.Set("X-API-Key", "s3cr3t")
+	res = httptest.NewRecorder()
+	server.Handler.ServeHTTP(res, req)
+	s.Equal(http.StatusBadRequest, res.Code)
+}
+
+func (s *serverTestSuite) TestAPIKeys_AdminEndpoints() {
+	s.T().Setenv("API_KEYS", "ci:s3cr3t,ops:admin")
+	s.T().Setenv("API_ADMIN_KEYS", "ops")
+	cfg, err := newConfig()
+	s.Require().NoError(err)
+	server, _, err := configureServer(context.Background(), cfg, logger.Default(), http.DefaultClient, auth.NewUnauthenticated(), nil)
+	s.Require().NoError(err)
+
+	for key, code := range map[string]int{"s3cr3t": http.StatusForbidden, "admin": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/health/tokens", nil)
+		req.Header.Set("X-API-Key", key)
+		res := httptest.NewRecorder()
+		server.Handler.ServeHTTP(res, req)
+		s.Equal(code, res.Code, key)
+	}
+
+	s.T().Setenv("API_ADMIN_KEYS", "root")
+	cfg, err = newConfig()
+	s.Require().NoError(err)
+	_, _, err = configureServer(context.Background(), cfg, logger.Default(), http.DefaultClient, auth.NewUnauthenticated(), nil)
+	s.ErrorContains(err, "API_ADMIN_KEYS")
+}
+
+func (s *serverTestSuite) TestOffline_RejectsGraphQLEnrichment() {
+	s.T().Setenv("GITHUB_OFFLINE", "true")
+	s.T().Setenv("GITHUB_ENRICHMENT", "graphql")
+	_, err := newConfig()
+	s.Error(err)
+}
+
+func (s *serverTestSuite) TestOffline_RejectsNetworkForges() {
+	s.T().Setenv("GITHUB_OFFLINE", "true")
+	for _, name := range []string{"GITHUB_ENTERPRISE_API_URL", "GITLAB_API_URL", "GITEA_API_URL"} {
+		s.Run(name, func() {
+			s.T().Setenv(name, "https://forge.example.com")
+			_, err := newConfig()
+			s.ErrorContains(err, name)
+		})
+	}
+}
+
+func (s *serverTestSuite) TestAuthMode() {
+	s.T().Setenv("GITHUB_APP_ID", "1234")
+	s.T().Setenv("GITHUB_PRIVATE_KEY", "/does/not/exist.pem")
+	cfg, err := newConfig()
+	s.Require().NoError(err)
+	s.Equal(authModeApp, authMode(cfg))
+
+	// an explicit mode wins over the app credentials, whose keys aren't read
+	s.T().Setenv("GITHUB_AUTH_MODE", authModeToken)
+	s.T().Setenv("GITHUB_TOKEN", "token")
+	cfg, err = newConfig()
+	s.Require().NoError(err)
+	s.Equal(authModeToken, authMode(cfg))
+	provider, err := authProvider(cfg, http.DefaultClient, nil)
+	s.Require().NoError(err)
+	s.False(provider.Expires())
+
+	s.T().Setenv("GITHUB_AUTH_MODE", authModeNone)
+	cfg, err = newConfig()
+	s.Require().NoError(err)
+	s.Equal(authModeNone, authMode(cfg))
+}
@@ -0,0 +1,263 @@
+package apikey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrUnknownKey    = errors.New("missing or unknown API key")
+	ErrRateLimited   = errors.New("API key rate limit exceeded")
+	ErrQuotaExceeded = errors.New("API key quota of upstream calls exceeded")
+)
+
+// Unlimited lifts the rate or quota of a key whatever the defaults, since the limits of a key left to zero are the defaults
+const Unlimited = -1
+
+// Limits bound what a key may do, Quota is counted in calls made to github on behalf of the
+// key over each Window and may be overrun, see Client.Allow. A zero Rate or Quota in the defaults lifts the limit
+type Limits struct {
+	Rate   float64       `json:"rate"`
+	Burst  int           `json:"burst"`
+	Quota  int           `json:"quota"`
+	Window time.Duration `json:"-"`
+}
+
+// Key is a client of the API, the limits it doesn't set are the defaults
+type Key struct {
+	Name   string `json:"name"`
+	Secret string `json:"key"`
+	// Admin lets the key read the admin endpoints and the saved searches of every key
+	Admin bool `json:"admin"`
+	Limits
+}
+
+// UnmarshalJSON reads a rate or quota explicitly set to 0 as Unlimited, only the limits missing from the key are the defaults
+func (k *Key) UnmarshalJSON(b []byte) error {
+	type plain Key
+	var fields struct {
+		plain
+		Rate  *float64 `json:"rate"`
+		Quota *int     `json:"quota"`
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	*k = Key(fields.plain)
+	if fields.Rate != nil {
+		k.Rate = *fields.Rate
+		if k.Rate == 0 {
+			k.Rate = Unlimited
+		}
+	}
+	if fields.Quota != nil {
+		k.Quota = *fields.Quota
+		if k.Quota == 0 {
+			k.Quota = Unlimited
+		}
+	}
+	return nil
+}
+
+// Parse reads keys given as name:secret pairs
+func Parse(pairs []string) ([]Key, error) {
+	keys := make([]Key, 0, len(pairs))
+	for i, pair := range pairs {
+		name, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || name == "" || secret == "" {
+			// the pair isn't quoted in the error since it may be nothing but the secret
+			return nil, fmt.Errorf("invalid API key %d, expected name:key", i)
+		}
+		keys = append(keys, Key{Name: name, Secret: secret})
+	}
+	return keys, nil
+}
+
+// Load reads keys from a JSON file holding a list of {"name", "key", "admin", "rate", "burst", "quota"} objects
+func Load(path string) ([]Key, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file %s: %w", path, err)
+	}
+	var keys []Key
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file %s: %w", path, err)
+	}
+	for i, key := range keys {
+		if key.Name == "" || key.Secret == "" {
+			return nil, fmt.Errorf("API key %d of %s needs a name and a key", i, path)
+		}
+	}
+	return keys, nil
+}
+
+// Client tracks what a key consumed, its token bucket refills continuously while
+// its quota is reset at the end of each window
+type Client struct {
+	Name   string
+	Admin  bool
+	limits Limits
+	now    func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	filled time.Time
+	used   int
+	reset  time.Time
+}
+
+// Usage is where the quota of a client stands
+type Usage struct {
+	Limit     int
+	Used      int
+	Remaining int
+	Reset     time.Time
+}
+
+// Allow takes a token for a request, it reports how long to wait before retrying when the
+// bucket is empty or the quota is exhausted. The quota is soft: it is only checked when a request
+// starts and the calls it goes on to make are all counted, so the requests let through while
+// some quota was left may together go over it
+func (c *Client) Allow() (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.rollWindow(now)
+
+	if c.limits.Quota > 0 && c.used >= c.limits.Quota {
+		return c.reset.Sub(now), ErrQuotaExceeded
+	}
+	if c.limits.Rate <= 0 {
+		return 0, nil
+	}
+
+	c.tokens = math.Min(float64(c.limits.Burst), c.tokens+now.Sub(c.filled).Seconds()*c.limits.Rate)
+	c.filled = now
+	if c.tokens < 1 {
+		return time.Duration((1 - c.tokens) / c.limits.Rate * float64(time.Second)), ErrRateLimited
+	}
+	c.tokens--
+	return 0, nil
+}
+
+// Consume counts calls made upstream on behalf of the client
+func (c *Client) Consume(calls int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollWindow(c.now())
+	c.used += calls
+}
+
+func (c *Client) Usage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rollWindow(c.now())
+	usage := Usage{Limit: c.limits.Quota, Used: c.used, Reset: c.reset}
+	if c.limits.Quota > 0 && c.used < c.limits.Quota {
+		usage.Remaining = c.limits.Quota - c.used
+	}
+	return usage
+}
+
+func (c *Client) rollWindow(now time.Time) {
+	if now.Before(c.reset) {
+		return
+	}
+	c.used = 0
+	c.reset = now.Add(c.limits.Window)
+}
+
+// Keyring holds the clients of the API by the hash of their key
+type Keyring struct {
+	clients map[[sha256.Size]byte]*Client
+}
+
+// NewKeyring sets up a client for each key, the limits a key leaves to zero are taken from the defaults
+func NewKeyring(keys []Key, defaults Limits) (*Keyring, error) {
+	ring := &Keyring{clients: make(map[[sha256.Size]byte]*Client, len(keys))}
+	now := func() time.Time { return time.Now() }
+	for _, key := range keys {
+		limits := key.Limits
+		if limits.Rate == 0 {
+			limits.Rate = defaults.Rate
+		}
+		if limits.Burst == 0 {
+			limits.Burst = defaults.Burst
+		}
+		if limits.Quota == 0 {
+			limits.Quota = defaults.Quota
+		}
+		limits.Window = defaults.Window
+		// from here on a zero rate or quota means there is none
+		if limits.Rate < 0 {
+			limits.Rate = 0
+		}
+		if limits.Quota < 0 {
+			limits.Quota = 0
+		}
+		if limits.Burst < 1 {
+			limits.Burst = 1
+		}
+
+		hash := sha256.Sum256([]byte(key.Secret))
+		if _, ok := ring.clients[hash]; ok {
+			return nil, fmt.Errorf("API key %s is configured twice", key.Name)
+		}
+		ring.clients[hash] = &Client{Name: key.Name, Admin: key.Admin, limits: limits, tokens: float64(limits.Burst), filled: now(), now: now}
+	}
+	return ring, nil
+}
+
+// Lookup finds the client of a key, keys are compared by hash so that the lookup
+// doesn't take longer the more of a key is right
+func (k *Keyring) Lookup(secret string) (*Client, error) {
+	client, ok := k.clients[sha256.Sum256([]byte(secret))]
+	if !ok || secret == "" {
+		return nil, ErrUnknownKey
+	}
+	return client, nil
+}
+
+func (k *Keyring) Len() int {
+	return len(k.clients)
+}
+
+type (
+	contextKey struct{}
+	meterKey   struct{}
+)
+
+// WithClient attaches the client to the context of its request, so that the calls made upstream are metered
+func WithClient(ctx context.Context, client *Client) context.Context {
+	return context.WithValue(ctx, contextKey{}, client)
+}
+
+func FromContext(ctx context.Context) (*Client, bool) {
+	client, ok := ctx.Value(contextKey{}).(*Client)
+	return client, ok && client != nil
+}
+
+// Meter counts the calls made upstream for work shared by several clients, such as a search
+// other requests wait for, so that each of them can be charged once it is over
+type Meter struct {
+	calls atomic.Int64
+}
+
+// WithMeter counts the calls made with the context on the meter rather than on the client of the request
+func WithMeter(ctx context.Context, meter *Meter) context.Context {
+	ctx = context.WithValue(ctx, contextKey{}, (*Client)(nil))
+	return context.WithValue(ctx, meterKey{}, meter)
+}
+
+func (m *Meter) Calls() int {
+	return int(m.calls.Load())
+}
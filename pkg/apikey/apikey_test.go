@@ -0,0 +1,159 @@
+package apikey_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/stretchr/testify/suite"
+)
+
+type apikeyTestSuite struct {
+	suite.Suite
+}
+
+func TestAPIKey(t *testing.T) {
+	suite.Run(t, new(apikeyTestSuite))
+}
+
+func (s *apikeyTestSuite) keyring(keys ...apikey.Key) *apikey.Keyring {
+	keyring, err := apikey.NewKeyring(keys, apikey.Limits{Rate: 1000, Burst: 100, Quota: 10, Window: time.Hour})
+	s.Require().NoError(err)
+	return keyring
+}
+
+func (s *apikeyTestSuite) TestParse() {
+	keys, err := apikey.Parse([]string{"ci:s3cr3t", " dashboard:a:b "})
+	s.Require().NoError(err)
+	s.Equal([]apikey.Key{{Name: "ci", Secret: "s3cr3t"}, {Name: "dashboard", Secret: "a:b"}}, keys)
+
+	for _, invalid := range []string{"s3cr3t", "ci:", ":s3cr3t"} {
+		_, err := apikey.Parse([]string{invalid})
+		s.Error(err, invalid)
+		// the secret must not end up in the logs
+		s.NotContains(err.Error(), "s3cr3t")
+	}
+}
+
+func (s *apikeyTestSuite) TestLoad() {
+	path := filepath.Join(s.T().TempDir(), "keys.json")
+	s.Require().NoError(os.WriteFile(path, []byte(`[{"name": "ci", "key": "s3cr3t", "quota": 50}, {"name": "bot", "key": "other", "rate": 0.5, "admin": true}]`), 0o600))
+
+	keys, err := apikey.Load(path)
+	s.Require().NoError(err)
+	s.Equal([]apikey.Key{
+		{Name: "ci", Secret: "s3cr3t", Limits: apikey.Limits{Quota: 50}},
+		{Name: "bot", Secret: "other", Admin: true, Limits: apikey.Limits{Rate: 0.5}},
+	}, keys)
+
+	// a limit set to 0 is lifted rather than left to the defaults
+	s.Require().NoError(os.WriteFile(path, []byte(`[{"name": "ci", "key": "s3cr3t", "rate": 0, "quota": 0, "burst": 2}]`), 0o600))
+	keys, err = apikey.Load(path)
+	s.Require().NoError(err)
+	s.Equal([]apikey.Key{{Name: "ci", Secret: "s3cr3t", Limits: apikey.Limits{Rate: apikey.Unlimited, Burst: 2, Quota: apikey.Unlimited}}}, keys)
+
+	s.Require().NoError(os.WriteFile(path, []byte(`[{"name": "ci"}]`), 0o600))
+	_, err = apikey.Load(path)
+	s.Error(err)
+	_, err = apikey.Load(filepath.Join(s.T().TempDir(), "missing.json"))
+	s.Error(err)
+}
+
+func (s *apikeyTestSuite) TestKeyring_Lookup() {
+	keyring := s.keyring(apikey.Key{Name: "ci", Secret: "s3cr3t"}, apikey.Key{Name: "ops", Secret: "admin", Admin: true})
+	client, err := keyring.Lookup("s3cr3t")
+	s.Require().NoError(err)
+	s.Equal("ci", client.Name)
+	s.False(client.Admin)
+	client, err = keyring.Lookup("admin")
+	s.Require().NoError(err)
+	s.True(client.Admin)
+
+	for _, unknown := range []string{"", "s3cr3", "S3CR3T"} {
+		_, err := keyring.Lookup(unknown)
+		s.ErrorIs(err, apikey.ErrUnknownKey, unknown)
+	}
+
+	_, err = apikey.NewKeyring([]apikey.Key{{Name: "a", Secret: "same"}, {Name: "b", Secret: "same"}}, apikey.Limits{})
+	s.Error(err)
+}
+
+func (s *apikeyTestSuite) TestAllow_TokenBucket() {
+	keyring := s.keyring(apikey.Key{Name: "ci", Secret: "s3cr3t", Limits: apikey.Limits{Rate: 0.01, Burst: 2}})
+	client, err := keyring.Lookup("s3cr3t")
+	s.Require().NoError(err)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Allow()
+		s.NoError(err)
+	}
+	wait, err := client.Allow()
+	s.ErrorIs(err, apikey.ErrRateLimited)
+	// a token comes back every 100s
+	s.InDelta(100*time.Second, wait, float64(time.Second))
+}
+
+func (s *apikeyTestSuite) TestAllow_Quota() {
+	keyring, err := apikey.NewKeyring([]apikey.Key{{Name: "ci", Secret: "s3cr3t"}}, apikey.Limits{Quota: 3, Window: 100 * time.Millisecond})
+	s.Require().NoError(err)
+	client, err := keyring.Lookup("s3cr3t")
+	s.Require().NoError(err)
+
+	_, err = client.Allow()
+	s.Require().NoError(err)
+	client.Consume(2)
+	usage := client.Usage()
+	s.Equal(3, usage.Limit)
+	s.Equal(2, usage.Used)
+	s.Equal(1, usage.Remaining)
+
+	// a request may go over what is left, the next ones are turned away until the window is over
+	client.Consume(5)
+	s.Equal(0, client.Usage().Remaining)
+	wait, err := client.Allow()
+	s.ErrorIs(err, apikey.ErrQuotaExceeded)
+	s.LessOrEqual(wait, 100*time.Millisecond)
+
+	time.Sleep(wait + 10*time.Millisecond)
+	_, err = client.Allow()
+	s.NoError(err)
+	s.Equal(0, client.Usage().Used)
+}
+
+func (s *apikeyTestSuite) TestAllow_Unlimited() {
+	keyring := s.keyring(apikey.Key{Name: "ci", Secret: "s3cr3t", Limits: apikey.Limits{Rate: apikey.Unlimited, Burst: 1, Quota: apikey.Unlimited}})
+	client, err := keyring.Lookup("s3cr3t")
+	s.Require().NoError(err)
+
+	// the quota of the defaults would have stopped the client after ten calls
+	for i := 0; i < 20; i++ {
+		_, err := client.Allow()
+		s.Require().NoError(err)
+		client.Consume(1)
+	}
+	s.Equal(0, client.Usage().Limit)
+}
+
+func (s *apikeyTestSuite) TestMetered_CountsCallsOfTheRequestKey() {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	httpClient := &http.Client{Transport: apikey.Metered(nil)}
+
+	client, err := s.keyring(apikey.Key{Name: "ci", Secret: "s3cr3t"}).Lookup("s3cr3t")
+	s.Require().NoError(err)
+	ctx := apikey.WithClient(context.Background(), client)
+
+	for _, ctx := range []context.Context{ctx, ctx, context.Background()} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		s.Require().NoError(err)
+		res, err := httpClient.Do(req)
+		s.Require().NoError(err)
+		res.Body.Close()
+	}
+	s.Equal(2, client.Usage().Used)
+}
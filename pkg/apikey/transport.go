@@ -0,0 +1,30 @@
+package apikey
+
+import (
+	"net/http"
+)
+
+// meteredTransport counts each request against the quota of the client whose request it serves,
+// or on the meter of the work shared by several clients
+type meteredTransport struct {
+	next http.RoundTripper
+}
+
+// Metered wraps the transport of the upstream http client, the requests made outside of
+// an API request aren't counted. Tokens are refreshed with a client which isn't wrapped,
+// so that a refresh triggered by a 401 during an API request isn't counted either
+func Metered(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &meteredTransport{next: next}
+}
+
+func (t *meteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if meter, ok := req.Context().Value(meterKey{}).(*Meter); ok {
+		meter.calls.Add(1)
+	} else if client, ok := FromContext(req.Context()); ok {
+		client.Consume(1)
+	}
+	return t.next.RoundTrip(req)
+}
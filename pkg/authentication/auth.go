@@ -20,7 +20,11 @@ func NewAuthenticator(githubClient github.Client, log logrus.FieldLogger) *Authe
 func (a *Authenticator) Authenticate(ctx context.Context, interval, buffer time.Duration) error {
 	token, err := a.githubClient.SetAccessToken(ctx)
 	if err != nil {
-		return err
+		if token.Token == "" {
+			return err
+		}
+		// some apps couldn't be listed, the tokens of the others are used meanwhile
+		a.logger.WithError(err).Error("failed to refresh some github access tokens")
 	}
 
 	go func() {
@@ -31,14 +35,22 @@ func (a *Authenticator) Authenticate(ctx context.Context, interval, buffer time.
 				ticker.Stop()
 				return
 
+			// the client may refresh on its own after a 401, so keep track of its latest token
+			case token = <-a.githubClient.TokenUpdates():
+				a.logger.Debug("github access token was refreshed")
+
 			case <-ticker.C:
 				cutoff := time.Now().UTC().Add(buffer)
 				if cutoff.After(token.ExpiresAt) {
 					a.logger.Debug("refreshing github access token")
-					token, err = a.githubClient.SetAccessToken(ctx)
+					refreshed, err := a.githubClient.SetAccessToken(ctx)
 					if err != nil {
 						a.logger.WithError(err).Error("failed to reset access token")
+						if refreshed.Token == "" {
+							continue
+						}
 					}
+					token = refreshed
 				}
 			}
 		}
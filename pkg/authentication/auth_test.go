@@ -8,7 +8,7 @@ import (
 
 	"github.com/Scalingo/go-utils/logger"
 	"github.com/laouji/git-repo-searcher/pkg/authentication"
-	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
 	mock_github "github.com/laouji/git-repo-searcher/pkg/github/mocks"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/mock/gomock"
@@ -35,7 +35,7 @@ func (s *authenticatorTestSuite) TestAuthenticate_BailOnAuthError() {
 	authenticator := authentication.NewAuthenticator(s.clientMock, logger.Default())
 
 	expectedErr := errors.New("some err")
-	token := github.Token{ExpiresAt: time.Now().Add(time.Hour)}
+	token := auth.Token{ExpiresAt: time.Now().Add(time.Hour)}
 	s.clientMock.EXPECT().SetAccessToken(gomock.Any()).Return(token, expectedErr)
 
 	err := authenticator.Authenticate(context.Background(), interval, threshold)
@@ -0,0 +1,55 @@
+package authentication
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyWatcher reloads the private keys of github apps so they can be rotated without a restart
+type KeyWatcher struct {
+	rings  []*auth.KeyRing
+	logger logrus.FieldLogger
+}
+
+func NewKeyWatcher(rings []*auth.KeyRing, log logrus.FieldLogger) *KeyWatcher {
+	return &KeyWatcher{rings, log}
+}
+
+// Watch checks the key files for changes every interval and whenever a signal is received on reload
+func (w *KeyWatcher) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+
+			case sig := <-reload:
+				w.logger.WithField("signal", sig.String()).Info("reloading github app private keys")
+				w.reload(true)
+
+			case <-ticker.C:
+				w.reload(false)
+			}
+		}
+	}()
+}
+
+// reload picks up the key files which changed, or every file when an operator asked for it
+func (w *KeyWatcher) reload(force bool) {
+	for _, ring := range w.rings {
+		reload := ring.Reload
+		if force {
+			reload = ring.ForceReload
+		}
+		if err := reload(); err != nil {
+			// keep signing with the keys we already have until the file is fixed
+			w.logger.WithError(err).Error("failed to reload github app private key")
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatTSV = "tsv"
+
+	// LayoutWide writes one row per repository with a column per language
+	LayoutWide = "wide"
+	// LayoutLong writes one row per repository and language pair
+	LayoutLong = "long"
+
+	// flushEvery bounds how many rows are buffered before they are sent to the client
+	flushEvery = 100
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown export format")
+	ErrUnknownLayout = errors.New("unknown export layout")
+
+	// utf8BOM lets Excel detect that the file is UTF-8 rather than the system code page
+	utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+	baseColumns = []string{"provider", "id", "full_name", "owner", "owner_type", "repository", "description", "html_url", "created_at", "stars", "fork", "license", "topics"}
+)
+
+type Options struct {
+	Format string
+	Layout string
+	// Excel adds a byte order mark and uses CRLF line endings
+	Excel bool
+}
+
+func (o Options) Validate() error {
+	if o.Format != FormatCSV && o.Format != FormatTSV {
+		return fmt.Errorf("%w %q, expected %s or %s", ErrUnknownFormat, o.Format, FormatCSV, FormatTSV)
+	}
+	if o.Layout != LayoutWide && o.Layout != LayoutLong {
+		return fmt.Errorf("%w %q, expected %s or %s", ErrUnknownLayout, o.Layout, LayoutWide, LayoutLong)
+	}
+	return nil
+}
+
+func (o Options) ContentType() string {
+	if o.Format == FormatTSV {
+		return "text/tab-separated-values; charset=utf-8"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Filename is suggested to browsers through the Content-Disposition header
+func (o Options) Filename(now time.Time) string {
+	return fmt.Sprintf("repos-%s-%s.%s", o.Layout, now.UTC().Format("20060102T150405Z"), o.Format)
+}
+
+// Write flattens the repositories into rows, flushing them to w as it goes when w supports it
+func Write(w io.Writer, repos []model.Repository, opts Options) error {
+	rows, err := newRowWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	if opts.Layout == LayoutLong {
+		writeLongHeader(rows)
+		for _, repo := range repos {
+			writeLong(rows, repo)
+		}
+	} else {
+		writeWide(rows, repos)
+	}
+	return rows.close()
+}
+
+// LongWriter writes the long layout one repository at a time, so that the rows can be sent
+// as the repositories are found. Unlike the wide layout it doesn't need them all for its header
+type LongWriter struct {
+	rows *rowWriter
+}
+
+// NewLongWriter writes the header of the long layout whatever the layout of opts
+func NewLongWriter(w io.Writer, opts Options) (*LongWriter, error) {
+	opts.Layout = LayoutLong
+	rows, err := newRowWriter(w, opts)
+	if err != nil {
+		return nil, err
+	}
+	writeLongHeader(rows)
+	return &LongWriter{rows: rows}, nil
+}
+
+// Write flushes the rows of the repository to the client rather than waiting for a full batch
+func (l *LongWriter) Write(repo model.Repository) {
+	writeLong(l.rows, repo)
+	l.rows.flush()
+}
+
+// Close reports the first error met while writing
+func (l *LongWriter) Close() error {
+	return l.rows.close()
+}
+
+func writeWide(rows *rowWriter, repos []model.Repository) {
+	seen := make(map[string]struct{})
+	for _, repo := range repos {
+		for language := range repo.Languages {
+			seen[language] = struct{}{}
+		}
+	}
+	languages := make([]string, 0, len(seen))
+	for language := range seen {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	// language columns hold the share of the repository in percent, empty when the language isn't used
+	header := append(append([]string{}, baseColumns...), languages...)
+	rows.write(header)
+	for _, repo := range repos {
+		row := baseRow(repo)
+		for _, language := range languages {
+			cell := ""
+			if share, ok := repo.Languages[language]; ok {
+				cell = formatPercent(share.Percent)
+			}
+			row = append(row, cell)
+		}
+		rows.write(row)
+	}
+}
+
+func writeLongHeader(rows *rowWriter) {
+	rows.write(append(append([]string{}, baseColumns...), "language", "bytes", "percent"))
+}
+
+func writeLong(rows *rowWriter, repo model.Repository) {
+	// repositories without any detected language still get a row so that none go missing
+	if len(repo.Languages) == 0 {
+		rows.write(append(baseRow(repo), "", "", ""))
+		return
+	}
+
+	languages := make([]string, 0, len(repo.Languages))
+	for language := range repo.Languages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		share := repo.Languages[language]
+		bytes := ""
+		if share.Bytes > 0 {
+			bytes = strconv.FormatInt(share.Bytes, 10)
+		}
+		rows.write(append(baseRow(repo), language, bytes, formatPercent(share.Percent)))
+	}
+}
+
+func baseRow(repo model.Repository) []string {
+	createdAt := ""
+	if !repo.CreatedAt.IsZero() {
+		createdAt = repo.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		repo.Provider,
+		strconv.FormatInt(repo.ID, 10),
+		repo.FullName,
+		repo.Owner,
+		repo.OwnerType,
+		repo.Repository,
+		repo.Description,
+		repo.HTMLURL,
+		createdAt,
+		strconv.Itoa(repo.Stars),
+		strconv.FormatBool(repo.Fork),
+		repo.License,
+		strings.Join(repo.Topics, " "),
+	}
+}
+
+func formatPercent(percent float64) string {
+	return strconv.FormatFloat(percent, 'f', 2, 64)
+}
+
+type rowWriter struct {
+	writer  *csv.Writer
+	flusher http.Flusher
+	format  string
+	pending int
+}
+
+// newRowWriter writes the byte order mark right away when opts asks for one
+func newRowWriter(w io.Writer, opts Options) (*rowWriter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Excel {
+		if _, err := w.Write(utf8BOM); err != nil {
+			return nil, fmt.Errorf("failed to write byte order mark: %w", err)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = opts.Excel
+	if opts.Format == FormatTSV {
+		writer.Comma = '\t'
+	}
+	return &rowWriter{writer: writer, flusher: flusherOf(w), format: opts.Format}, nil
+}
+
+// write neutralizes formulas whatever the format, since a CSV or TSV file ends up in a spreadsheet either way
+func (r *rowWriter) write(row []string) {
+	for i, cell := range row {
+		row[i] = neutralizeFormula(cell)
+	}
+	// errors are sticky on the csv writer and reported once everything was written
+	r.writer.Write(row)
+
+	r.pending++
+	if r.pending == flushEvery {
+		r.flush()
+	}
+}
+
+func (r *rowWriter) flush() {
+	r.pending = 0
+	r.writer.Flush()
+	if r.flusher != nil {
+		r.flusher.Flush()
+	}
+}
+
+func (r *rowWriter) close() error {
+	r.writer.Flush()
+	if err := r.writer.Error(); err != nil {
+		return fmt.Errorf("failed to write %s rows: %w", r.format, err)
+	}
+	return nil
+}
+
+// neutralizeFormula prefixes cells spreadsheets would evaluate, since names and
+// descriptions are chosen by whoever created the repository
+func neutralizeFormula(cell string) string {
+	if cell == "" {
+		return cell
+	}
+	switch cell[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + cell
+	}
+	return cell
+}
+
+func flusherOf(w io.Writer) http.Flusher {
+	flusher, _ := w.(http.Flusher)
+	return flusher
+}
@@ -0,0 +1,127 @@
+package export_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/export"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/stretchr/testify/suite"
+)
+
+type exportTestSuite struct {
+	suite.Suite
+	repos []model.Repository
+}
+
+func TestExport(t *testing.T) {
+	suite.Run(t, new(exportTestSuite))
+}
+
+func (s *exportTestSuite) SetupTest() {
+	s.repos = []model.Repository{
+		{
+			Provider:    "github",
+			ID:          2,
+			FullName:    "owner/web",
+			Owner:       "owner",
+			OwnerType:   model.OwnerTypeOrganization,
+			Repository:  "web",
+			Description: "a web, in go",
+			HTMLURL:     "https://github.com/owner/web",
+			CreatedAt:   time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC),
+			Topics:      []string{"cli", "golang"},
+			Languages: map[string]model.Language{
+				"go":   {Bytes: 750, Percent: 75},
+				"html": {Bytes: 250, Percent: 25},
+			},
+		},
+		{
+			Provider:   "gitlab",
+			ID:         1,
+			FullName:   "group/empty",
+			Owner:      "group",
+			Repository: "=HYPERLINK(\"http://evil\")",
+			Fork:       true,
+		},
+	}
+}
+
+func (s *exportTestSuite) TestWide() {
+	var buf bytes.Buffer
+	s.Require().NoError(export.Write(&buf, s.repos, export.Options{Format: export.FormatCSV, Layout: export.LayoutWide}))
+
+	s.Equal(strings.Join([]string{
+		"provider,id,full_name,owner,owner_type,repository,description,html_url,created_at,stars,fork,license,topics,go,html",
+		`github,2,owner/web,owner,organization,web,"a web, in go",https://github.com/owner/web,2024-05-02T17:41:07Z,0,false,,cli golang,75.00,25.00`,
+		`gitlab,1,group/empty,group,,"'=HYPERLINK(""http://evil"")",,,,0,true,,,,`,
+		"",
+	}, "\n"), buf.String())
+}
+
+func (s *exportTestSuite) TestLong() {
+	var buf bytes.Buffer
+	s.Require().NoError(export.Write(&buf, s.repos, export.Options{Format: export.FormatTSV, Layout: export.LayoutLong}))
+
+	s.Equal(strings.Join([]string{
+		"provider\tid\tfull_name\towner\towner_type\trepository\tdescription\thtml_url\tcreated_at\tstars\tfork\tlicense\ttopics\tlanguage\tbytes\tpercent",
+		"github\t2\towner/web\towner\torganization\tweb\ta web, in go\thttps://github.com/owner/web\t2024-05-02T17:41:07Z\t0\tfalse\t\tcli golang\tgo\t750\t75.00",
+		"github\t2\towner/web\towner\torganization\tweb\ta web, in go\thttps://github.com/owner/web\t2024-05-02T17:41:07Z\t0\tfalse\t\tcli golang\thtml\t250\t25.00",
+		"gitlab\t1\tgroup/empty\tgroup\t\t\"'=HYPERLINK(\"\"http://evil\"\")\"\t\t\t\t0\ttrue\t\t\t\t\t",
+		"",
+	}, "\n"), buf.String())
+}
+
+func (s *exportTestSuite) TestExcel() {
+	var buf bytes.Buffer
+	s.Require().NoError(export.Write(&buf, s.repos, export.Options{Format: export.FormatCSV, Layout: export.LayoutWide, Excel: true}))
+
+	out := buf.String()
+	s.True(strings.HasPrefix(out, "\xEF\xBB\xBFprovider,"))
+	s.Contains(out, "\r\n")
+	s.Contains(out, `"'=HYPERLINK(""http://evil"")"`)
+}
+
+func (s *exportTestSuite) TestFlushesWhileWriting() {
+	repos := make([]model.Repository, 250)
+	for i := range repos {
+		repos[i] = model.Repository{Provider: "github", ID: int64(i), FullName: fmt.Sprintf("owner/%d", i)}
+	}
+	w := &flushRecorder{}
+	s.Require().NoError(export.Write(w, repos, export.Options{Format: export.FormatCSV, Layout: export.LayoutLong}))
+	s.Equal(2, w.flushes)
+	s.Equal(251, strings.Count(w.String(), "\n"))
+}
+
+func (s *exportTestSuite) TestLongWriter() {
+	w := &flushRecorder{}
+	rows, err := export.NewLongWriter(w, export.Options{Format: export.FormatTSV})
+	s.Require().NoError(err)
+	for _, repo := range s.repos {
+		rows.Write(repo)
+	}
+	s.Require().NoError(rows.Close())
+
+	// every repository is sent as soon as it is written
+	s.Equal(2, w.flushes)
+	var buf bytes.Buffer
+	s.Require().NoError(export.Write(&buf, s.repos, export.Options{Format: export.FormatTSV, Layout: export.LayoutLong}))
+	s.Equal(buf.String(), w.String())
+}
+
+func (s *exportTestSuite) TestValidate() {
+	s.ErrorIs(export.Options{Format: "xlsx", Layout: export.LayoutWide}.Validate(), export.ErrUnknownFormat)
+	s.ErrorIs(export.Options{Format: export.FormatCSV, Layout: "tall"}.Validate(), export.ErrUnknownLayout)
+}
+
+type flushRecorder struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushes++
+}
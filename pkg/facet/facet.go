@@ -0,0 +1,149 @@
+package facet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	Language  = "language"
+	OwnerType = "owner_type"
+	Fork      = "fork"
+
+	// unknown counts the repositories the forge didn't say anything about
+	unknown = "unknown"
+)
+
+var (
+	ErrUnknownFacet = errors.New("unknown facet")
+
+	names = []string{Language, OwnerType, Fork}
+)
+
+// Bucket is the number of repositories sharing a facet value
+type Bucket struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Result holds the most common values of a facet, Other counts the
+// repositories whose value didn't make it into the top buckets
+type Result struct {
+	Buckets []Bucket `json:"buckets"`
+	Other   int      `json:"other"`
+}
+
+// Counter counts the values of the requested facets over the repositories it is given.
+// It is safe for concurrent use so that it can count repositories as they are found
+type Counter struct {
+	mu     sync.Mutex
+	facets []string
+	limit  int
+	counts map[string]map[string]int
+}
+
+// Parse reads a comma separated list of facets, duplicates are ignored
+func Parse(list string) (facets []string, err error) {
+	seen := make(map[string]struct{})
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !known(name) {
+			return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownFacet, name, strings.Join(names, ", "))
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		facets = append(facets, name)
+	}
+	return facets, nil
+}
+
+// NewCounter counts the given facets and keeps the limit most common values of each
+func NewCounter(facets []string, limit int) *Counter {
+	counts := make(map[string]map[string]int, len(facets))
+	for _, name := range facets {
+		counts[name] = make(map[string]int)
+	}
+	return &Counter{facets: facets, limit: limit, counts: counts}
+}
+
+// Add counts a repository once in every facet, and once per language it uses
+func (c *Counter) Add(repo model.Repository) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, name := range c.facets {
+		for _, value := range values(name, repo) {
+			c.counts[name][value]++
+		}
+	}
+}
+
+// Results returns the most common values of each facet, ties are sorted by value
+func (c *Counter) Results() map[string]Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results := make(map[string]Result, len(c.facets))
+	for _, name := range c.facets {
+		buckets := make([]Bucket, 0, len(c.counts[name]))
+		for value, count := range c.counts[name] {
+			buckets = append(buckets, Bucket{Value: value, Count: count})
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			if buckets[i].Count != buckets[j].Count {
+				return buckets[i].Count > buckets[j].Count
+			}
+			return buckets[i].Value < buckets[j].Value
+		})
+
+		var result Result
+		if c.limit > 0 && len(buckets) > c.limit {
+			for _, bucket := range buckets[c.limit:] {
+				result.Other += bucket.Count
+			}
+			buckets = buckets[:c.limit]
+		}
+		result.Buckets = buckets
+		results[name] = result
+	}
+	return results
+}
+
+func values(name string, repo model.Repository) []string {
+	switch name {
+	case Language:
+		languages := make([]string, 0, len(repo.Languages))
+		for language := range repo.Languages {
+			languages = append(languages, language)
+		}
+		return languages
+	case OwnerType:
+		if repo.OwnerType == "" {
+			return []string{unknown}
+		}
+		return []string{repo.OwnerType}
+	case Fork:
+		return []string{strconv.FormatBool(repo.Fork)}
+	}
+	return nil
+}
+
+func known(name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
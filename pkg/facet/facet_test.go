@@ -0,0 +1,63 @@
+package facet_test
+
+import (
+	"testing"
+
+	"github.com/laouji/git-repo-searcher/pkg/facet"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/stretchr/testify/suite"
+)
+
+type facetTestSuite struct {
+	suite.Suite
+}
+
+func TestFacet(t *testing.T) {
+	suite.Run(t, new(facetTestSuite))
+}
+
+func (s *facetTestSuite) TestParse() {
+	facets, err := facet.Parse(" Language,fork,language,")
+	s.Require().NoError(err)
+	s.Equal([]string{facet.Language, facet.Fork}, facets)
+
+	facets, err = facet.Parse("")
+	s.Require().NoError(err)
+	s.Empty(facets)
+
+	_, err = facet.Parse("language,stars")
+	s.ErrorIs(err, facet.ErrUnknownFacet)
+}
+
+func (s *facetTestSuite) TestCounter() {
+	counter := facet.NewCounter([]string{facet.Language, facet.OwnerType, facet.Fork}, 2)
+	for _, repo := range []model.Repository{
+		{OwnerType: model.OwnerTypeUser, Languages: map[string]model.Language{"go": {}, "shell": {}}},
+		{OwnerType: model.OwnerTypeOrganization, Languages: map[string]model.Language{"go": {}, "c": {}}},
+		{OwnerType: model.OwnerTypeUser, Fork: true, Languages: map[string]model.Language{"rust": {}}},
+		{Languages: map[string]model.Language{"go": {}}},
+	} {
+		counter.Add(repo)
+	}
+
+	results := counter.Results()
+	s.Require().Len(results, 3)
+
+	// c, rust and shell are tied, the first one alphabetically makes the cut
+	s.Equal(facet.Result{
+		Buckets: []facet.Bucket{{Value: "go", Count: 3}, {Value: "c", Count: 1}},
+		Other:   2,
+	}, results[facet.Language])
+	s.Equal(facet.Result{
+		Buckets: []facet.Bucket{{Value: "user", Count: 2}, {Value: "organization", Count: 1}},
+		Other:   1,
+	}, results[facet.OwnerType])
+	s.Equal(facet.Result{
+		Buckets: []facet.Bucket{{Value: "false", Count: 3}, {Value: "true", Count: 1}},
+	}, results[facet.Fork])
+}
+
+func (s *facetTestSuite) TestCounter_Empty() {
+	results := facet.NewCounter([]string{facet.Language}, 10).Results()
+	s.Equal(facet.Result{Buckets: []facet.Bucket{}}, results[facet.Language])
+}
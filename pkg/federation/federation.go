@@ -0,0 +1,187 @@
+package federation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
+	"github.com/laouji/git-repo-searcher/pkg/searcher"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/laouji/git-repo-searcher/pkg/subrequester"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrUnknownProvider is returned when a search names a forge which isn't configured
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// Source reports how a single forge fared during a federated search
+type Source struct {
+	Provider string `json:"provider"`
+	Count    int    `json:"count"`
+	Duration int64  `json:"duration_ms"`
+	Error    string `json:"error,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// Searcher queries several forges concurrently and merges their results,
+// so that a slow or failing forge only leaves a gap instead of failing the whole search
+type Searcher struct {
+	forges      []forge.Forge
+	workerCount int
+	// timeout bounds the time spent on each forge, zero means the request's own deadline applies
+	timeout time.Duration
+	// index records every repository found, it is optional
+	index store.Store
+	// flights shares the searches of a forge with the identical ones in progress, it is optional
+	flights *Flights
+	logger  logrus.FieldLogger
+}
+
+func NewSearcher(
+	forges []forge.Forge,
+	workerCount int,
+	timeout time.Duration,
+	index store.Store,
+	logger logrus.FieldLogger,
+) *Searcher {
+	return &Searcher{
+		forges:      forges,
+		workerCount: workerCount,
+		timeout:     timeout,
+		index:       index,
+		logger:      logger,
+	}
+}
+
+// Coalesce makes the searches share their work with the identical ones already in progress
+func (s *Searcher) Coalesce(flights *Flights) *Searcher {
+	s.flights = flights
+	return s
+}
+
+// Search applies the same filters on every forge and returns the repositories newest first,
+// along with the outcome of each forge in the order they were given. The observers are handed
+// each repository as it is found, so that aggregates can be computed without another pass.
+// When coalescing, the search of a forge already in progress with the same filters is joined
+func (s *Searcher) Search(
+	ctx context.Context,
+	filters map[string]string,
+	observers ...func(model.Repository),
+) (out []model.Repository, sources []Source) {
+	sources = s.stream(ctx, filters, s.flights != nil, func(repo model.Repository) {
+		out = append(out, repo)
+		for _, observe := range observers {
+			observe(repo)
+		}
+	})
+	sortNewestFirst(out)
+	return out, sources
+}
+
+// Stream applies the same filters on every forge and hands each repository to emit as soon as
+// it is found, in no particular order. emit is only ever called from one goroutine at a time.
+// Once every forge is done it returns their outcome in the order they were given
+func (s *Searcher) Stream(ctx context.Context, filters map[string]string, emit func(model.Repository)) (sources []Source) {
+	return s.stream(ctx, filters, false, emit)
+}
+
+func (s *Searcher) stream(ctx context.Context, filters map[string]string, coalesce bool, emit func(model.Repository)) (sources []Source) {
+	sources = make([]Source, len(s.forges))
+
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i, f := range s.forges {
+		wg.Add(1)
+		go func(i int, f forge.Forge) {
+			defer wg.Done()
+			start := time.Now()
+			collect := func(ctx context.Context, emit func(model.Repository)) error {
+				return s.searchOne(ctx, f, filters, func(repo model.Repository) {
+					if s.index != nil {
+						s.index.Upsert(repo)
+						// the index keeps the first estimate of the creation time, so that it doesn't change between searches
+						if record, ok := s.index.Get(repo.Provider, repo.ID); ok {
+							repo.CreatedAt, repo.CreatedAtEstimated = record.CreatedAt, record.CreatedAtEstimated
+						}
+					}
+					emit(repo)
+				})
+			}
+			found := func(repo model.Repository) {
+				mu.Lock()
+				defer mu.Unlock()
+				sources[i].Count++
+				emit(repo)
+			}
+
+			if coalesce {
+				var shared bool
+				shared, sources[i].Err = s.flights.Do(ctx, flightKey(f.Name(), filters), collect, found)
+				if shared {
+					s.logger.WithField("provider", f.Name()).Debug("Joined an identical search in progress")
+				}
+				// the error of a caller which gave up names the forge like the others
+				if err := ctx.Err(); err != nil && sources[i].Err == err {
+					sources[i].Err = fmt.Errorf("failed to search %s: %w", f.Name(), sources[i].Err)
+				}
+			} else {
+				sources[i].Err = collect(ctx, found)
+			}
+
+			sources[i].Provider = f.Name()
+			sources[i].Duration = time.Since(start).Milliseconds()
+			if sources[i].Err != nil {
+				sources[i].Error = sources[i].Err.Error()
+				s.logger.WithError(sources[i].Err).WithField("provider", f.Name()).Warn("Forge search failed")
+			}
+		}(i, f)
+	}
+	wg.Wait()
+	return sources
+}
+
+// AllFailed returns the first source error if none of the sources succeeded
+func AllFailed(sources []Source) error {
+	for _, source := range sources {
+		if source.Err == nil {
+			return nil
+		}
+	}
+	return sources[0].Err
+}
+
+// searchOne emits whatever a forge returned before it failed, it is up to the caller
+// to decide whether partial results are worth showing
+func (s *Searcher) searchOne(ctx context.Context, f forge.Forge, filters map[string]string, emit func(model.Repository)) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	projects, err := searcher.NewSearcher(f).Search(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to search %s: %w", f.Name(), err)
+	}
+
+	logger := s.logger.WithField("provider", f.Name())
+	err = subrequester.NewSubRequester(s.workerCount, f, logger).Stream(ctx, projects, filters, emit)
+	if err != nil {
+		return fmt.Errorf("failed to collect languages from %s: %w", f.Name(), err)
+	}
+	return nil
+}
+
+// sortNewestFirst orders by creation time, ties are broken by provider then ID so the order is stable
+func sortNewestFirst(repos []model.Repository) {
+	sort.SliceStable(repos, func(i, j int) bool {
+		return ranking.NewestFirst(repos[i], repos[j])
+	})
+}
@@ -0,0 +1,172 @@
+package federation_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type federationTestSuite struct {
+	suite.Suite
+	now time.Time
+}
+
+func TestFederation(t *testing.T) {
+	suite.Run(t, new(federationTestSuite))
+}
+
+func (s *federationTestSuite) SetupTest() {
+	s.now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+}
+
+func (s *federationTestSuite) TestSearch_MergesByCreationTime() {
+	github := &forgetest.Stub{
+		Provider: "github",
+		Projects: []forge.Project{
+			{ID: 1, FullName: "a/old", CreatedAt: s.now.Add(-3 * time.Minute)},
+			{ID: 2, FullName: "a/new", CreatedAt: s.now},
+		},
+		Languages: map[string]model.Language{"Go": {Percent: 100}},
+	}
+	gitlab := &forgetest.Stub{
+		Provider: "gitlab",
+		Projects: []forge.Project{
+			{ID: 7, FullName: "b/middle", CreatedAt: s.now.Add(-time.Minute)},
+			{ID: 8, FullName: "b/tied", CreatedAt: s.now},
+		},
+		Languages: map[string]model.Language{"Go": {Percent: 100}},
+	}
+
+	searcher := federation.NewSearcher([]forge.Forge{gitlab, github}, 2, time.Second, nil, logger.Default())
+	repos, sources := searcher.Search(context.Background(), map[string]string{})
+
+	s.Require().Len(sources, 2)
+	s.Equal("gitlab", sources[0].Provider)
+	s.Equal(2, sources[0].Count)
+	s.NoError(sources[1].Err)
+
+	names := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		names = append(names, repo.FullName)
+	}
+	s.Equal([]string{"a/new", "b/tied", "b/middle", "a/old"}, names)
+}
+
+func (s *federationTestSuite) TestSearch_IndexesResults() {
+	github := &forgetest.Stub{
+		Provider:  "github",
+		Projects:  []forge.Project{{ID: 1, FullName: "a/repo", CreatedAt: s.now}},
+		Languages: map[string]model.Language{"Go": {Percent: 100}},
+	}
+	index := store.NewMemory()
+
+	searcher := federation.NewSearcher([]forge.Forge{github}, 2, time.Second, index, logger.Default())
+	searcher.Search(context.Background(), map[string]string{})
+
+	record, ok := index.Get("github", 1)
+	s.Require().True(ok)
+	s.Equal("a/repo", record.FullName)
+}
+
+func (s *federationTestSuite) TestSearch_KeepsTheFirstEstimatedCreationTime() {
+	github := &forgetest.Stub{
+		Provider:  "github",
+		Projects:  []forge.Project{{ID: 1, FullName: "a/repo", CreatedAt: s.now, CreatedAtEstimated: true}},
+		Languages: map[string]model.Language{"Go": {Percent: 100}},
+	}
+	index := store.NewMemory()
+	searcher := federation.NewSearcher([]forge.Forge{github}, 2, time.Second, index, logger.Default())
+	repos, _ := searcher.Search(context.Background(), map[string]string{})
+	s.Require().Len(repos, 1)
+	s.Equal(s.now, repos[0].CreatedAt)
+
+	// the next search estimates another time, the first one is kept
+	github.Projects[0].CreatedAt = s.now.Add(time.Minute)
+	repos, _ = searcher.Search(context.Background(), map[string]string{})
+	s.Require().Len(repos, 1)
+	s.Equal(s.now, repos[0].CreatedAt)
+	s.True(repos[0].CreatedAtEstimated)
+
+	// until the exact time is known
+	exact := s.now.Add(-time.Minute)
+	github.Projects[0].CreatedAt, github.Projects[0].CreatedAtEstimated = exact, false
+	repos, _ = searcher.Search(context.Background(), map[string]string{})
+	s.Require().Len(repos, 1)
+	s.Equal(exact, repos[0].CreatedAt)
+	s.False(repos[0].CreatedAtEstimated)
+
+	github.Projects[0].CreatedAt, github.Projects[0].CreatedAtEstimated = s.now, true
+	repos, _ = searcher.Search(context.Background(), map[string]string{})
+	s.Require().Len(repos, 1)
+	s.Equal(exact, repos[0].CreatedAt)
+}
+
+func (s *federationTestSuite) TestSearch_AppliesFiltersToEverySource() {
+	github := &forgetest.Stub{
+		Provider:  "github",
+		Projects:  []forge.Project{{ID: 1, FullName: "a/ruby", CreatedAt: s.now}},
+		Languages: map[string]model.Language{"Ruby": {Percent: 100}},
+	}
+	gitlab := &forgetest.Stub{
+		Provider:  "gitlab",
+		Projects:  []forge.Project{{ID: 1, FullName: "b/go", CreatedAt: s.now}},
+		Languages: map[string]model.Language{"Go": {Percent: 100}},
+	}
+
+	searcher := federation.NewSearcher([]forge.Forge{github, gitlab}, 2, time.Second, nil, logger.Default())
+	repos, _ := searcher.Search(context.Background(), map[string]string{"language": "go"})
+
+	s.Require().Len(repos, 1)
+	s.Equal("b/go", repos[0].FullName)
+	s.Equal("gitlab", repos[0].Provider)
+}
+
+func (s *federationTestSuite) TestSearch_ReportsEachSourceFailure() {
+	healthy := &forgetest.Stub{
+		Provider:  "github",
+		Projects:  []forge.Project{{ID: 1, FullName: "a/repo", CreatedAt: s.now}},
+		Languages: map[string]model.Language{},
+	}
+	failing := &forgetest.Stub{Provider: "gitlab", Err: forge.ErrRateLimit}
+	slow := &forgetest.Stub{Provider: "gitea", Delay: time.Minute}
+
+	searcher := federation.NewSearcher([]forge.Forge{healthy, failing, slow}, 2, 50*time.Millisecond, nil, logger.Default())
+	repos, sources := searcher.Search(context.Background(), map[string]string{})
+
+	s.Require().Len(repos, 1)
+	s.Require().Len(sources, 3)
+	s.NoError(sources[0].Err)
+	s.ErrorIs(sources[1].Err, forge.ErrRateLimit)
+	s.NotEmpty(sources[1].Error)
+	s.True(errors.Is(sources[2].Err, context.DeadlineExceeded))
+}
+
+func (s *federationTestSuite) TestStream_EmitsEveryRepository() {
+	github := &forgetest.Stub{
+		Provider:  "github",
+		Projects:  []forge.Project{{ID: 1, FullName: "a/one", CreatedAt: s.now}, {ID: 2, FullName: "a/two", CreatedAt: s.now}},
+		Languages: map[string]model.Language{"Go": {Percent: 100}},
+	}
+	failing := &forgetest.Stub{Provider: "gitlab", Err: forge.ErrRateLimit}
+
+	searcher := federation.NewSearcher([]forge.Forge{github, failing}, 2, time.Second, nil, logger.Default())
+	var names []string
+	sources := searcher.Stream(context.Background(), map[string]string{}, func(repo model.Repository) {
+		names = append(names, repo.FullName)
+	})
+
+	s.ElementsMatch([]string{"a/one", "a/two"}, names)
+	s.Require().Len(sources, 2)
+	s.Equal(2, sources[0].Count)
+	s.ErrorIs(federation.AllFailed(sources[1:]), forge.ErrRateLimit)
+	s.NoError(federation.AllFailed(sources))
+}
@@ -0,0 +1,141 @@
+package federation
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+// Flights lets identical searches of a forge which run at the same time share a single
+// execution, so that a burst of the same request only costs the forge one search
+type Flights struct {
+	mu    sync.Mutex
+	calls map[string]*flight
+}
+
+// flight is a search of a forge in progress, with the callers waiting for it
+type flight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	// meter counts the calls the run makes upstream, they are charged to every caller
+	meter *apikey.Meter
+
+	repos []model.Repository
+	err   error
+}
+
+func NewFlights() *Flights {
+	return &Flights{calls: make(map[string]*flight)}
+}
+
+// Do hands emit the repositories found by run, unless a run with the same key is already in
+// progress in which case its repositories are handed once it is over. The run is detached from
+// the context of the caller which started it, so a caller giving up only stops waiting while
+// the others still get the results. The run is cancelled once every caller gave up. The calls
+// the run makes upstream are charged to the API key of each caller, as if it had run it by itself,
+// a caller giving up is only charged the calls made until then
+func (f *Flights) Do(
+	ctx context.Context,
+	key string,
+	run func(ctx context.Context, emit func(model.Repository)) error,
+	emit func(model.Repository),
+) (shared bool, err error) {
+	f.mu.Lock()
+	c, shared := f.calls[key]
+	if !shared {
+		meter := &apikey.Meter{}
+		detached, cancel := context.WithCancel(apikey.WithMeter(context.WithoutCancel(ctx), meter))
+		c = &flight{done: make(chan struct{}), cancel: cancel, meter: meter}
+		f.calls[key] = c
+
+		go func() {
+			// emit is only called from one goroutine at a time and the results
+			// are only read once done is closed
+			c.err = run(detached, func(repo model.Repository) {
+				c.repos = append(c.repos, repo)
+			})
+			cancel()
+			f.forget(key, c)
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	f.mu.Unlock()
+
+	select {
+	case <-c.done:
+		charge(ctx, c.meter.Calls())
+		for _, repo := range c.repos {
+			emit(repo)
+		}
+		return shared, c.err
+	case <-ctx.Done():
+		charge(ctx, c.meter.Calls())
+		f.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// nobody is left to hand the results to, later callers start afresh
+			c.cancel()
+			f.forgetLocked(key, c)
+		}
+		f.mu.Unlock()
+		return shared, ctx.Err()
+	}
+}
+
+// charge counts the calls of a run against the API key of a caller, when the caller has one
+func charge(ctx context.Context, calls int) {
+	if client, ok := apikey.FromContext(ctx); ok && calls > 0 {
+		client.Consume(calls)
+	}
+}
+
+func (f *Flights) forget(key string, c *flight) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.forgetLocked(key, c)
+}
+
+func (f *Flights) forgetLocked(key string, c *flight) {
+	if f.calls[key] == c {
+		delete(f.calls, key)
+	}
+}
+
+// flightKey identifies the search of a forge, the filters are normalized so that
+// language=Go,rust and language=rust,go share the same search
+func flightKey(provider string, filters map[string]string) string {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := []string{provider}
+	for _, key := range keys {
+		values := strings.Split(strings.ToLower(filters[key]), ",")
+		for i := range values {
+			values[i] = strings.TrimSpace(values[i])
+		}
+		sort.Strings(values)
+		parts = append(parts, key+"="+strings.Join(unique(values), ","))
+	}
+	return strings.Join(parts, "&")
+}
+
+// unique drops the repeated values of a sorted slice
+func unique(values []string) []string {
+	out := values[:0]
+	for i, value := range values {
+		if i > 0 && value == values[i-1] {
+			continue
+		}
+		out = append(out, value)
+	}
+	return out
+}
@@ -0,0 +1,222 @@
+package federation_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+// gatedForge holds every search until it is released, and counts the searches which reached it
+type gatedForge struct {
+	forgetest.Stub
+	release  chan struct{}
+	searches atomic.Int32
+	// cancelled is closed when a search gave up before being released
+	cancelled chan struct{}
+}
+
+func newGatedForge(now time.Time) *gatedForge {
+	return &gatedForge{
+		Stub: forgetest.Stub{
+			Provider: "github",
+			Projects: []forge.Project{
+				{ID: 1, FullName: "a/old", CreatedAt: now.Add(-time.Minute)},
+				{ID: 2, FullName: "a/new", CreatedAt: now},
+			},
+			Languages: map[string]model.Language{"go": {Percent: 100}},
+		},
+		release:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+}
+
+func (f *gatedForge) NewestProjectID(ctx context.Context) (int64, error) {
+	f.searches.Add(1)
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		close(f.cancelled)
+		return 0, ctx.Err()
+	}
+	return f.Stub.NewestProjectID(ctx)
+}
+
+// callingForge makes calls upstream through a metered client once its searches are released
+type callingForge struct {
+	*gatedForge
+	upstream *http.Client
+	calls    int
+}
+
+func (f *callingForge) NewestProjectID(ctx context.Context) (int64, error) {
+	ID, err := f.gatedForge.NewestProjectID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < f.calls; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://upstream.invalid/", nil)
+		if err != nil {
+			return 0, err
+		}
+		res, err := f.upstream.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		res.Body.Close()
+	}
+	return ID, nil
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+type result struct {
+	repos   []model.Repository
+	sources []federation.Source
+}
+
+// search starts a search in the background, its result is sent once it is over
+func (s *federationTestSuite) search(ctx context.Context, f forge.Forge, flights *federation.Flights, filters map[string]string) <-chan result {
+	out := make(chan result, 1)
+	go func() {
+		searcher := federation.NewSearcher([]forge.Forge{f}, 2, time.Second, nil, logger.Default()).Coalesce(flights)
+		repos, sources := searcher.Search(ctx, filters)
+		out <- result{repos: repos, sources: sources}
+	}()
+	return out
+}
+
+func (s *federationTestSuite) TestCoalesce_SharesIdenticalSearches() {
+	f := newGatedForge(s.now)
+	flights := federation.NewFlights()
+
+	var results []<-chan result
+	for _, language := range []string{"go", "Go", "go,GO", "go, go"} {
+		results = append(results, s.search(context.Background(), f, flights, map[string]string{"language": language}))
+	}
+	s.Eventually(func() bool { return f.searches.Load() == 1 }, time.Second, time.Millisecond)
+	// give the other searches the time to join the first one
+	time.Sleep(50 * time.Millisecond)
+	close(f.release)
+
+	for _, res := range results {
+		r := <-res
+		s.Require().Len(r.repos, 2)
+		s.Equal("a/new", r.repos[0].FullName)
+		s.Equal(2, r.sources[0].Count)
+		s.NoError(r.sources[0].Err)
+	}
+	s.Equal(int32(1), f.searches.Load())
+
+	// the search is over, the next one starts afresh
+	r := <-s.search(context.Background(), f, flights, map[string]string{"language": "go"})
+	s.Len(r.repos, 2)
+	s.Equal(int32(2), f.searches.Load())
+}
+
+func (s *federationTestSuite) TestCoalesce_KeepsDifferentSearchesApart() {
+	f := newGatedForge(s.now)
+	flights := federation.NewFlights()
+
+	first := s.search(context.Background(), f, flights, map[string]string{"language": "go"})
+	second := s.search(context.Background(), f, flights, map[string]string{"language": "rust"})
+	s.Eventually(func() bool { return f.searches.Load() == 2 }, time.Second, time.Millisecond)
+	close(f.release)
+
+	s.Len((<-first).repos, 2)
+	s.Empty((<-second).repos)
+}
+
+func (s *federationTestSuite) TestCoalesce_CancellationOnlyDetachesTheCaller() {
+	f := newGatedForge(s.now)
+	flights := federation.NewFlights()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leaving := s.search(ctx, f, flights, map[string]string{})
+	s.Eventually(func() bool { return f.searches.Load() == 1 }, time.Second, time.Millisecond)
+	staying := s.search(context.Background(), f, flights, map[string]string{})
+	time.Sleep(50 * time.Millisecond)
+
+	// the caller which started the search leaves, the search goes on for the other one
+	cancel()
+	left := <-leaving
+	s.ErrorIs(left.sources[0].Err, context.Canceled)
+	s.Empty(left.repos)
+
+	close(f.release)
+	stayed := <-staying
+	s.NoError(stayed.sources[0].Err)
+	s.Len(stayed.repos, 2)
+	s.Equal(int32(1), f.searches.Load())
+}
+
+func (s *federationTestSuite) TestCoalesce_CancelsOnceEveryCallerLeft() {
+	f := newGatedForge(s.now)
+	flights := federation.NewFlights()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		res := s.search(ctx, f, flights, map[string]string{})
+		go func() {
+			defer wg.Done()
+			<-res
+		}()
+	}
+	s.Eventually(func() bool { return f.searches.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	select {
+	case <-f.cancelled:
+	case <-time.After(time.Second):
+		s.Fail("the search nobody waits for anymore wasn't cancelled")
+	}
+}
+
+func (s *federationTestSuite) TestCoalesce_ChargesEveryCaller() {
+	keyring, err := apikey.NewKeyring([]apikey.Key{
+		{Name: "first", Secret: "first"},
+		{Name: "second", Secret: "second"},
+	}, apikey.Limits{Quota: 100, Window: time.Hour})
+	s.Require().NoError(err)
+	first, err := keyring.Lookup("first")
+	s.Require().NoError(err)
+	second, err := keyring.Lookup("second")
+	s.Require().NoError(err)
+
+	upstream := &http.Client{Transport: apikey.Metered(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+	}))}
+	f := &callingForge{gatedForge: newGatedForge(s.now), upstream: upstream, calls: 3}
+	flights := federation.NewFlights()
+
+	started := s.search(apikey.WithClient(context.Background(), first), f, flights, map[string]string{})
+	s.Eventually(func() bool { return f.searches.Load() == 1 }, time.Second, time.Millisecond)
+	joined := s.search(apikey.WithClient(context.Background(), second), f, flights, map[string]string{})
+	time.Sleep(50 * time.Millisecond)
+	close(f.release)
+
+	s.Len((<-started).repos, 2)
+	s.Len((<-joined).repos, 2)
+	s.Equal(int32(1), f.searches.Load())
+	// the search ran once but each key is charged what it would have cost by itself
+	s.Equal(3, first.Usage().Used)
+	s.Equal(3, second.Usage().Used)
+}
@@ -0,0 +1,245 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+// Feed is the format-neutral content of an Atom or RSS feed
+type Feed struct {
+	ID       string
+	Title    string
+	SelfLink string
+	Entries  []Entry
+}
+
+type Entry struct {
+	ID         string
+	Title      string
+	Link       string
+	Author     string
+	Content    string
+	Categories []string
+	Published  time.Time
+	Updated    time.Time
+}
+
+// Updated is the time of the most recent entry, so that the feed only
+// looks updated to readers when it actually has something new
+func (f Feed) Updated() time.Time {
+	var updated time.Time
+	for _, entry := range f.Entries {
+		if entry.Updated.After(updated) {
+			updated = entry.Updated
+		}
+	}
+	if updated.IsZero() {
+		return time.Now().UTC()
+	}
+	return updated
+}
+
+// EntryID derives a tag URI from the forge's repository ID, which unlike the name survives
+// renames and transfers. Github repositories get the IDs github uses in its own feeds
+func EntryID(repo model.Repository) string {
+	authority := repo.Provider
+	if u, err := url.Parse(repo.HTMLURL); err == nil && u.Host != "" {
+		authority = u.Hostname()
+	}
+	return fmt.Sprintf("tag:%s,2008:Repository/%d", authority, repo.ID)
+}
+
+// NewEntry describes the repository, seenAt stands in for the creation time when the forge
+// didn't report it or only estimated it, since an estimate may differ from one search to the next
+func NewEntry(repo model.Repository, seenAt time.Time) Entry {
+	published := repo.CreatedAt
+	if published.IsZero() || repo.CreatedAtEstimated {
+		published = seenAt
+	}
+
+	languages := make([]string, 0, len(repo.Languages))
+	for language := range repo.Languages {
+		languages = append(languages, language)
+	}
+	sort.Slice(languages, func(i, j int) bool {
+		a, b := repo.Languages[languages[i]], repo.Languages[languages[j]]
+		if a.Percent != b.Percent {
+			return a.Percent > b.Percent
+		}
+		return languages[i] < languages[j]
+	})
+
+	return Entry{
+		ID:         EntryID(repo),
+		Title:      repo.FullName,
+		Link:       repo.HTMLURL,
+		Author:     repo.Owner,
+		Content:    content(repo, languages),
+		Categories: languages,
+		Published:  published.UTC(),
+		Updated:    published.UTC(),
+	}
+}
+
+func content(repo model.Repository, languages []string) string {
+	var b strings.Builder
+	if repo.Description != "" {
+		fmt.Fprintf(&b, "<p>%s</p>", html.EscapeString(repo.Description))
+	}
+	fmt.Fprintf(&b, "<p>Owner: %s</p>", html.EscapeString(repo.Owner))
+	if len(languages) > 0 {
+		b.WriteString("<ul>")
+		for _, language := range languages {
+			fmt.Fprintf(&b, "<li>%s: %.1f%%</li>", html.EscapeString(language), repo.Languages[language].Percent)
+		}
+		b.WriteString("</ul>")
+	}
+	if repo.HTMLURL != "" {
+		fmt.Fprintf(&b, `<p><a href="%s">%s</a></p>`, html.EscapeString(repo.HTMLURL), html.EscapeString(repo.HTMLURL))
+	}
+	return b.String()
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Link       *atomLink      `xml:"link,omitempty"`
+	Author     string         `xml:"author>name"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomText       `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+// WriteAtom renders the feed as Atom 1.0 https://www.rfc-editor.org/rfc/rfc4287
+func WriteAtom(w io.Writer, f Feed) error {
+	out := atomFeed{
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: f.Updated().Format(time.RFC3339),
+		Link:    atomLink{Rel: "self", Href: f.SelfLink},
+		Entries: make([]atomEntry, 0, len(f.Entries)),
+	}
+	for _, entry := range f.Entries {
+		atom := atomEntry{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Updated:   entry.Updated.Format(time.RFC3339),
+			Published: entry.Published.Format(time.RFC3339),
+			Author:    entry.Author,
+			Content:   atomText{Type: "html", Body: entry.Content},
+		}
+		if entry.Link != "" {
+			atom.Link = &atomLink{Rel: "alternate", Href: entry.Link}
+		}
+		for _, category := range entry.Categories {
+			atom.Categories = append(atom.Categories, atomCategory{Term: category})
+		}
+		out.Entries = append(out.Entries, atom)
+	}
+	return write(w, out)
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link,omitempty"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creator     string   `xml:"dc:creator"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssFeed struct {
+	XMLName  xml.Name   `xml:"rss"`
+	Version  string     `xml:"version,attr"`
+	AtomNS   string     `xml:"xmlns:atom,attr"`
+	DublinNS string     `xml:"xmlns:dc,attr"`
+	Channel  rssChannel `xml:"channel"`
+}
+
+// WriteRSS renders the feed as RSS 2.0 https://www.rssboard.org/rss-specification
+func WriteRSS(w io.Writer, f Feed) error {
+	out := rssFeed{
+		Version:  "2.0",
+		AtomNS:   "http://www.w3.org/2005/Atom",
+		DublinNS: "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.SelfLink,
+			Description:   f.Title,
+			LastBuildDate: f.Updated().Format(time.RFC1123Z),
+			SelfLink:      atomLink{Rel: "self", Href: f.SelfLink},
+			Items:         make([]rssItem, 0, len(f.Entries)),
+		},
+	}
+	for _, entry := range f.Entries {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			GUID:        rssGUID{Value: entry.ID},
+			PubDate:     entry.Published.Format(time.RFC1123Z),
+			Creator:     entry.Author,
+			Categories:  entry.Categories,
+			Description: entry.Content,
+		})
+	}
+	return write(w, out)
+}
+
+func write(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("failed to write xml header: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode feed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package feed_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/feed"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/stretchr/testify/suite"
+)
+
+type feedTestSuite struct {
+	suite.Suite
+	created time.Time
+	feed    feed.Feed
+}
+
+func TestFeed(t *testing.T) {
+	suite.Run(t, new(feedTestSuite))
+}
+
+func (s *feedTestSuite) SetupTest() {
+	s.created = time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC)
+	repos := []model.Repository{
+		{
+			Provider:    "github",
+			ID:          795134961,
+			FullName:    "owner/fast<er>",
+			Owner:       "owner",
+			Description: "blazing & fast",
+			HTMLURL:     "https://github.com/owner/faster",
+			CreatedAt:   s.created,
+			Languages: map[string]model.Language{
+				"html": {Percent: 25},
+				"rust": {Percent: 75},
+			},
+		},
+		{
+			Provider: "gitlab",
+			ID:       57310263,
+			FullName: "group/repo",
+			Owner:    "group",
+			HTMLURL:  "https://gitlab.example.com/group/repo",
+		},
+	}
+	s.feed = feed.Feed{ID: "tag:localhost,2024:/repos/feed.atom?language=rust", Title: "New repositories", SelfLink: "http://localhost/repos/feed.atom?language=rust"}
+	for _, repo := range repos {
+		s.feed.Entries = append(s.feed.Entries, feed.NewEntry(repo, s.created.Add(-time.Hour)))
+	}
+}
+
+func (s *feedTestSuite) TestNewEntry() {
+	entry := s.feed.Entries[0]
+	s.Equal("tag:github.com,2008:Repository/795134961", entry.ID)
+	s.Equal([]string{"rust", "html"}, entry.Categories)
+	s.Equal(s.created, entry.Updated)
+	s.Equal(
+		`<p>blazing &amp; fast</p><p>Owner: owner</p><ul><li>rust: 75.0%</li><li>html: 25.0%</li></ul>`+
+			`<p><a href="https://github.com/owner/faster">https://github.com/owner/faster</a></p>`,
+		entry.Content,
+	)
+
+	// without a creation date the entry keeps the time the repository was first seen
+	s.Equal("tag:gitlab.example.com,2008:Repository/57310263", s.feed.Entries[1].ID)
+	s.Equal(s.created.Add(-time.Hour), s.feed.Entries[1].Updated)
+
+	// an estimated creation date isn't stable enough to date the entry
+	estimated := feed.NewEntry(model.Repository{Provider: "github", ID: 1, CreatedAt: s.created, CreatedAtEstimated: true}, s.created.Add(-time.Hour))
+	s.Equal(s.created.Add(-time.Hour), estimated.Published)
+	s.Equal(s.created.Add(-time.Hour), estimated.Updated)
+}
+
+func (s *feedTestSuite) TestWriteAtom() {
+	var buf bytes.Buffer
+	s.Require().NoError(feed.WriteAtom(&buf, s.feed))
+
+	var out struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			ID      string `xml:"id"`
+			Title   string `xml:"title"`
+			Updated string `xml:"updated"`
+			Author  string `xml:"author>name"`
+			Link    struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	s.Require().NoError(xml.Unmarshal(buf.Bytes(), &out))
+	s.Equal("2024-05-02T17:41:07Z", out.Updated)
+	s.Require().Len(out.Entries, 2)
+	s.Equal("tag:github.com,2008:Repository/795134961", out.Entries[0].ID)
+	s.Equal("owner/fast<er>", out.Entries[0].Title)
+	s.Equal("2024-05-02T17:41:07Z", out.Entries[0].Updated)
+	s.Equal("owner", out.Entries[0].Author)
+	s.Equal("https://github.com/owner/faster", out.Entries[0].Link.Href)
+	s.Contains(out.Entries[0].Content, "<li>rust: 75.0%</li>")
+}
+
+func (s *feedTestSuite) TestWriteRSS() {
+	var buf bytes.Buffer
+	s.Require().NoError(feed.WriteRSS(&buf, s.feed))
+	s.Contains(buf.String(), `<atom:link rel="self" href="http://localhost/repos/feed.atom?language=rust"></atom:link>`)
+
+	var out struct {
+		Channel struct {
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				GUID       string   `xml:"guid"`
+				PubDate    string   `xml:"pubDate"`
+				Categories []string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	s.Require().NoError(xml.Unmarshal(buf.Bytes(), &out))
+	s.Equal("Thu, 02 May 2024 17:41:07 +0000", out.Channel.LastBuildDate)
+	s.Require().Len(out.Channel.Items, 2)
+	s.Equal("tag:github.com,2008:Repository/795134961", out.Channel.Items[0].GUID)
+	s.Equal("Thu, 02 May 2024 17:41:07 +0000", out.Channel.Items[0].PubDate)
+	s.Equal([]string{"rust", "html"}, out.Channel.Items[0].Categories)
+}
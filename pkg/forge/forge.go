@@ -0,0 +1,83 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+var (
+	ErrAuthentication = errors.New("forge rejected the credentials")
+	ErrRateLimit      = errors.New("forge rate limit reached")
+)
+
+// Forge is a code hosting service on which the searcher can discover recently created projects
+type Forge interface {
+	// Name identifies the forge in the provider query parameter
+	Name() string
+	// NewestProjectID finds the ID of the most recently created project
+	NewestProjectID(ctx context.Context) (ID int64, err error)
+	// ListProjects lists at most limit projects with IDs higher than since
+	ListProjects(ctx context.Context, since int64, limit int) (projects []Project, err error)
+	// FetchLanguages returns the languages used by the project keyed by language name
+	FetchLanguages(ctx context.Context, project Project) (languages map[string]model.Language, err error)
+}
+
+// Project is the provider-neutral description of a repository hosted on a forge
+type Project struct {
+	ID       int64
+	Name     string
+	FullName string
+	Owner    string
+	// OwnerType is one of the model.OwnerType constants, or empty when the forge doesn't tell
+	OwnerType   string
+	Description string
+	HTMLURL     string
+	CreatedAt   time.Time
+	// CreatedAtEstimated is set when the forge doesn't tell the creation time, which was guessed
+	CreatedAtEstimated bool
+	Fork               bool
+	// LanguagesURL is where the forge exposes the language breakdown, when it links to it directly
+	LanguagesURL string
+
+	// the following are only set by forges which fetch them along with the listing
+	Stars     int
+	License   string
+	Topics    []string
+	Languages map[string]model.Language
+}
+
+type namedForge struct {
+	Forge
+	name string
+}
+
+// Named lets several instances of the same kind of forge be configured side by side,
+// e.g. github.com and a GitHub Enterprise Server
+func Named(f Forge, name string) Forge {
+	return &namedForge{Forge: f, name: name}
+}
+
+func (n *namedForge) Name() string {
+	return n.name
+}
+
+// languagesFromBytes works out the share of each language for forges which report byte counts
+func languagesFromBytes(attrs map[string]int64) map[string]model.Language {
+	var total int64
+	for _, bytes := range attrs {
+		total += bytes
+	}
+
+	languages := make(map[string]model.Language, len(attrs))
+	for name, bytes := range attrs {
+		language := model.Language{Bytes: bytes}
+		if total > 0 {
+			language.Percent = float64(bytes) * 100 / float64(total)
+		}
+		languages[name] = language
+	}
+	return languages
+}
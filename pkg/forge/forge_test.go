@@ -0,0 +1,230 @@
+package forge_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/gitea"
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	mock_github "github.com/laouji/git-repo-searcher/pkg/github/mocks"
+	"github.com/laouji/git-repo-searcher/pkg/gitlab"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+)
+
+type forgeTestSuite struct {
+	suite.Suite
+	ctrl       *gomock.Controller
+	clientMock *mock_github.MockClient
+}
+
+func TestForge(t *testing.T) {
+	suite.Run(t, new(forgeTestSuite))
+}
+
+func (s *forgeTestSuite) SetupTest() {
+	s.ctrl = gomock.NewController(s.T())
+	s.clientMock = mock_github.NewMockClient(s.ctrl)
+}
+
+func (s *forgeTestSuite) TestGitHub_NewestProjectIDLooksBackThroughPages() {
+	f := forge.NewGitHub(s.clientMock)
+	s.clientMock.EXPECT().ListPublicEvents(gomock.Any(), gomock.Any(), 0).Return([]github.Event{
+		{Type: "PushEvent", Repo: github.Repo{ID: 1}},
+		{Type: "CreateEvent", Repo: github.Repo{ID: 2}, Payload: github.Payload{RefType: "branch"}},
+	}, nil)
+	s.clientMock.EXPECT().ListPublicEvents(gomock.Any(), gomock.Any(), 1).Return([]github.Event{
+		{Type: "CreateEvent", Repo: github.Repo{ID: 3}, Payload: github.Payload{RefType: "repository"}},
+	}, nil)
+
+	ID, err := f.NewestProjectID(context.Background())
+	s.NoError(err)
+	s.Equal(int64(3), ID)
+}
+
+func (s *forgeTestSuite) TestGitHub_EstimatesCreationTimeFromEvents() {
+	f := forge.NewGitHub(s.clientMock)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s.clientMock.EXPECT().ListPublicEvents(gomock.Any(), gomock.Any(), 0).Return([]github.Event{
+		{Type: "CreateEvent", Repo: github.Repo{ID: 20}, Payload: github.Payload{RefType: "repository"}, CreatedAt: created},
+		{Type: "CreateEvent", Repo: github.Repo{ID: 12}, Payload: github.Payload{RefType: "repository"}, CreatedAt: created.Add(-time.Minute)},
+	}, nil)
+	s.clientMock.EXPECT().ListPublicRepos(gomock.Any(), int64(10)).Return([]github.Repository{{ID: 11}, {ID: 12}, {ID: 13}}, nil)
+
+	_, err := f.NewestProjectID(context.Background())
+	s.Require().NoError(err)
+	projects, err := f.ListProjects(context.Background(), 10, 100)
+	s.Require().NoError(err)
+	s.Require().Len(projects, 3)
+	s.Equal(created.Add(-time.Minute), projects[0].CreatedAt)
+	s.True(projects[0].CreatedAtEstimated)
+	// the creation event of the repository was seen
+	s.Equal(created.Add(-time.Minute), projects[1].CreatedAt)
+	s.False(projects[1].CreatedAtEstimated)
+	s.Equal(created, projects[2].CreatedAt)
+	s.True(projects[2].CreatedAtEstimated)
+}
+
+func (s *forgeTestSuite) TestGitHubGraphQL_EnrichesListedProjects() {
+	f := forge.NewGitHubGraphQL(s.clientMock)
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repos := []github.Repository{
+		{ID: 11, NodeID: "R_11", LanguagesURL: "http://url.com/11"},
+		{ID: 12, NodeID: "R_12", LanguagesURL: "http://url.com/12"},
+	}
+	s.clientMock.EXPECT().ListPublicRepos(gomock.Any(), int64(10)).Return(repos, nil)
+	s.clientMock.EXPECT().FetchRepoDetails(gomock.Any(), []string{"R_11", "R_12"}).Return(map[string]github.RepoDetails{
+		"R_11": {NodeID: "R_11", CreatedAt: created, Stars: 3, License: "MIT", Topics: []string{"cli"}, Languages: map[string]int64{"Go": 300, "Shell": 100}},
+	}, nil)
+
+	projects, err := f.ListProjects(context.Background(), 10, 100)
+	s.Require().NoError(err)
+	s.Require().Len(projects, 2)
+	s.Equal(created, projects[0].CreatedAt)
+	s.False(projects[0].CreatedAtEstimated)
+	s.Equal(3, projects[0].Stars)
+	s.Equal("MIT", projects[0].License)
+	s.Equal([]string{"cli"}, projects[0].Topics)
+
+	// enriched projects need no further request, the others fall back to REST
+	languages, err := f.FetchLanguages(context.Background(), projects[0])
+	s.Require().NoError(err)
+	s.Equal(75.0, languages["Go"].Percent)
+
+	s.clientMock.EXPECT().FetchAttribute(gomock.Any(), "http://url.com/12").Return(map[string]int64{"Ruby": 10}, nil)
+	languages, err = f.FetchLanguages(context.Background(), projects[1])
+	s.Require().NoError(err)
+	s.Equal(int64(10), languages["Ruby"].Bytes)
+}
+
+func (s *forgeTestSuite) TestGitHubGraphQL_TranslatesErrors() {
+	f := forge.NewGitHubGraphQL(s.clientMock)
+	s.clientMock.EXPECT().ListPublicRepos(gomock.Any(), int64(10)).Return([]github.Repository{{ID: 11, NodeID: "R_11"}}, nil)
+	s.clientMock.EXPECT().FetchRepoDetails(gomock.Any(), gomock.Any()).Return(nil, github.ErrRateLimit)
+
+	_, err := f.ListProjects(context.Background(), 10, 100)
+	s.ErrorIs(err, forge.ErrRateLimit)
+}
+
+func (s *forgeTestSuite) TestNamed() {
+	f := forge.Named(forge.NewGitHub(s.clientMock), "ghes")
+	s.Equal("ghes", f.Name())
+}
+
+func (s *forgeTestSuite) TestGitHub_TranslatesErrors() {
+	f := forge.NewGitHub(s.clientMock)
+	s.clientMock.EXPECT().ListPublicRepos(gomock.Any(), int64(10)).Return(nil, github.ErrRateLimit)
+
+	_, err := f.ListProjects(context.Background(), 10, 100)
+	s.ErrorIs(err, forge.ErrRateLimit)
+	s.ErrorIs(err, github.ErrRateLimit)
+}
+
+func (s *forgeTestSuite) TestGitHub_FetchLanguagesComputesShares() {
+	f := forge.NewGitHub(s.clientMock)
+	s.clientMock.EXPECT().FetchAttribute(gomock.Any(), "languages").Return(map[string]int64{
+		"Go":    300,
+		"Shell": 100,
+	}, nil)
+
+	languages, err := f.FetchLanguages(context.Background(), forge.Project{LanguagesURL: "languages"})
+	s.Require().NoError(err)
+	s.Equal(int64(300), languages["Go"].Bytes)
+	s.Equal(75.0, languages["Go"].Percent)
+}
+
+func (s *forgeTestSuite) TestGitLab() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/projects", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("sort") == "desc" {
+			w.Write([]byte(`[{"id":150}]`))
+			return
+		}
+		s.Equal("50", r.URL.Query().Get("id_after"))
+		w.Write([]byte(`[{"id":51,"path":"repo","path_with_namespace":"group/sub/repo","web_url":"https://gitlab.example.com/group/sub/repo","namespace":{"full_path":"group/sub","kind":"group"},"forked_from_project":{"id":12}}]`))
+	})
+	mux.HandleFunc("/projects/51/languages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Go": 100}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := forge.NewGitLab(gitlab.NewClient(&http.Client{Timeout: time.Second}, server.URL, ""))
+	ID, err := f.NewestProjectID(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(150), ID)
+
+	projects, err := f.ListProjects(context.Background(), ID-100, 100)
+	s.Require().NoError(err)
+	s.Require().Len(projects, 1)
+	s.Equal(forge.Project{
+		ID:        51,
+		Name:      "repo",
+		FullName:  "group/sub/repo",
+		Owner:     "group/sub",
+		OwnerType: model.OwnerTypeOrganization,
+		HTMLURL:   "https://gitlab.example.com/group/sub/repo",
+		Fork:      true,
+	}, projects[0])
+
+	languages, err := f.FetchLanguages(context.Background(), projects[0])
+	s.Require().NoError(err)
+	s.Equal(100.0, languages["Go"].Percent)
+}
+
+func (s *forgeTestSuite) TestGitLab_TranslatesErrors() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	f := forge.NewGitLab(gitlab.NewClient(&http.Client{Timeout: time.Second}, server.URL, "bad"))
+	_, err := f.NewestProjectID(context.Background())
+	s.True(errors.Is(err, forge.ErrAuthentication))
+}
+
+func (s *forgeTestSuite) TestGitea_ListProjectsPagesUntilSince() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/search", func(w http.ResponseWriter, r *http.Request) {
+		// 60 repos with IDs 100 down to 41, served 50 per page
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		if page == 0 {
+			page = 1
+		}
+		repos := []string{}
+		for ID := 100 - (page-1)*limit; ID > 100-page*limit && ID > 40; ID-- {
+			repos = append(repos, fmt.Sprintf(`{"id":%d,"name":"repo%d","full_name":"org/repo%d","owner":{"login":"org"}}`, ID, ID, ID))
+		}
+		w.Write([]byte(`{"ok":true,"data":[` + strings.Join(repos, ",") + `]}`))
+	})
+	mux.HandleFunc("/repos/org/repo100/languages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Go": 100, "HTML": 100}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	f := forge.NewGitea(gitea.NewClient(&http.Client{Timeout: time.Second}, server.URL, ""))
+	ID, err := f.NewestProjectID(context.Background())
+	s.Require().NoError(err)
+	s.Equal(int64(100), ID)
+
+	projects, err := f.ListProjects(context.Background(), 45, 100)
+	s.Require().NoError(err)
+	s.Require().Len(projects, 55)
+	s.Equal("org", projects[0].Owner)
+	s.Equal(int64(46), projects[54].ID)
+
+	languages, err := f.FetchLanguages(context.Background(), projects[0])
+	s.Require().NoError(err)
+	s.Equal(50.0, languages["Go"].Percent)
+}
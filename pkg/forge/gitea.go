@@ -0,0 +1,96 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/laouji/git-repo-searcher/pkg/gitea"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	ProviderGitea = "gitea"
+
+	// giteaPageSize is the default maximum number of items gitea returns per page
+	giteaPageSize = 50
+)
+
+type giteaForge struct {
+	client gitea.Client
+}
+
+// NewGitea works for Forgejo too since it exposes the same API
+func NewGitea(client gitea.Client) Forge {
+	return &giteaForge{client: client}
+}
+
+func (g *giteaForge) Name() string {
+	return ProviderGitea
+}
+
+func (g *giteaForge) NewestProjectID(ctx context.Context) (ID int64, err error) {
+	repos, err := g.client.SearchRepos(ctx, gitea.SearchOptions{Sort: "created", Order: "desc", Limit: 1})
+	if err != nil {
+		return ID, fmt.Errorf("failed to search newest repo: %w", translateGiteaErr(err))
+	}
+	if len(repos) == 0 {
+		return ID, fmt.Errorf("no repositories visible on gitea")
+	}
+	return repos[0].ID, nil
+}
+
+// ListProjects pages back through the newest repositories since the search API can't filter by ID
+func (g *giteaForge) ListProjects(ctx context.Context, since int64, limit int) (projects []Project, err error) {
+	projects = make([]Project, 0, limit)
+	for page := 1; len(projects) < limit; page++ {
+		repos, err := g.client.SearchRepos(ctx, gitea.SearchOptions{
+			Sort:  "created",
+			Order: "desc",
+			Page:  page,
+			Limit: giteaPageSize,
+		})
+		if err != nil {
+			return projects, translateGiteaErr(err)
+		}
+
+		for _, repo := range repos {
+			if repo.ID <= since || len(projects) == limit {
+				return projects, nil
+			}
+			projects = append(projects, Project{
+				ID:          repo.ID,
+				Name:        repo.Name,
+				FullName:    repo.FullName,
+				Owner:       repo.Owner.Login,
+				Description: repo.Description,
+				HTMLURL:     repo.HTMLURL,
+				CreatedAt:   repo.CreatedAt,
+				Fork:        repo.Fork,
+			})
+		}
+		if len(repos) < giteaPageSize {
+			return projects, nil
+		}
+	}
+	return projects, nil
+}
+
+func (g *giteaForge) FetchLanguages(ctx context.Context, project Project) (languages map[string]model.Language, err error) {
+	attrs, err := g.client.RepoLanguages(ctx, project.Owner, project.Name)
+	if err != nil {
+		return languages, translateGiteaErr(err)
+	}
+	return languagesFromBytes(attrs), nil
+}
+
+// translateGiteaErr tags gitea's errors with their provider-neutral counterpart
+func translateGiteaErr(err error) error {
+	switch {
+	case errors.Is(err, gitea.ErrAuthentication):
+		return fmt.Errorf("%w: %w", ErrAuthentication, err)
+	case errors.Is(err, gitea.ErrRateLimit):
+		return fmt.Errorf("%w: %w", ErrRateLimit, err)
+	}
+	return err
+}
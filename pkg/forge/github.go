@@ -0,0 +1,200 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	ProviderGitHub = "github"
+
+	eventsPerPage = 100
+	wantedType    = "CreateEvent"
+	wantedRefType = "repository"
+)
+
+type githubForge struct {
+	client github.Client
+	// graphql fetches the languages of every listed repository in a few batched queries
+	// rather than with one REST request per repository
+	graphql bool
+
+	// created remembers when the repositories seen in the last events scan were created,
+	// since the list public repositories API doesn't say
+	mu      sync.RWMutex
+	created map[int64]time.Time
+}
+
+func NewGitHub(client github.Client) Forge {
+	return &githubForge{client: client, created: make(map[int64]time.Time)}
+}
+
+// NewGitHubGraphQL enriches the listed repositories through the GraphQL API, which also
+// yields their stars, license, topics and exact creation time. It requires authentication
+func NewGitHubGraphQL(client github.Client) Forge {
+	return &githubForge{client: client, graphql: true, created: make(map[int64]time.Time)}
+}
+
+func (g *githubForge) Name() string {
+	return ProviderGitHub
+}
+
+// NewestProjectID looks back through the public events until it finds a repository being created
+// since the list public repositories API can't be sorted by creation date
+func (g *githubForge) NewestProjectID(ctx context.Context) (ID int64, err error) {
+	page := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return 0, fmt.Errorf("aborted searching for repos: %w", ctx.Err())
+		default:
+			recentEvents, err := g.client.ListPublicEvents(ctx, eventsPerPage, page)
+			if err != nil {
+				return ID, fmt.Errorf("failed to list public events: %w", translateGitHubErr(err))
+			}
+
+			// if we didn't find a valid Repo ID then we increment the page and keep looking back
+			ID = g.validate(recentEvents)
+			if ID > 0 {
+				g.remember(recentEvents)
+				return ID, nil
+			}
+			page++
+		}
+	}
+}
+
+func (g *githubForge) validate(events []github.Event) (ID int64) {
+	for _, event := range events {
+		if event.Type != wantedType {
+			continue
+		}
+		if event.Payload.RefType == wantedRefType {
+			return event.Repo.ID
+		}
+	}
+	return 0
+}
+
+// remember records the creation time of every repository created in the events
+func (g *githubForge) remember(events []github.Event) {
+	created := make(map[int64]time.Time, len(events))
+	for _, event := range events {
+		if event.Type == wantedType && event.Payload.RefType == wantedRefType {
+			created[event.Repo.ID] = event.CreatedAt
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.created = created
+}
+
+// createdAt estimates when a repository was created. Repository IDs are handed out sequentially
+// so unless its own creation event was seen, it was created at the latest when the next known one was
+func (g *githubForge) createdAt(ID int64) (createdAt time.Time, estimated bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if t, ok := g.created[ID]; ok {
+		return t, false
+	}
+
+	var next int64
+	for knownID, t := range g.created {
+		if knownID > ID && (next == 0 || knownID < next) {
+			next, createdAt = knownID, t
+		}
+	}
+	return createdAt, true
+}
+
+func (g *githubForge) ListProjects(ctx context.Context, since int64, limit int) (projects []Project, err error) {
+	repos, err := g.client.ListPublicRepos(ctx, since)
+	if err != nil {
+		return projects, translateGitHubErr(err)
+	}
+	if len(repos) > limit {
+		repos = repos[:limit]
+	}
+
+	projects = make([]Project, 0, len(repos))
+	for _, repo := range repos {
+		createdAt, estimated := g.createdAt(repo.ID)
+		projects = append(projects, Project{
+			ID:                 repo.ID,
+			Name:               repo.Name,
+			FullName:           repo.FullName,
+			Owner:              repo.Owner.Login,
+			OwnerType:          model.NormalizeOwnerType(repo.Owner.Type),
+			Description:        repo.Description,
+			HTMLURL:            repo.HTMLURL,
+			CreatedAt:          createdAt,
+			CreatedAtEstimated: estimated,
+			Fork:               repo.Fork,
+			LanguagesURL:       repo.LanguagesURL,
+		})
+	}
+
+	if g.graphql {
+		err = g.enrich(ctx, repos, projects)
+		if err != nil {
+			return projects, err
+		}
+	}
+	return projects, nil
+}
+
+func (g *githubForge) enrich(ctx context.Context, repos []github.Repository, projects []Project) error {
+	nodeIDs := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		nodeIDs = append(nodeIDs, repo.NodeID)
+	}
+	details, err := g.client.FetchRepoDetails(ctx, nodeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to fetch repository details: %w", translateGitHubErr(err))
+	}
+
+	for i, repo := range repos {
+		detail, ok := details[repo.NodeID]
+		if !ok {
+			continue
+		}
+		projects[i].CreatedAt = detail.CreatedAt
+		projects[i].CreatedAtEstimated = false
+		projects[i].Stars = detail.Stars
+		projects[i].License = detail.License
+		projects[i].Topics = detail.Topics
+		projects[i].Languages = languagesFromBytes(detail.Languages)
+	}
+	return nil
+}
+
+// FetchLanguages reports the number of bytes github detected for each language
+func (g *githubForge) FetchLanguages(ctx context.Context, project Project) (languages map[string]model.Language, err error) {
+	// already fetched along with the listing, repositories graphql couldn't resolve fall back to REST
+	if project.Languages != nil {
+		return project.Languages, nil
+	}
+	attrs, err := g.client.FetchAttribute(ctx, project.LanguagesURL)
+	if err != nil {
+		return languages, translateGitHubErr(err)
+	}
+	return languagesFromBytes(attrs), nil
+}
+
+// translateGitHubErr tags github's errors with their provider-neutral counterpart
+func translateGitHubErr(err error) error {
+	switch {
+	case errors.Is(err, github.ErrAuthentication):
+		return fmt.Errorf("%w: %w", ErrAuthentication, err)
+	case errors.Is(err, github.ErrRateLimit):
+		return fmt.Errorf("%w: %w", ErrRateLimit, err)
+	}
+	return err
+}
@@ -0,0 +1,93 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/laouji/git-repo-searcher/pkg/gitlab"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const ProviderGitLab = "gitlab"
+
+type gitlabForge struct {
+	client gitlab.Client
+}
+
+func NewGitLab(client gitlab.Client) Forge {
+	return &gitlabForge{client: client}
+}
+
+func (g *gitlabForge) Name() string {
+	return ProviderGitLab
+}
+
+// NewestProjectID asks for the single most recently created project
+func (g *gitlabForge) NewestProjectID(ctx context.Context) (ID int64, err error) {
+	projects, err := g.client.ListProjects(ctx, gitlab.ListProjectsOptions{
+		OrderBy: "created_at",
+		Sort:    "desc",
+		PerPage: 1,
+	})
+	if err != nil {
+		return ID, fmt.Errorf("failed to list newest project: %w", translateGitLabErr(err))
+	}
+	if len(projects) == 0 {
+		return ID, fmt.Errorf("no projects visible on gitlab")
+	}
+	return projects[0].ID, nil
+}
+
+func (g *gitlabForge) ListProjects(ctx context.Context, since int64, limit int) (projects []Project, err error) {
+	found, err := g.client.ListProjects(ctx, gitlab.ListProjectsOptions{
+		OrderBy: "created_at",
+		Sort:    "asc",
+		IDAfter: since,
+		PerPage: limit,
+	})
+	if err != nil {
+		return projects, translateGitLabErr(err)
+	}
+
+	projects = make([]Project, 0, len(found))
+	for _, project := range found {
+		projects = append(projects, Project{
+			ID:          project.ID,
+			Name:        project.Path,
+			FullName:    project.PathWithNamespace,
+			Owner:       project.Namespace.FullPath,
+			OwnerType:   model.NormalizeOwnerType(project.Namespace.Kind),
+			Description: project.Description,
+			HTMLURL:     project.WebURL,
+			CreatedAt:   project.CreatedAt,
+			Fork:        project.ForkedFromProject != nil,
+		})
+	}
+	return projects, nil
+}
+
+// FetchLanguages reports the share of each language, gitlab doesn't expose byte counts
+func (g *gitlabForge) FetchLanguages(ctx context.Context, project Project) (languages map[string]model.Language, err error) {
+	shares, err := g.client.ProjectLanguages(ctx, project.ID)
+	if err != nil {
+		return languages, translateGitLabErr(err)
+	}
+
+	languages = make(map[string]model.Language, len(shares))
+	for name, percent := range shares {
+		languages[name] = model.Language{Percent: percent}
+	}
+	return languages, nil
+}
+
+// translateGitLabErr tags gitlab's errors with their provider-neutral counterpart
+func translateGitLabErr(err error) error {
+	switch {
+	case errors.Is(err, gitlab.ErrAuthentication):
+		return fmt.Errorf("%w: %w", ErrAuthentication, err)
+	case errors.Is(err, gitlab.ErrRateLimit):
+		return fmt.Errorf("%w: %w", ErrRateLimit, err)
+	}
+	return err
+}
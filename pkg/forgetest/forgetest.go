@@ -0,0 +1,50 @@
+// Package forgetest provides a forge serving fixed projects, for testing what is built on top of the forges
+package forgetest
+
+import (
+	"context"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+// Stub serves a fixed set of projects which all use the same languages,
+// optionally after a delay or with an error
+type Stub struct {
+	Provider  string
+	Projects  []forge.Project
+	Languages map[string]model.Language
+	// Delay holds the searches back, they give up when their context is done first
+	Delay time.Duration
+	// Err fails the searches when set
+	Err error
+}
+
+var _ forge.Forge = &Stub{}
+
+func (f *Stub) Name() string {
+	return f.Provider
+}
+
+func (f *Stub) NewestProjectID(ctx context.Context) (int64, error) {
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return f.Projects[len(f.Projects)-1].ID, nil
+}
+
+func (f *Stub) ListProjects(ctx context.Context, since int64, limit int) ([]forge.Project, error) {
+	return f.Projects, nil
+}
+
+func (f *Stub) FetchLanguages(ctx context.Context, project forge.Project) (map[string]model.Language, error) {
+	return f.Languages, nil
+}
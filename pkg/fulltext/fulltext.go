@@ -0,0 +1,208 @@
+package fulltext
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
+)
+
+const (
+	nameWeight        = 3
+	topicWeight       = 2
+	fullNameWeight    = 1
+	descriptionWeight = 1
+
+	// prefixWeight discounts the words a query term is only the beginning of
+	prefixWeight = 0.5
+	// saturation stops a word repeated over and over from outweighing the others
+	saturation = 1.2
+)
+
+// Hit is a repository matching every term of a query
+type Hit struct {
+	Provider string
+	ID       int64
+	Score    float64
+}
+
+type docKey struct {
+	provider string
+	ID       int64
+}
+
+// Index is an inverted index over the name, full name, description and topics of repositories.
+// Query terms match the words they are the beginning of, so that "pars" finds "parser"
+type Index struct {
+	mu sync.RWMutex
+	// postings holds the weighted frequency of each word in each repository
+	postings map[string]map[docKey]float64
+	docs     map[docKey][]string
+	// words is sorted so that the words starting with a prefix are next to each other
+	words []string
+}
+
+func New() *Index {
+	return &Index{
+		postings: make(map[string]map[docKey]float64),
+		docs:     make(map[docKey][]string),
+	}
+}
+
+// Add indexes the repository, replacing what was indexed for it before
+func (i *Index) Add(repo model.Repository) {
+	frequencies := make(map[string]float64)
+	count := func(text string, weight float64) {
+		for _, word := range ranking.Tokenize(text) {
+			frequencies[word] += weight
+		}
+	}
+	count(repo.Repository, nameWeight)
+	count(repo.FullName, fullNameWeight)
+	count(repo.Description, descriptionWeight)
+	for _, topic := range repo.Topics {
+		count(topic, topicWeight)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	key := docKey{provider: repo.Provider, ID: repo.ID}
+	i.remove(key)
+	words := make([]string, 0, len(frequencies))
+	for word, frequency := range frequencies {
+		postings, ok := i.postings[word]
+		if !ok {
+			postings = make(map[docKey]float64)
+			i.postings[word] = postings
+			i.insertWord(word)
+		}
+		postings[key] = frequency
+		words = append(words, word)
+	}
+	i.docs[key] = words
+}
+
+func (i *Index) Remove(provider string, ID int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(docKey{provider: provider, ID: ID})
+}
+
+// Len is the number of indexed repositories
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.docs)
+}
+
+// Search returns the repositories matching every term of the text, most relevant first.
+// Rare terms weigh more than common ones, and a whole word more than one the term starts
+func (i *Index) Search(text string) []Hit {
+	terms := unique(ranking.Tokenize(text))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	var scores map[docKey]float64
+	for _, term := range terms {
+		termScores := i.match(term)
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+		for key, score := range scores {
+			termScore, ok := termScores[key]
+			if !ok {
+				delete(scores, key)
+				continue
+			}
+			scores[key] = score + termScore
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for key, score := range scores {
+		hits = append(hits, Hit{Provider: key.provider, ID: key.ID, Score: score})
+	}
+	sort.Slice(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		if hits[a].Provider != hits[b].Provider {
+			return hits[a].Provider < hits[b].Provider
+		}
+		return hits[a].ID > hits[b].ID
+	})
+	return hits
+}
+
+// match scores the repositories having a word the term starts, a repository with several
+// such words is scored on the best of them. The fewer repositories the term matches, the more it weighs
+func (i *Index) match(term string) map[docKey]float64 {
+	scores := make(map[docKey]float64)
+	for n := sort.SearchStrings(i.words, term); n < len(i.words) && strings.HasPrefix(i.words[n], term); n++ {
+		word := i.words[n]
+		weight := 1.0
+		if word != term {
+			weight = prefixWeight
+		}
+		for key, frequency := range i.postings[word] {
+			score := weight * frequency / (frequency + saturation)
+			if score > scores[key] {
+				scores[key] = score
+			}
+		}
+	}
+
+	idf := math.Log(1 + float64(len(i.docs))/float64(len(scores)))
+	for key := range scores {
+		scores[key] *= idf
+	}
+	return scores
+}
+
+func (i *Index) remove(key docKey) {
+	for _, word := range i.docs[key] {
+		postings := i.postings[word]
+		delete(postings, key)
+		if len(postings) == 0 {
+			delete(i.postings, word)
+			i.removeWord(word)
+		}
+	}
+	delete(i.docs, key)
+}
+
+func (i *Index) insertWord(word string) {
+	n := sort.SearchStrings(i.words, word)
+	i.words = append(i.words, "")
+	copy(i.words[n+1:], i.words[n:])
+	i.words[n] = word
+}
+
+func (i *Index) removeWord(word string) {
+	n := sort.SearchStrings(i.words, word)
+	if n < len(i.words) && i.words[n] == word {
+		i.words = append(i.words[:n], i.words[n+1:]...)
+	}
+}
+
+func unique(terms []string) []string {
+	seen := make(map[string]struct{}, len(terms))
+	out := terms[:0]
+	for _, term := range terms {
+		if _, ok := seen[term]; ok {
+			continue
+		}
+		seen[term] = struct{}{}
+		out = append(out, term)
+	}
+	return out
+}
@@ -0,0 +1,89 @@
+package fulltext_test
+
+import (
+	"testing"
+
+	"github.com/laouji/git-repo-searcher/pkg/fulltext"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type fulltextTestSuite struct {
+	suite.Suite
+	index *fulltext.Index
+}
+
+func TestFulltext(t *testing.T) {
+	suite.Run(t, new(fulltextTestSuite))
+}
+
+func (s *fulltextTestSuite) SetupTest() {
+	s.index = fulltext.New()
+	for _, repo := range []model.Repository{
+		{Provider: "github", ID: 1, Repository: "toml", FullName: "bob/toml", Description: "Reads configuration files"},
+		{Provider: "github", ID: 2, Repository: "tomlkit", FullName: "carol/tomlkit", Description: "Style preserving TOML library"},
+		{Provider: "gitlab", ID: 3, Repository: "parser", FullName: "alice/parser", Description: "A toml parser", Topics: []string{"config"}},
+		{Provider: "github", ID: 4, Repository: "website", FullName: "alice/website", Description: "Personal website"},
+	} {
+		s.index.Add(repo)
+	}
+}
+
+func (s *fulltextTestSuite) ids(hits []fulltext.Hit) []int64 {
+	ids := []int64{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func (s *fulltextTestSuite) TestSearch_RanksNameMatchesFirst() {
+	// the whole word in the name beats it in the description or the beginning of the name,
+	// the description of 2 and 3 weigh the same and the tie is broken by provider
+	s.Equal([]int64{1, 2, 3}, s.ids(s.index.Search("TOML")))
+}
+
+func (s *fulltextTestSuite) TestSearch_MatchesPrefixes() {
+	s.Equal([]int64{3}, s.ids(s.index.Search("pars")))
+	// topics weigh more than the description
+	s.Equal([]int64{3, 1}, s.ids(s.index.Search("conf")))
+	s.Equal([]int64{4, 3}, s.ids(s.index.Search("alice")))
+}
+
+func (s *fulltextTestSuite) TestSearch_RequiresEveryTerm() {
+	s.Equal([]int64{3}, s.ids(s.index.Search("toml parser")))
+	s.Empty(s.index.Search("toml website"))
+	s.Empty(s.index.Search("  -- "))
+}
+
+func (s *fulltextTestSuite) TestAdd_ReplacesPreviousVersion() {
+	s.index.Add(model.Repository{Provider: "github", ID: 4, Repository: "blog", FullName: "alice/blog"})
+	s.Empty(s.index.Search("website"))
+	s.Equal([]int64{4}, s.ids(s.index.Search("blog")))
+	s.Equal(4, s.index.Len())
+}
+
+func (s *fulltextTestSuite) TestRemove() {
+	s.index.Remove("gitlab", 3)
+	s.Empty(s.index.Search("parser"))
+	s.Equal([]int64{1, 2}, s.ids(s.index.Search("toml")))
+	s.Equal(3, s.index.Len())
+}
+
+func (s *fulltextTestSuite) TestIndexed_FollowsTheStore() {
+	memory := store.NewMemory()
+	memory.Upsert(model.Repository{Provider: "github", ID: 10, Repository: "existing", FullName: "dan/existing"})
+
+	index := fulltext.New()
+	indexed := fulltext.Indexed(memory, index)
+	s.Len(index.Search("existing"), 1)
+
+	indexed.Upsert(model.Repository{Provider: "github", ID: 11, Repository: "crawler", Description: "Crawls websites"})
+	// a partial update doesn't drop what the index knew
+	indexed.Upsert(model.Repository{Provider: "github", ID: 11, FullName: "dan/crawler"})
+	s.Len(index.Search("crawls dan"), 1)
+
+	indexed.Delete("github", 11)
+	s.Empty(index.Search("crawler"))
+}
@@ -0,0 +1,36 @@
+package fulltext
+
+import (
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+)
+
+// indexedStore keeps the text index in line with the repositories of the store
+type indexedStore struct {
+	store.Store
+	index *Index
+}
+
+// Indexed wraps the store so that every repository it holds, now or later, is in the text index
+func Indexed(s store.Store, index *Index) store.Store {
+	for _, record := range s.List() {
+		index.Add(record.Repository)
+	}
+	return &indexedStore{Store: s, index: index}
+}
+
+// Upsert indexes the merged repository, so that what a partial update doesn't
+// know about, such as the description, stays searchable
+func (s *indexedStore) Upsert(repo model.Repository, authoritative ...store.Field) (created bool) {
+	created = s.Store.Upsert(repo, authoritative...)
+	if record, ok := s.Store.Get(repo.Provider, repo.ID); ok {
+		s.index.Add(record.Repository)
+	}
+	return created
+}
+
+func (s *indexedStore) Delete(provider string, ID int64) (deleted bool) {
+	deleted = s.Store.Delete(provider, ID)
+	s.index.Remove(provider, ID)
+	return deleted
+}
@@ -0,0 +1,156 @@
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// apiPathPrefix is where Gitea and Forgejo serve the REST API
+const apiPathPrefix = "/api/v1"
+
+var (
+	ErrAuthentication = errors.New("gitea API returned 401")
+	ErrRateLimit      = errors.New("gitea API rate limit reached")
+)
+
+type Client interface {
+	SearchRepos(ctx context.Context, opts SearchOptions) (repos []Repository, err error)
+	RepoLanguages(ctx context.Context, owner, repo string) (languages map[string]int64, err error)
+}
+
+// SearchOptions maps to the query parameters of the repository search API
+type SearchOptions struct {
+	Sort  string
+	Order string
+	Page  int
+	Limit int
+}
+
+type client struct {
+	innerClient *http.Client
+	baseURL     string
+	token       string
+}
+
+// NewClient builds a gitea API client, the token is optional but without it only public repositories are visible
+func NewClient(innerClient *http.Client, baseURL string, token string) Client {
+	return &client{
+		innerClient: innerClient,
+		baseURL:     baseURL,
+		token:       token,
+	}
+}
+
+// NormalizeBaseURL appends the /api/v1 prefix so that the host of a gitea instance can be configured on its own
+func NormalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse gitea url %s: %w", raw, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("gitea url %q must be absolute", raw)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if u.Path == "" {
+		u.Path = apiPathPrefix
+	}
+	return u.String(), nil
+}
+
+func (c *client) do(req *http.Request) (body []byte, err error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.innerClient.Do(req)
+	if err != nil {
+		return body, fmt.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		return body, ErrAuthentication
+	case http.StatusTooManyRequests:
+		return body, ErrRateLimit
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return body, fmt.Errorf("failed to read response body for status %d: %w", res.StatusCode, err)
+	}
+	if res.StatusCode > 399 {
+		return body, fmt.Errorf("unexpected status of %d for req: %q", res.StatusCode, body)
+	}
+	return body, nil
+}
+
+// SearchRepos lists the repositories visible to the client
+// https://gitea.com/api/swagger#/repository/repoSearch
+func (c *client) SearchRepos(ctx context.Context, opts SearchOptions) (repos []Repository, err error) {
+	path := "/repos/search"
+	u, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return repos, fmt.Errorf("failed to parse url %s%s: %w", c.baseURL, path, err)
+	}
+
+	q := u.Query()
+	if opts.Sort != "" {
+		q.Add("sort", opts.Sort)
+	}
+	if opts.Order != "" {
+		q.Add("order", opts.Order)
+	}
+	if opts.Page > 0 {
+		q.Add("page", strconv.Itoa(opts.Page))
+	}
+	if opts.Limit > 0 {
+		q.Add("limit", strconv.Itoa(opts.Limit))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return repos, fmt.Errorf("failed to create request to %s: %w", path, err)
+	}
+	b, err := c.do(req)
+	if err != nil {
+		return repos, fmt.Errorf("failed to do request to %s: %w", path, err)
+	}
+
+	var results searchResults
+	err = json.Unmarshal(b, &results)
+	if err != nil {
+		return repos, fmt.Errorf("failed to unmarshal search response: %w", err)
+	}
+	return results.Data, nil
+}
+
+// RepoLanguages returns the number of bytes written in each language
+// https://gitea.com/api/swagger#/repository/repoGetLanguages
+func (c *client) RepoLanguages(ctx context.Context, owner, repo string) (languages map[string]int64, err error) {
+	path := fmt.Sprintf("/repos/%s/%s/languages", url.PathEscape(owner), url.PathEscape(repo))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return languages, fmt.Errorf("failed to create request to %s: %w", path, err)
+	}
+	b, err := c.do(req)
+	if err != nil {
+		return languages, fmt.Errorf("failed to do request to %s: %w", path, err)
+	}
+
+	err = json.Unmarshal(b, &languages)
+	if err != nil {
+		return languages, fmt.Errorf("failed to unmarshal languages response: %w", err)
+	}
+	return languages, nil
+}
@@ -0,0 +1,65 @@
+package gitea_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/gitea"
+	"github.com/stretchr/testify/suite"
+)
+
+type clientTestSuite struct {
+	suite.Suite
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(clientTestSuite))
+}
+
+func (s *clientTestSuite) TestSearchRepos() {
+	handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/api/v1/repos/search", r.URL.Path)
+		s.Equal("limit=50&order=desc&page=2&sort=created", r.URL.RawQuery)
+		s.Equal("token secret", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"ok":true,"data":[{"id":7,"name":"repo","full_name":"org/repo","owner":{"login":"org"}}]}`))
+	})
+	server := httptest.NewServer(handlerFn)
+	defer server.Close()
+
+	baseURL, err := gitea.NormalizeBaseURL(server.URL)
+	s.Require().NoError(err)
+	client := gitea.NewClient(&http.Client{Timeout: time.Second}, baseURL, "secret")
+	repos, err := client.SearchRepos(context.Background(), gitea.SearchOptions{Sort: "created", Order: "desc", Page: 2, Limit: 50})
+	s.Require().NoError(err)
+	s.Require().Len(repos, 1)
+	s.Equal("org/repo", repos[0].FullName)
+	s.Equal("org", repos[0].Owner.Login)
+}
+
+func (s *clientTestSuite) TestRepoLanguages() {
+	handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/api/v1/repos/org/repo/languages", r.URL.Path)
+		w.Write([]byte(`{"Go": 2048}`))
+	})
+	server := httptest.NewServer(handlerFn)
+	defer server.Close()
+
+	client := gitea.NewClient(&http.Client{Timeout: time.Second}, server.URL+"/api/v1", "")
+	languages, err := client.RepoLanguages(context.Background(), "org", "repo")
+	s.Require().NoError(err)
+	s.Equal(int64(2048), languages["Go"])
+}
+
+func (s *clientTestSuite) TestUnauthorized() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := gitea.NewClient(&http.Client{Timeout: time.Second}, server.URL, "bad")
+	_, err := client.SearchRepos(context.Background(), gitea.SearchOptions{})
+	s.ErrorIs(err, gitea.ErrAuthentication)
+}
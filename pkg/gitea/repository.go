@@ -0,0 +1,26 @@
+package gitea
+
+import "time"
+
+type User struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+}
+
+type Repository struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	FullName    string    `json:"full_name"`
+	Owner       User      `json:"owner"`
+	Description string    `json:"description"`
+	HTMLURL     string    `json:"html_url"`
+	Fork        bool      `json:"fork"`
+	Private     bool      `json:"private"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// searchResults wraps the repositories returned by the search API
+type searchResults struct {
+	OK   bool         `json:"ok"`
+	Data []Repository `json:"data"`
+}
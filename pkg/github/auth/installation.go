@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// App holds the credentials of a github app whose installations are used to authenticate requests
+type App struct {
+	ID   string
+	Keys *KeyRing
+}
+
+func (a App) generateJWT(key *rsa.PrivateKey) (string, error) {
+	now := time.Now().UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"iss": a.ID,
+		"alg": jwt.SigningMethodRS256.Alg(),
+	})
+	return token.SignedString(key)
+}
+
+type Account struct {
+	Login string `json:"login"`
+}
+
+type Installation struct {
+	ID              int     `json:"id"`
+	AccessTokensURL string  `json:"access_tokens_url"`
+	AppID           int     `json:"app_id"`
+	Account         Account `json:"account"`
+}
+
+// appInstallation authenticates as every installation of the configured github apps.
+// Installation tokens expire after an hour so they need to be refreshed periodically
+type appInstallation struct {
+	doer    Doer
+	baseURL string
+	apps    []App
+
+	pool    *tokenPool
+	updates chan Token
+}
+
+func NewAppInstallation(doer Doer, baseURL string, apps ...App) Provider {
+	return &appInstallation{
+		doer:    doer,
+		baseURL: baseURL,
+		apps:    apps,
+		pool:    &tokenPool{},
+		updates: make(chan Token, 1),
+	}
+}
+
+// Authorize uses the pooled token with the most remaining budget
+func (a *appInstallation) Authorize(ctx context.Context, req *http.Request) (Credential, error) {
+	entry := a.pool.pick()
+	if entry == nil {
+		return nil, ErrNoCredential
+	}
+
+	// if a refresh is underway, wait for it rather than sending a token we know is stale
+	if err := entry.awaitRefresh(ctx); err != nil {
+		return nil, err
+	}
+	usedToken := entry.value()
+	if usedToken == "" {
+		return nil, fmt.Errorf("token was not set for installation %d of app %q", entry.installationID, entry.app.ID)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+usedToken)
+	return &installationCredential{provider: a, entry: entry, usedToken: usedToken}, nil
+}
+
+// Refresh discovers the installations of every configured app and refreshes
+// the access token of each one independently. It returns the token which expires first,
+// along with the errors of the apps whose installations couldn't be listed
+func (a *appInstallation) Refresh(ctx context.Context) (token Token, err error) {
+	var listErrs []error
+	for _, app := range a.apps {
+		installations, err := a.listInstallations(ctx, app)
+		if err != nil {
+			// the installations already known to the pool are still refreshed
+			listErrs = append(listErrs, fmt.Errorf("failed to list the installations of app %q: %w", app.ID, err))
+			continue
+		}
+		a.pool.sync(app, installations)
+	}
+
+	entries := a.pool.all()
+	errs := make([]error, len(entries))
+	wg := sync.WaitGroup{}
+	for i, entry := range entries {
+		wg.Add(1)
+		go func(i int, entry *pooledToken) {
+			defer wg.Done()
+			_, errs[i] = a.refreshToken(ctx, entry)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	// when every refresh failed the previous tokens are returned, they are still sent until they expire
+	token, ok := a.pool.earliestExpiry()
+	if !ok || failed == len(errs) {
+		return token, fmt.Errorf("failed to refresh any access token: %w", errors.Join(append(listErrs, errs...)...))
+	}
+	a.publish(token)
+	return token, errors.Join(listErrs...)
+}
+
+func (a *appInstallation) Updates() <-chan Token {
+	return a.updates
+}
+
+func (a *appInstallation) Expires() bool {
+	return true
+}
+
+func (a *appInstallation) Health() []TokenStatus {
+	return a.pool.statuses()
+}
+
+// publish replaces any unread update so listeners only ever see the latest token
+func (a *appInstallation) publish(token Token) {
+	select {
+	case <-a.updates:
+	default:
+	}
+	select {
+	case a.updates <- token:
+	default:
+	}
+}
+
+// refreshToken exchanges the app's json web token for a new installation access token.
+// Concurrent refreshes of the same entry are coalesced into a single exchange
+func (a *appInstallation) refreshToken(ctx context.Context, entry *pooledToken) (token Token, err error) {
+	call, owner := entry.setRefreshing()
+	if !owner {
+		select {
+		case <-call.done:
+			return call.token, call.err
+		case <-ctx.Done():
+			return token, fmt.Errorf("aborted waiting for token refresh: %w", ctx.Err())
+		}
+	}
+
+	// the refresh is shared, so it must not be aborted because the caller that triggered it went away
+	call.token, call.err = a.fetchAccessToken(context.WithoutCancel(ctx), entry)
+	entry.finishRefresh(call)
+	return call.token, call.err
+}
+
+func (a *appInstallation) fetchAccessToken(ctx context.Context, entry *pooledToken) (token Token, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, entry.refreshURL, nil)
+	if err != nil {
+		return token, fmt.Errorf("failed to create request to %s: %w", entry.refreshURL, err)
+	}
+	b, err := a.doAsApp(req, entry.app)
+	if err != nil {
+		return token, fmt.Errorf("failed to do request to %s: %w", entry.refreshURL, err)
+	}
+
+	err = json.Unmarshal(b, &token)
+	if err != nil {
+		return token, fmt.Errorf("failed to unmarshal token response: %w", err)
+	}
+	return token, nil
+}
+
+func (a *appInstallation) listInstallations(ctx context.Context, app App) (installations []Installation, err error) {
+	path := "/app/installations"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path, nil)
+	if err != nil {
+		return installations, fmt.Errorf("failed to create request to %s: %w", path, err)
+	}
+	b, err := a.doAsApp(req, app)
+	if err != nil {
+		return installations, fmt.Errorf("failed to do request to %s: %w", path, err)
+	}
+
+	var all []Installation
+	err = json.Unmarshal(b, &all)
+	if err != nil {
+		return installations, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	for _, installation := range all {
+		if strconv.Itoa(installation.AppID) == app.ID {
+			installations = append(installations, installation)
+		}
+	}
+	if len(installations) == 0 {
+		return installations, fmt.Errorf("no installations found for app %q: %w", app.ID, ErrAppNotInstalled)
+	}
+	return installations, nil
+}
+
+// doAsApp authenticates the request as the app itself, which the installation endpoints require.
+// Keys are tried newest first so that a rotated key which github doesn't accept yet falls back to the previous one
+func (a *appInstallation) doAsApp(req *http.Request, app App) (body []byte, err error) {
+	for _, key := range app.Keys.candidates() {
+		body, err = a.sendAsApp(req.Clone(req.Context()), app, key)
+		if !errors.Is(err, errKeyRejected) {
+			if err == nil {
+				app.Keys.activate(key)
+			}
+			return body, err
+		}
+		app.Keys.reject(key, err)
+	}
+	return body, err
+}
+
+func (a *appInstallation) sendAsApp(req *http.Request, app App, key *signingKey) (body []byte, err error) {
+	jwToken, err := app.generateJWT(key.key)
+	if err != nil {
+		return body, fmt.Errorf("failed to generate json web token for app %q: %w", app.ID, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwToken)
+
+	res, err := a.doer.Do(req)
+	if err != nil {
+		return body, fmt.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return body, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return body, fmt.Errorf("key %s: %w", key.fingerprint, errKeyRejected)
+	}
+	if res.StatusCode > 399 {
+		return body, fmt.Errorf("unexpected status of %d for req: %q", res.StatusCode, body)
+	}
+	return body, nil
+}
+
+// installationCredential remembers which token a request was sent with so that
+// a 401 only triggers a refresh if nobody has replaced that token in the meantime
+type installationCredential struct {
+	provider  *appInstallation
+	entry     *pooledToken
+	usedToken string
+}
+
+func (c *installationCredential) Observe(header http.Header) {
+	c.entry.observe(header)
+}
+
+func (c *installationCredential) Renew(ctx context.Context) (bool, error) {
+	if c.entry.value() != c.usedToken {
+		return true, nil
+	}
+	token, err := c.provider.refreshToken(ctx, c.entry)
+	if err != nil {
+		return false, err
+	}
+	c.provider.publish(token)
+	return true, nil
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/sirupsen/logrus"
+)
+
+// signingKey is one private key an app can sign its json web tokens with
+type signingKey struct {
+	path        string
+	key         *rsa.PrivateKey
+	fingerprint string
+	modTime     time.Time
+	loadedAt    time.Time
+	lastErr     error
+	// rejectedAt is when github last refused the key, it is tried last for a while after that
+	rejectedAt time.Time
+}
+
+// rejectedKeyRetry is how long a key github refused is tried after the others
+const rejectedKeyRetry = 10 * time.Minute
+
+// KeyStatus describes a private key held by a key ring
+type KeyStatus struct {
+	Fingerprint string    `json:"fingerprint"`
+	Path        string    `json:"path,omitempty"`
+	LoadedAt    time.Time `json:"loaded_at"`
+	Active      bool      `json:"active"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// KeyRing holds the private keys of a github app so they can be rotated without a restart.
+// Newly loaded keys are tried first, but the previous key stays around until github
+// has accepted the new one so a bad rotation doesn't lock the app out
+type KeyRing struct {
+	logger logrus.FieldLogger
+	paths  []string
+
+	mu     sync.RWMutex
+	keys   []*signingKey
+	active string
+}
+
+// NewKeyRing loads the PEM encoded keys at the given paths, the first one starts out as active
+func NewKeyRing(logger logrus.FieldLogger, paths ...string) (*KeyRing, error) {
+	ring := &KeyRing{logger: logger, paths: paths}
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys = append(ring.keys, key)
+	}
+	if len(ring.keys) == 0 {
+		return nil, fmt.Errorf("no private key given")
+	}
+	ring.active = ring.keys[0].fingerprint
+	logger.WithField("fingerprint", ring.active).Info("Using github app private key")
+	return ring, nil
+}
+
+// NewStaticKeyRing holds keys which are never reloaded
+func NewStaticKeyRing(logger logrus.FieldLogger, keys ...*rsa.PrivateKey) (*KeyRing, error) {
+	ring := &KeyRing{logger: logger}
+	for _, key := range keys {
+		fingerprint, err := Fingerprint(&key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys = append(ring.keys, &signingKey{key: key, fingerprint: fingerprint, loadedAt: time.Now().UTC()})
+	}
+	if len(ring.keys) == 0 {
+		return nil, fmt.Errorf("no private key given")
+	}
+	ring.active = ring.keys[0].fingerprint
+	return ring, nil
+}
+
+// Fingerprint formats the SHA256 digest of a public key the way github displays it in the app settings
+func Fingerprint(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+func loadKey(path string) (*signingKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat private key file: %w", err)
+	}
+	pemBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key file %s: %w", path, err)
+	}
+	fingerprint, err := Fingerprint(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &signingKey{
+		path:        path,
+		key:         key,
+		fingerprint: fingerprint,
+		modTime:     info.ModTime(),
+		loadedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// Reload re-reads every key file that changed since it was last loaded.
+// A key that differs from the ones already held becomes the first candidate for signing
+func (k *KeyRing) Reload() error {
+	return k.reload(false)
+}
+
+// ForceReload re-reads every key file whether it changed or not, and gives the keys
+// github refused another chance. It is meant for operators asking for a reload
+func (k *KeyRing) ForceReload() error {
+	return k.reload(true)
+}
+
+func (k *KeyRing) reload(force bool) error {
+	for _, path := range k.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat private key file: %w", err)
+		}
+		if !force && !k.changed(path, info.ModTime()) {
+			continue
+		}
+
+		key, err := loadKey(path)
+		if err != nil {
+			return err
+		}
+		k.add(key, force)
+	}
+	return nil
+}
+
+func (k *KeyRing) changed(path string, modTime time.Time) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	for _, key := range k.keys {
+		if key.path == path && !key.modTime.Before(modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+func (k *KeyRing) add(key *signingKey, retry bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	for _, existing := range k.keys {
+		if existing.fingerprint == key.fingerprint {
+			existing.path, existing.modTime = key.path, key.modTime
+			if retry {
+				existing.rejectedAt = time.Time{}
+			}
+			return
+		}
+	}
+
+	// keep every path's current key plus the active one, anything older can't be rolled back to
+	keys := []*signingKey{key}
+	for _, existing := range k.keys {
+		if existing.path != key.path || existing.fingerprint == k.active {
+			keys = append(keys, existing)
+		}
+	}
+	k.keys = keys
+	k.logger.WithField("fingerprint", key.fingerprint).Info("Loaded new github app private key")
+}
+
+// candidates lists the keys in the order they should be tried, newest first. The keys github
+// recently refused come last so that a bad rotation doesn't cost every token exchange a round trip
+func (k *KeyRing) candidates() []*signingKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	now := time.Now()
+	keys := make([]*signingKey, 0, len(k.keys))
+	var rejected []*signingKey
+	for _, key := range k.keys {
+		if !key.rejectedAt.IsZero() && now.Sub(key.rejectedAt) < rejectedKeyRetry {
+			rejected = append(rejected, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return append(keys, rejected...)
+}
+
+// activate records that github accepted a token signed with the key
+func (k *KeyRing) activate(key *signingKey) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key.lastErr = nil
+	key.rejectedAt = time.Time{}
+	if k.active == key.fingerprint {
+		return
+	}
+	k.logger.WithFields(logrus.Fields{
+		"fingerprint":          key.fingerprint,
+		"previous_fingerprint": k.active,
+	}).Info("Switched active github app private key")
+	k.active = key.fingerprint
+}
+
+// reject records that github refused a token signed with the key
+func (k *KeyRing) reject(key *signingKey, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key.lastErr = err
+	key.rejectedAt = time.Now()
+	k.logger.WithError(err).WithField("fingerprint", key.fingerprint).Warn("Github rejected app private key, falling back")
+}
+
+// Active returns the fingerprint of the key github last accepted
+func (k *KeyRing) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+func (k *KeyRing) Status() []KeyStatus {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	out := make([]KeyStatus, 0, len(k.keys))
+	for _, key := range k.keys {
+		status := KeyStatus{
+			Fingerprint: key.fingerprint,
+			Path:        key.path,
+			LoadedAt:    key.loadedAt,
+			Active:      key.fingerprint == k.active,
+		}
+		if key.lastErr != nil {
+			status.LastError = key.lastErr.Error()
+		}
+		out = append(out, status)
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/golang-jwt/jwt"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/stretchr/testify/suite"
+)
+
+type keyRingTestSuite struct {
+	suite.Suite
+	path string
+}
+
+func TestKeyRing(t *testing.T) {
+	suite.Run(t, new(keyRingTestSuite))
+}
+
+func (s *keyRingTestSuite) SetupTest() {
+	s.path = filepath.Join(s.T().TempDir(), "private_key.pem")
+}
+
+func (s *keyRingTestSuite) writeKey(modTime time.Time) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	s.Require().NoError(os.WriteFile(s.path, pemBytes, 0600))
+	s.Require().NoError(os.Chtimes(s.path, modTime, modTime))
+	return key
+}
+
+func (s *keyRingTestSuite) fingerprint(key *rsa.PrivateKey) string {
+	fingerprint, err := auth.Fingerprint(&key.PublicKey)
+	s.Require().NoError(err)
+	return fingerprint
+}
+
+func (s *keyRingTestSuite) TestReload_PicksUpRotatedKey() {
+	oldKey := s.writeKey(time.Now().Add(-time.Hour))
+	ring, err := auth.NewKeyRing(logger.Default(), s.path)
+	s.Require().NoError(err)
+	s.Equal(s.fingerprint(oldKey), ring.Active())
+
+	// nothing changed on disk
+	s.Require().NoError(ring.Reload())
+	s.Len(ring.Status(), 1)
+
+	newKey := s.writeKey(time.Now())
+	s.Require().NoError(ring.Reload())
+
+	status := ring.Status()
+	s.Require().Len(status, 2)
+	s.Equal(s.fingerprint(newKey), status[0].Fingerprint)
+	s.False(status[0].Active)
+	s.Equal(s.fingerprint(oldKey), status[1].Fingerprint)
+	s.True(status[1].Active)
+}
+
+func (s *keyRingTestSuite) TestForceReload_IgnoresModTime() {
+	modTime := time.Now().Add(-time.Hour)
+	s.writeKey(modTime)
+	ring, err := auth.NewKeyRing(logger.Default(), s.path)
+	s.Require().NoError(err)
+
+	// the file is replaced while keeping its modification time, as cp -p does
+	newKey := s.writeKey(modTime)
+	s.Require().NoError(ring.Reload())
+	s.Len(ring.Status(), 1)
+
+	s.Require().NoError(ring.ForceReload())
+	status := ring.Status()
+	s.Require().Len(status, 2)
+	s.Equal(s.fingerprint(newKey), status[0].Fingerprint)
+}
+
+func (s *keyRingTestSuite) TestReload_KeepsKeysWhenFileIsBroken() {
+	s.writeKey(time.Now().Add(-time.Hour))
+	ring, err := auth.NewKeyRing(logger.Default(), s.path)
+	s.Require().NoError(err)
+
+	s.Require().NoError(os.WriteFile(s.path, []byte("not a key"), 0600))
+	s.Error(ring.Reload())
+	s.Len(ring.Status(), 1)
+}
+
+func (s *keyRingTestSuite) TestRefresh_FallsBackToPreviousKey() {
+	appID := 7777
+	oldKey := s.writeKey(time.Now().Add(-time.Hour))
+	ring, err := auth.NewKeyRing(logger.Default(), s.path)
+	s.Require().NoError(err)
+
+	// github only knows about the keys in accepted
+	var mu sync.Mutex
+	accepted := []*rsa.PrivateKey{oldKey}
+	rejections := 0
+	verify := func(r *http.Request) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, key := range accepted {
+			_, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), func(*jwt.Token) (interface{}, error) {
+				return &key.PublicKey, nil
+			})
+			if err == nil {
+				return true
+			}
+		}
+		rejections++
+		return false
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		if !verify(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(`[{"id":1, "app_id":%d, "access_tokens_url":"%s"}]`, appID, server.URL+"/app/installations/1/access_tokens")))
+	})
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if !verify(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"token":"token"}`))
+	})
+
+	provider := auth.NewAppInstallation(http.DefaultClient, server.URL, auth.App{ID: fmt.Sprint(appID), Keys: ring})
+	_, err = provider.Refresh(context.Background())
+	s.Require().NoError(err)
+
+	// the key is rotated on disk before github knows about it
+	newKey := s.writeKey(time.Now())
+	s.Require().NoError(ring.Reload())
+	_, err = provider.Refresh(context.Background())
+	s.Require().NoError(err)
+	s.Equal(s.fingerprint(oldKey), ring.Active())
+	s.NotEmpty(ring.Status()[0].LastError)
+	mu.Lock()
+	s.Equal(1, rejections)
+	mu.Unlock()
+
+	// the refused key is tried last, the next exchanges don't waste a round trip on it
+	_, err = provider.Refresh(context.Background())
+	s.Require().NoError(err)
+	mu.Lock()
+	s.Equal(1, rejections)
+	mu.Unlock()
+
+	// once the new key is registered with github, a forced reload gives it another chance and it takes over
+	mu.Lock()
+	accepted = append(accepted, newKey)
+	mu.Unlock()
+	s.Require().NoError(ring.ForceReload())
+	_, err = provider.Refresh(context.Background())
+	s.Require().NoError(err)
+	s.Equal(s.fingerprint(newKey), ring.Active())
+	s.Empty(ring.Status()[0].LastError)
+}
@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// defaultRateLimit is the hourly request budget github grants an installation token
+// we assume it until the API tells us otherwise via the X-RateLimit-* headers
+const defaultRateLimit = 5000
+
+// refreshCall tracks a token refresh in flight so concurrent callers can share its result
+type refreshCall struct {
+	done  chan struct{}
+	token Token
+	err   error
+}
+
+// pooledToken is the access token of one app installation along with its remaining budget
+type pooledToken struct {
+	app            App
+	installationID int
+	account        string
+	refreshURL     string
+
+	mu        sync.RWMutex
+	token     *Token
+	rateLimit rateLimit
+	lastErr   error
+	refresh   *refreshCall
+}
+
+// rateLimit is the budget github reports via the X-RateLimit-* headers
+type rateLimit struct {
+	limit     int
+	remaining int
+	resetAt   time.Time
+}
+
+func newRateLimit() rateLimit {
+	return rateLimit{limit: defaultRateLimit, remaining: defaultRateLimit}
+}
+
+// update reads the rate limit headers and reports whether any were present
+func (r *rateLimit) update(header http.Header) bool {
+	// tokens are routed by their REST budget, the graphql and search budgets are counted separately
+	if resource := header.Get("X-RateLimit-Resource"); resource != "" && resource != "core" {
+		return false
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return false
+	}
+	r.remaining = remaining
+	if limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit")); err == nil {
+		r.limit = limit
+	}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		r.resetAt = time.Unix(reset, 0).UTC()
+	}
+	return true
+}
+
+// budget is the number of requests left, assuming a full budget once the reset time has passed
+func (r rateLimit) budget(now time.Time) int {
+	if !r.resetAt.IsZero() && now.After(r.resetAt) {
+		return r.limit
+	}
+	return r.remaining
+}
+
+func newPooledToken(app App, installation Installation) *pooledToken {
+	return &pooledToken{
+		app:            app,
+		installationID: installation.ID,
+		account:        installation.Account.Login,
+		refreshURL:     installation.AccessTokensURL,
+		rateLimit:      newRateLimit(),
+	}
+}
+
+// budget is the number of requests we believe this token can still make
+func (p *pooledToken) budget(now time.Time) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if !p.usable(now) {
+		return -1
+	}
+	return p.rateLimit.budget(now)
+}
+
+// usable reports whether the token can be sent, callers must hold the lock. A failed refresh
+// doesn't make it unusable, the previous token keeps being sent until it expires
+func (p *pooledToken) usable(now time.Time) bool {
+	if p.token == nil {
+		return false
+	}
+	return p.token.ExpiresAt.IsZero() || now.Before(p.token.ExpiresAt)
+}
+
+func (p *pooledToken) value() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.token == nil {
+		return ""
+	}
+	return p.token.Token
+}
+
+// observe records the rate limit github reported in response to a request made with this token
+func (p *pooledToken) observe(header http.Header) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rateLimit.update(header)
+}
+
+// awaitRefresh blocks until any refresh of this token currently in flight has finished
+func (p *pooledToken) awaitRefresh(ctx context.Context) error {
+	p.mu.RLock()
+	call := p.refresh
+	p.mu.RUnlock()
+	if call == nil {
+		return nil
+	}
+
+	select {
+	case <-call.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("aborted waiting for token refresh: %w", ctx.Err())
+	}
+}
+
+// setRefreshing registers a new refresh unless one is already in flight, in which case
+// the existing call is returned and the caller should wait on it instead
+func (p *pooledToken) setRefreshing() (call *refreshCall, owner bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.refresh != nil {
+		return p.refresh, false
+	}
+	p.refresh = &refreshCall{done: make(chan struct{})}
+	return p.refresh, true
+}
+
+func (p *pooledToken) finishRefresh(call *refreshCall) {
+	p.mu.Lock()
+	p.refresh = nil
+	p.lastErr = call.err
+	if call.err == nil {
+		token := call.token
+		p.token = &token
+	}
+	p.mu.Unlock()
+	close(call.done)
+}
+
+func (p *pooledToken) status(now time.Time) TokenStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	status := TokenStatus{
+		Kind:           "app_installation",
+		AppID:          p.app.ID,
+		InstallationID: p.installationID,
+		Account:        p.account,
+		RateLimit:      p.rateLimit.limit,
+		Remaining:      p.rateLimit.remaining,
+		ResetAt:        p.rateLimit.resetAt,
+	}
+	if p.token != nil {
+		status.ExpiresAt = p.token.ExpiresAt
+	}
+	if p.lastErr != nil {
+		status.LastError = p.lastErr.Error()
+	}
+	status.Healthy = p.usable(now) && p.lastErr == nil
+	return status
+}
+
+// tokenPool holds an access token for every installation of every configured app
+type tokenPool struct {
+	mu      sync.RWMutex
+	entries []*pooledToken
+}
+
+// sync adds any newly discovered installations to the pool, keeping the tokens of known ones
+func (t *tokenPool) sync(app App, installations []Installation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, installation := range installations {
+		known := false
+		for _, entry := range t.entries {
+			if entry.app.ID == app.ID && entry.installationID == installation.ID {
+				known = true
+				break
+			}
+		}
+		if !known {
+			t.entries = append(t.entries, newPooledToken(app, installation))
+		}
+	}
+}
+
+func (t *tokenPool) all() []*pooledToken {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	entries := make([]*pooledToken, len(t.entries))
+	copy(entries, t.entries)
+	return entries
+}
+
+// pick returns the usable token with the most remaining budget. If none are usable it falls back
+// to any token that was ever set so that a 401 can trigger its refresh
+func (t *tokenPool) pick() *pooledToken {
+	now := time.Now().UTC()
+	var best, fallback *pooledToken
+	bestBudget := -1
+	for _, entry := range t.all() {
+		if budget := entry.budget(now); budget > bestBudget {
+			best, bestBudget = entry, budget
+		}
+		if fallback == nil && entry.value() != "" {
+			fallback = entry
+		}
+	}
+	if best == nil {
+		return fallback
+	}
+	return best
+}
+
+// earliestExpiry returns the token which will expire first, which is the one the refresh schedule
+// needs to keep an eye on. Tokens whose last refresh failed are included since they need another try
+func (t *tokenPool) earliestExpiry() (token Token, ok bool) {
+	for _, entry := range t.all() {
+		entry.mu.RLock()
+		if entry.token != nil && (!ok || entry.token.ExpiresAt.Before(token.ExpiresAt)) {
+			token, ok = *entry.token, true
+		}
+		entry.mu.RUnlock()
+	}
+	return token, ok
+}
+
+func (t *tokenPool) statuses() []TokenStatus {
+	now := time.Now().UTC()
+	entries := t.all()
+	out := make([]TokenStatus, 0, len(entries))
+	for _, entry := range entries {
+		out = append(out, entry.status(now))
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrAppNotInstalled = errors.New("github app is not installed")
+	ErrNoCredential    = errors.New("no access token available")
+
+	errKeyRejected = errors.New("github rejected the app's json web token")
+)
+
+// Provider decides which credentials are attached to requests made to the github API
+type Provider interface {
+	// Authorize adds an Authorization header to the request and returns the credential it used
+	Authorize(ctx context.Context, req *http.Request) (Credential, error)
+	// Refresh obtains new tokens for providers that expire and returns the one expiring first
+	Refresh(ctx context.Context) (Token, error)
+	// Updates notifies listeners whenever the provider obtains a new token
+	Updates() <-chan Token
+	// Expires reports whether the provider's tokens need to be refreshed periodically
+	Expires() bool
+	// Health reports the state and remaining budget of every token the provider holds
+	Health() []TokenStatus
+}
+
+// Credential is the token that was attached to a single request
+type Credential interface {
+	// Observe records the rate limit github reported in response to a request made with the credential
+	Observe(header http.Header)
+	// Renew is called once github rejected the credential with a 401
+	// and reports whether the request is worth retrying
+	Renew(ctx context.Context) (retry bool, err error)
+}
+
+// Doer sends requests to the github API, *http.Client satisfies it
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type Token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TokenStatus reports the health of a single token held by a provider
+type TokenStatus struct {
+	Kind           string    `json:"kind"`
+	AppID          string    `json:"app_id,omitempty"`
+	InstallationID int       `json:"installation_id,omitempty"`
+	Account        string    `json:"account,omitempty"`
+	Healthy        bool      `json:"healthy"`
+	ExpiresAt      time.Time `json:"expires_at,omitempty"`
+	RateLimit      int       `json:"rate_limit"`
+	Remaining      int       `json:"rate_limit_remaining"`
+	ResetAt        time.Time `json:"rate_limit_reset"`
+	LastError      string    `json:"last_error,omitempty"`
+}
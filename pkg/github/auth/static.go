@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// unauthenticated sends requests anonymously, which github limits to 60 req/h per IP
+type unauthenticated struct {
+	updates chan Token
+}
+
+func NewUnauthenticated() Provider {
+	return &unauthenticated{updates: make(chan Token)}
+}
+
+// IsAnonymous reports whether the provider sends requests without credentials
+func IsAnonymous(provider Provider) bool {
+	_, ok := provider.(*unauthenticated)
+	return ok
+}
+
+func (u *unauthenticated) Authorize(ctx context.Context, req *http.Request) (Credential, error) {
+	return noCredential{}, nil
+}
+
+func (u *unauthenticated) Refresh(ctx context.Context) (token Token, err error) {
+	return token, nil
+}
+
+func (u *unauthenticated) Updates() <-chan Token {
+	return u.updates
+}
+
+func (u *unauthenticated) Expires() bool {
+	return false
+}
+
+func (u *unauthenticated) Health() []TokenStatus {
+	return []TokenStatus{}
+}
+
+type noCredential struct{}
+
+func (noCredential) Observe(header http.Header) {}
+
+func (noCredential) Renew(ctx context.Context) (bool, error) {
+	return false, nil
+}
+
+// staticToken authenticates with a token that never needs refreshing such as
+// a personal access token or the GITHUB_TOKEN of a github actions workflow
+type staticToken struct {
+	token   string
+	updates chan Token
+
+	mu        sync.RWMutex
+	rateLimit rateLimit
+	rejected  bool
+}
+
+func NewStaticToken(token string) Provider {
+	return &staticToken{
+		token:     token,
+		updates:   make(chan Token),
+		rateLimit: newRateLimit(),
+	}
+}
+
+func (s *staticToken) Authorize(ctx context.Context, req *http.Request) (Credential, error) {
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	return s, nil
+}
+
+func (s *staticToken) Refresh(ctx context.Context) (Token, error) {
+	return Token{Token: s.token}, nil
+}
+
+func (s *staticToken) Updates() <-chan Token {
+	return s.updates
+}
+
+func (s *staticToken) Expires() bool {
+	return false
+}
+
+func (s *staticToken) Health() []TokenStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	status := TokenStatus{
+		Kind:      "static",
+		Healthy:   !s.rejected,
+		RateLimit: s.rateLimit.limit,
+		Remaining: s.rateLimit.remaining,
+		ResetAt:   s.rateLimit.resetAt,
+	}
+	if s.rejected {
+		status.LastError = "token was rejected by github"
+	}
+	return []TokenStatus{status}
+}
+
+func (s *staticToken) Observe(header http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.rateLimit.update(header) {
+		s.rejected = false
+	}
+}
+
+// Renew can't obtain a new static token, so a 401 is final
+func (s *staticToken) Renew(ctx context.Context) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejected = true
+	return false, nil
+}
@@ -2,30 +2,22 @@ package github
 
 import (
 	"context"
-	"crypto/rsa"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
-	"regexp"
 	"strconv"
-	"sync"
-	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
 )
 
-const (
-	headerAccept = "application/vnd.github+json"
-	headerAPIVer = "2022-11-28"
-)
+const headerAccept = "application/vnd.github+json"
 
 var (
-	ErrAuthentication  = errors.New("github API returned 401")
-	ErrRateLimit       = errors.New("github API rate limit reached")
-	ErrAppNotInstalled = errors.New("github app is not installed")
+	ErrAuthentication = errors.New("github API returned 401")
+	ErrRateLimit      = errors.New("github API rate limit reached")
 
 	defaultStatusAllowedFn = func(status int) bool {
 		if status > 399 {
@@ -33,95 +25,90 @@ var (
 		}
 		return true
 	}
-	reInstallation = regexp.MustCompile("^/app/installations")
 )
 
 type Client interface {
-	SetAccessToken(ctx context.Context) (Token, error)
+	SetAccessToken(ctx context.Context) (auth.Token, error)
+	TokenUpdates() <-chan auth.Token
+	TokenHealth() []auth.TokenStatus
 	ListPublicRepos(ctx context.Context, since int64) (repos []Repository, err error)
 	ListPublicEvents(ctx context.Context, limit, offset int) (events []Event, err error)
 	FetchAttribute(ctx context.Context, url string) (attributes map[string]int64, err error)
+	FetchRepoDetails(ctx context.Context, nodeIDs []string) (details map[string]RepoDetails, err error)
 }
 
 type client struct {
-	innerClient     *http.Client
-	baseURL         string
-	appID           string
-	privateKey      *rsa.PrivateKey
-	canAuthenticate bool
-
-	mu              sync.RWMutex
-	accessToken     *Token
-	tokenRefreshURL string
+	innerClient   *http.Client
+	baseURL       string
+	provider      auth.Provider
+	graphqlBudget *graphqlBudget
 }
 
+// NewClient builds a github API client which authenticates its requests with the given provider.
+// The inner client is expected to come from NewHTTPClient so that github's headers are set
 func NewClient(
-	clientTimeout time.Duration,
+	innerClient *http.Client,
 	baseURL string,
-	githubAppID string,
-	githubPrivateKey *rsa.PrivateKey,
+	provider auth.Provider,
 ) Client {
-	var canAuthenticate bool
-	if githubAppID != "" && githubPrivateKey != nil {
-		canAuthenticate = true
-	}
 	return &client{
-		innerClient:     &http.Client{Timeout: clientTimeout},
-		baseURL:         baseURL,
-		canAuthenticate: canAuthenticate,
-		appID:           githubAppID,
-		privateKey:      githubPrivateKey,
-
-		mu: sync.RWMutex{},
+		innerClient:   innerClient,
+		baseURL:       baseURL,
+		provider:      provider,
+		graphqlBudget: &graphqlBudget{},
 	}
 }
 
-func (c *client) generateJWT() (string, error) {
-	now := time.Now().UTC()
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
-		"iat": now.Unix(),
-		"exp": now.Add(5 * time.Minute).Unix(),
-		"iss": c.appID,
-		"alg": jwt.SigningMethodRS256.Alg(),
-	})
-	return token.SignedString(c.privateKey)
-}
+// do sends the request with the credential chosen by the provider and, if github rejects
+// that credential with a 401, gives the provider one chance to renew it before retrying
+func (c *client) do(
+	req *http.Request,
+	statusAllowedFn func(status int) bool,
+) (res *http.Response, err error) {
+	res, credential, err := c.doOnce(req, statusAllowedFn)
+	if !errors.Is(err, ErrAuthentication) || credential == nil {
+		return res, err
+	}
 
-func (c *client) addAuthHeader(req *http.Request) (err error) {
-	if c.canAuthenticate == false {
-		return nil
+	retry, renewErr := credential.Renew(req.Context())
+	if renewErr != nil {
+		return res, fmt.Errorf("failed to refresh access token after 401: %w", renewErr)
 	}
+	if !retry {
+		return res, err
+	}
+	res, _, err = c.doOnce(req, statusAllowedFn)
+	return res, err
+}
 
-	// installation paths need Json Web tokens
-	if reInstallation.MatchString(req.URL.Path) {
-		jwToken, err := c.generateJWT()
+func (c *client) doOnce(
+	req *http.Request,
+	statusAllowedFn func(status int) bool,
+) (res *http.Response, credential auth.Credential, err error) {
+	req = req.Clone(req.Context())
+	// the request is sent again after a 401, so a request body must be read afresh each time
+	if req.GetBody != nil {
+		req.Body, err = req.GetBody()
 		if err != nil {
-			return fmt.Errorf("failed to generate json web token for app %q: %w", c.appID, err)
+			return res, nil, fmt.Errorf("failed to rewind request body: %w", err)
 		}
-		req.Header.Add("Authorization", "Bearer "+jwToken)
-		return nil
 	}
-
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-	if c.accessToken == nil {
-		return fmt.Errorf("token was not set in client")
+	credential, err = c.provider.Authorize(req.Context(), req)
+	if err != nil {
+		return res, nil, fmt.Errorf("failed to add auth header: %w", err)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+c.accessToken.Token)
-	return nil
+	res, err = c.send(req, statusAllowedFn)
+	if res != nil {
+		credential.Observe(res.Header)
+	}
+	return res, credential, err
 }
 
-func (c *client) do(
+func (c *client) send(
 	req *http.Request,
 	statusAllowedFn func(status int) bool,
 ) (res *http.Response, err error) {
-	if err := c.addAuthHeader(req); err != nil {
-		return res, fmt.Errorf("failed to add auth header for app %q: %w", c.appID, err)
-	}
-
-	req.Header.Add("Accept", headerAccept)
-	req.Header.Add("X-GitHub-Api-Version", headerAPIVer)
 	res, err = c.innerClient.Do(req)
 	if err != nil {
 		return res, fmt.Errorf("failed to do request: %w", err)
@@ -129,8 +116,10 @@ func (c *client) do(
 	if !statusAllowedFn(res.StatusCode) {
 		switch res.StatusCode {
 		case http.StatusUnauthorized:
+			res.Body.Close()
 			return res, ErrAuthentication
 		case http.StatusForbidden:
+			res.Body.Close()
 			return res, ErrRateLimit
 		}
 
@@ -256,72 +245,18 @@ func (c *client) FetchAttribute(ctx context.Context, url string) (attributes map
 	return attributes, nil
 }
 
-func (c *client) SetAccessToken(ctx context.Context) (token Token, err error) {
-	if !c.canAuthenticate {
-		return token, nil
-	}
-
-	if c.tokenRefreshURL == "" {
-		err := c.setTokenRefreshURL(ctx)
-		if err != nil {
-			return token, err
-		}
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenRefreshURL, nil)
-	if err != nil {
-		return token, fmt.Errorf("failed to create request to %s: %w", c.tokenRefreshURL, err)
-	}
-	res, err := c.do(req, defaultStatusAllowedFn)
-	if err != nil {
-		return token, fmt.Errorf("failed to do request to %s: %w", c.tokenRefreshURL, err)
-	}
-
-	b, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return token, fmt.Errorf("failed to unmarshal response from %s: %w", c.tokenRefreshURL, err)
-	}
-	defer res.Body.Close()
-
-	err = json.Unmarshal(b, &token)
-	if err != nil {
-		return token, fmt.Errorf("failed to unmarshal token response: %w", err)
-	}
-
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.accessToken = &token
-	return token, nil
+// SetAccessToken asks the provider for fresh tokens and returns the one which expires first
+func (c *client) SetAccessToken(ctx context.Context) (auth.Token, error) {
+	return c.provider.Refresh(ctx)
 }
 
-func (c *client) setTokenRefreshURL(ctx context.Context) error {
-	path := "/app/installations"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request to %s: %w", path, err)
-	}
-	res, err := c.do(req, defaultStatusAllowedFn)
-	if err != nil {
-		return fmt.Errorf("failed to do request to %s: %w", path, err)
-	}
-
-	b, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal response from %s: %w", path, err)
-	}
-	defer res.Body.Close()
-
-	var installations []Installation
-	err = json.Unmarshal(b, &installations)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
-	}
+// TokenUpdates notifies listeners whenever the client obtains a new access token,
+// regardless of whether the refresh was scheduled or triggered by a 401
+func (c *client) TokenUpdates() <-chan auth.Token {
+	return c.provider.Updates()
+}
 
-	for _, installation := range installations {
-		if strconv.Itoa(installation.AppID) == c.appID {
-			c.tokenRefreshURL = installation.AccessTokensURL
-			return nil
-		}
-	}
-	return ErrAppNotInstalled
+// TokenHealth reports the state and remaining budget of every token the provider holds
+func (c *client) TokenHealth() []auth.TokenStatus {
+	return c.provider.Health()
 }
@@ -9,20 +9,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Scalingo/go-utils/logger"
 	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
 type clientTestSuite struct {
 	suite.Suite
 	server *httptest.Server
-
-	appID      string
-	privateKey *rsa.PrivateKey
-	repos      []github.Repository
+	repos  []github.Repository
 }
 
 func TestClient(t *testing.T) {
@@ -43,6 +44,12 @@ func (s *clientTestSuite) TeardownTest() {
 	s.server.Close()
 }
 
+func testApp(t *testing.T, appID int, keys ...*rsa.PrivateKey) auth.App {
+	ring, err := auth.NewStaticKeyRing(logger.Default(), keys...)
+	require.NoError(t, err)
+	return auth.App{ID: strconv.Itoa(appID), Keys: ring}
+}
+
 func (s *clientTestSuite) TestListRepos_Success() {
 	expectedSince := int64(77777)
 	repoHandlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -55,7 +62,7 @@ func (s *clientTestSuite) TestListRepos_Success() {
 		w.Write(b)
 	})
 	server := httptest.NewServer(repoHandlerFn)
-	client := github.NewClient(500*time.Millisecond, server.URL, s.appID, s.privateKey)
+	client := github.NewClient(&http.Client{Timeout: 500 * time.Millisecond}, server.URL, auth.NewUnauthenticated())
 	repos, err := client.ListPublicRepos(context.Background(), expectedSince)
 	s.NoError(err)
 	s.Require().Len(repos, len(s.repos))
@@ -69,7 +76,7 @@ func (s *clientTestSuite) TestListRepos_InternalServerErrorResponse() {
 		w.Write([]byte("some error code"))
 	})
 	server := httptest.NewServer(repoHandlerFn)
-	client := github.NewClient(500*time.Millisecond, server.URL, s.appID, s.privateKey)
+	client := github.NewClient(&http.Client{Timeout: 500 * time.Millisecond}, server.URL, auth.NewUnauthenticated())
 	_, err := client.ListPublicRepos(context.Background(), int64(2))
 	s.Require().Error(err)
 	s.Regexp(http.StatusInternalServerError, err.Error())
@@ -82,7 +89,7 @@ func (s *clientTestSuite) TestListRepos_ContextCancel() {
 		w.Write([]byte("client hung up before response"))
 	})
 	server := httptest.NewServer(repoHandlerFn)
-	client := github.NewClient(500*time.Millisecond, server.URL, s.appID, s.privateKey)
+	client := github.NewClient(&http.Client{Timeout: 500 * time.Millisecond}, server.URL, auth.NewUnauthenticated())
 	_, err := client.ListPublicRepos(ctx, int64(3333))
 	s.Require().Error(err)
 	s.Regexp("context cancel", err.Error())
@@ -101,7 +108,7 @@ func (s *clientTestSuite) TestListPublicEvents() {
 		w.Write(b)
 	})
 	server := httptest.NewServer(repoHandlerFn)
-	client := github.NewClient(500*time.Millisecond, server.URL, s.appID, s.privateKey)
+	client := github.NewClient(&http.Client{Timeout: 500 * time.Millisecond}, server.URL, auth.NewUnauthenticated())
 	repos, err := client.ListPublicEvents(context.Background(), 50, 1)
 	s.NoError(err)
 	s.Require().Len(repos, 3)
@@ -124,8 +131,239 @@ func (s *clientTestSuite) TestSetAccessToken() {
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	s.Require().NoError(err)
 
-	client := github.NewClient(400*time.Millisecond, server2.URL, strconv.Itoa(appID), privateKey)
+	client := github.NewClient(&http.Client{Timeout: 400 * time.Millisecond}, server2.URL, auth.NewAppInstallation(http.DefaultClient, server2.URL, testApp(s.T(), appID, privateKey)))
 	tok, err := client.SetAccessToken(context.Background())
 	s.NoError(err)
 	s.Equal(someToken, tok.Token)
 }
+
+func (s *clientTestSuite) TestRefreshOn401_RetriesOnceWithSharedRefresh() {
+	appID := 7777
+	var mu sync.Mutex
+	issued := 0
+	current := ""
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		b := []byte(fmt.Sprintf(`[{"app_id":%d, "access_tokens_url":"%s"}]`, appID, server.URL+"/app/installations/1/access_tokens"))
+		w.Write(b)
+	})
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		issued++
+		current = fmt.Sprintf("token-%d", issued)
+		b := []byte(fmt.Sprintf(`{"token":"%s"}`, current))
+		mu.Unlock()
+		// give concurrent callers time to pile up behind the refresh
+		time.Sleep(20 * time.Millisecond)
+		w.Write(b)
+	})
+	mux.HandleFunc("/repositories", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		valid := r.Header.Get("Authorization") == "Bearer "+current
+		mu.Unlock()
+		if !valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[]`))
+	})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	client := github.NewClient(&http.Client{Timeout: time.Second}, server.URL, auth.NewAppInstallation(http.DefaultClient, server.URL, testApp(s.T(), appID, privateKey)))
+	_, err = client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+	<-client.TokenUpdates()
+
+	// simulate github revoking the token early
+	mu.Lock()
+	current = "revoked"
+	mu.Unlock()
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ListPublicRepos(context.Background(), 1)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		s.NoError(err)
+	}
+	s.Equal(2, issued)
+
+	tok := <-client.TokenUpdates()
+	s.Equal("token-2", tok.Token)
+}
+
+func (s *clientTestSuite) TestRefreshOn401_FailsWhenNewTokenIsRejected() {
+	appID := 7777
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		b := []byte(fmt.Sprintf(`[{"app_id":%d, "access_tokens_url":"%s"}]`, appID, server.URL+"/app/installations/1/access_tokens"))
+		w.Write(b)
+	})
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token":"token"}`))
+	})
+	requests := 0
+	mux.HandleFunc("/repositories", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	client := github.NewClient(&http.Client{Timeout: time.Second}, server.URL, auth.NewAppInstallation(http.DefaultClient, server.URL, testApp(s.T(), appID, privateKey)))
+	_, err = client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+
+	_, err = client.ListPublicRepos(context.Background(), 1)
+	s.Require().Error(err)
+	s.ErrorIs(err, github.ErrAuthentication)
+	s.Equal(2, requests)
+}
+
+func (s *clientTestSuite) TestTokenPool_RoutesToTokenWithMostBudget() {
+	appID := 7777
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		b := []byte(fmt.Sprintf(`[
+			{"id":1, "app_id":%d, "access_tokens_url":"%s", "account":{"login":"org-a"}},
+			{"id":2, "app_id":%d, "access_tokens_url":"%s", "account":{"login":"org-b"}}
+		]`, appID, server.URL+"/app/installations/1/access_tokens", appID, server.URL+"/app/installations/2/access_tokens"))
+		w.Write(b)
+	})
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf(`{"token":"token-a","expires_at":"%s"}`, expiresAt)))
+	})
+	mux.HandleFunc("/app/installations/2/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf(`{"token":"token-b","expires_at":"%s"}`, expiresAt)))
+	})
+
+	var mu sync.Mutex
+	used := map[string]int{}
+	remaining := map[string]int{"Bearer token-a": 10, "Bearer token-b": 4000}
+	mux.HandleFunc("/repositories", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auth := r.Header.Get("Authorization")
+		used[auth]++
+		remaining[auth]--
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining[auth]))
+		mu.Unlock()
+		w.Write([]byte(`[]`))
+	})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	client := github.NewClient(&http.Client{Timeout: time.Second}, server.URL, auth.NewAppInstallation(http.DefaultClient, server.URL, testApp(s.T(), appID, privateKey)))
+	_, err = client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+
+	// both tokens start with the default budget, once the first response reveals
+	// that token-a is nearly exhausted every following request should use token-b
+	for i := 0; i < 5; i++ {
+		_, err := client.ListPublicRepos(context.Background(), 1)
+		s.Require().NoError(err)
+	}
+	s.Equal(1, used["Bearer token-a"])
+	s.Equal(4, used["Bearer token-b"])
+
+	health := client.TokenHealth()
+	s.Require().Len(health, 2)
+	for _, status := range health {
+		switch status.InstallationID {
+		case 1:
+			s.Equal("org-a", status.Account)
+			s.True(status.Healthy)
+			s.Equal(9, status.Remaining)
+		case 2:
+			s.Equal("org-b", status.Account)
+			s.True(status.Healthy)
+			s.Equal(3996, status.Remaining)
+		}
+	}
+}
+
+func (s *clientTestSuite) TestTokenPool_KeepsTokenWhenRefreshFails() {
+	appID := 7777
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		b := []byte(fmt.Sprintf(`[{"id":1, "app_id":%d, "access_tokens_url":"%s"}]`, appID, server.URL+"/app/installations/1/access_tokens"))
+		w.Write(b)
+	})
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	failing := false
+	mux.HandleFunc("/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(`{"token":"token","expires_at":"%s"}`, expiresAt)))
+	})
+	mux.HandleFunc("/repositories", func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(`[]`))
+	})
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	client := github.NewClient(&http.Client{Timeout: time.Second}, server.URL, auth.NewAppInstallation(http.DefaultClient, server.URL, testApp(s.T(), appID, privateKey)))
+	_, err = client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+
+	// the token endpoint fails once, the token which hasn't expired keeps being used
+	failing = true
+	token, err := client.SetAccessToken(context.Background())
+	s.Error(err)
+	s.Equal("token", token.Token)
+	_, err = client.ListPublicRepos(context.Background(), 1)
+	s.NoError(err)
+
+	health := client.TokenHealth()
+	s.Require().Len(health, 1)
+	s.False(health[0].Healthy)
+	s.NotEmpty(health[0].LastError)
+}
+
+func (s *clientTestSuite) TestStaticToken() {
+	requests := 0
+	handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "Bearer personal-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-RateLimit-Remaining", "4321")
+		w.Write([]byte(`[]`))
+	})
+	server := httptest.NewServer(handlerFn)
+
+	client := github.NewClient(&http.Client{Timeout: time.Second}, server.URL, auth.NewStaticToken("personal-token"))
+	_, err := client.ListPublicRepos(context.Background(), 1)
+	s.NoError(err)
+	health := client.TokenHealth()
+	s.Require().Len(health, 1)
+	s.True(health[0].Healthy)
+	s.Equal(4321, health[0].Remaining)
+
+	// a static token can't be renewed so a 401 must not be retried
+	client = github.NewClient(&http.Client{Timeout: time.Second}, server.URL, auth.NewStaticToken("revoked-token"))
+	_, err = client.ListPublicRepos(context.Background(), 1)
+	s.ErrorIs(err, github.ErrAuthentication)
+	s.Equal(2, requests)
+	s.False(client.TokenHealth()[0].Healthy)
+}
@@ -0,0 +1,154 @@
+package github_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/stretchr/testify/suite"
+)
+
+// enterpriseTestSuite runs the client against a stand-in for a GitHub Enterprise Server
+// instance which serves its API under /api/v3 with a certificate from a private CA
+type enterpriseTestSuite struct {
+	suite.Suite
+	ghes     *httptest.Server
+	caBundle string
+	versions chan string
+}
+
+func TestEnterprise(t *testing.T) {
+	suite.Run(t, new(enterpriseTestSuite))
+}
+
+func (s *enterpriseTestSuite) SetupTest() {
+	s.versions = make(chan string, 10)
+	appID := 7777
+
+	mux := http.NewServeMux()
+	s.ghes = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.versions <- r.Header.Get("X-GitHub-Api-Version")
+		mux.ServeHTTP(w, r)
+	}))
+	mux.HandleFunc("/api/v3/app/installations", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf(`[{"id":1, "app_id":%d, "access_tokens_url":"%s"}]`, appID, s.ghes.URL+"/api/v3/app/installations/1/access_tokens")))
+	})
+	mux.HandleFunc("/api/v3/app/installations/1/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token":"ghes-token"}`))
+	})
+	mux.HandleFunc("/api/v3/events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer ghes-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`[{"type":"CreateEvent","repo":{"id":42},"payload":{"ref_type":"repository"}}]`))
+	})
+	mux.HandleFunc("/api/v3/repositories", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprintf(`[{"id":42,"name":"repo","languages_url":"%s"}]`, s.ghes.URL+"/api/v3/repos/org/repo/languages")))
+	})
+	mux.HandleFunc("/api/v3/repos/org/repo/languages", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Go": 1234}`))
+	})
+
+	s.caBundle = filepath.Join(s.T().TempDir(), "ca.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ghes.Certificate().Raw})
+	s.Require().NoError(os.WriteFile(s.caBundle, pemBytes, 0600))
+}
+
+func (s *enterpriseTestSuite) TeardownTest() {
+	s.ghes.Close()
+}
+
+func (s *enterpriseTestSuite) TestNormalizeBaseURL() {
+	for raw, expected := range map[string]string{
+		"https://api.github.com":          "https://api.github.com",
+		"https://ghes.example.com":        "https://ghes.example.com/api/v3",
+		"https://ghes.example.com/":       "https://ghes.example.com/api/v3",
+		"https://ghes.example.com/api/v3": "https://ghes.example.com/api/v3",
+		"https://example.com/proxy/gh":    "https://example.com/proxy/gh",
+	} {
+		normalized, err := github.NormalizeBaseURL(raw)
+		s.NoError(err)
+		s.Equal(expected, normalized, raw)
+	}
+
+	_, err := github.NormalizeBaseURL("ghes.example.com")
+	s.Error(err)
+}
+
+func (s *enterpriseTestSuite) TestSearchFlowAgainstEnterpriseServer() {
+	httpClient, err := github.NewHTTPClient(github.TransportConfig{
+		Timeout:     time.Second,
+		CABundle:    s.caBundle,
+		APIVersion:  "2022-11-28",
+		APIVersions: map[string]string{"127.0.0.1": "2022-08-09"},
+	})
+	s.Require().NoError(err)
+
+	baseURL, err := github.NormalizeBaseURL(s.ghes.URL)
+	s.Require().NoError(err)
+	s.Equal(s.ghes.URL+"/api/v3", baseURL)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	provider := auth.NewAppInstallation(httpClient, baseURL, testApp(s.T(), 7777, privateKey))
+	client := github.NewClient(httpClient, baseURL, provider)
+
+	_, err = client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+
+	events, err := client.ListPublicEvents(context.Background(), 100, 0)
+	s.Require().NoError(err)
+	s.Require().Len(events, 1)
+	s.Equal(int64(42), events[0].Repo.ID)
+
+	repos, err := client.ListPublicRepos(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Require().Len(repos, 1)
+
+	languages, err := client.FetchAttribute(context.Background(), repos[0].LanguagesURL)
+	s.Require().NoError(err)
+	s.Equal(int64(1234), languages["Go"])
+
+	close(s.versions)
+	for version := range s.versions {
+		s.Equal("2022-08-09", version)
+	}
+}
+
+func (s *enterpriseTestSuite) TestUntrustedCertificate() {
+	httpClient, err := github.NewHTTPClient(github.TransportConfig{Timeout: time.Second})
+	s.Require().NoError(err)
+
+	client := github.NewClient(httpClient, s.ghes.URL+"/api/v3", auth.NewUnauthenticated())
+	_, err = client.ListPublicRepos(context.Background(), 0)
+	s.Require().Error(err)
+	s.Regexp("certificate", err.Error())
+}
+
+func (s *enterpriseTestSuite) TestProxy() {
+	proxied := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied <- r.URL.String()
+		w.Write([]byte(`[]`))
+	}))
+	defer proxy.Close()
+
+	httpClient, err := github.NewHTTPClient(github.TransportConfig{Timeout: time.Second, ProxyURL: proxy.URL})
+	s.Require().NoError(err)
+
+	client := github.NewClient(httpClient, "http://ghes.internal/api/v3", auth.NewUnauthenticated())
+	_, err = client.ListPublicRepos(context.Background(), 5)
+	s.Require().NoError(err)
+	s.Equal("http://ghes.internal/api/v3/repositories?since=5", <-proxied)
+}
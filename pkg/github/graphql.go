@@ -0,0 +1,260 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxNodesPerQuery is the most IDs github accepts in a single nodes(ids:) lookup
+	maxNodesPerQuery = 100
+	// maxQueryCost caps the rate limit points a single query may spend
+	maxQueryCost = 10
+
+	languagesPerRepo = 20
+	topicsPerRepo    = 20
+)
+
+var repoDetailsQuery = fmt.Sprintf(`query($ids: [ID!]!) {
+  rateLimit { cost remaining resetAt }
+  nodes(ids: $ids) {
+    ... on Repository {
+      id
+      createdAt
+      stargazerCount
+      licenseInfo { spdxId }
+      repositoryTopics(first: %d) { nodes { topic { name } } }
+      languages(first: %d, orderBy: {field: SIZE, direction: DESC}) { edges { size node { name } } }
+    }
+  }
+}`, topicsPerRepo, languagesPerRepo)
+
+// RepoDetails holds the attributes fetched for a repository through the GraphQL API
+type RepoDetails struct {
+	NodeID    string
+	CreatedAt time.Time
+	Stars     int
+	License   string
+	Topics    []string
+	Languages map[string]int64
+}
+
+type graphqlRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphqlError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type graphqlRepoNode struct {
+	ID             string    `json:"id"`
+	CreatedAt      time.Time `json:"createdAt"`
+	StargazerCount int       `json:"stargazerCount"`
+	LicenseInfo    *struct {
+		SpdxID string `json:"spdxId"`
+	} `json:"licenseInfo"`
+	RepositoryTopics struct {
+		Nodes []struct {
+			Topic struct {
+				Name string `json:"name"`
+			} `json:"topic"`
+		} `json:"nodes"`
+	} `json:"repositoryTopics"`
+	Languages struct {
+		Edges []struct {
+			Size int64 `json:"size"`
+			Node struct {
+				Name string `json:"name"`
+			} `json:"node"`
+		} `json:"edges"`
+	} `json:"languages"`
+}
+
+type graphqlRepoResponse struct {
+	Data struct {
+		RateLimit struct {
+			Cost      int       `json:"cost"`
+			Remaining int       `json:"remaining"`
+			ResetAt   time.Time `json:"resetAt"`
+		} `json:"rateLimit"`
+		// nodes that couldn't be resolved, eg. deleted repositories, come back as null
+		Nodes []*graphqlRepoNode `json:"nodes"`
+	} `json:"data"`
+	Errors []graphqlError `json:"errors"`
+}
+
+// graphqlBudget tracks the GraphQL rate limit, which is counted in points rather than requests
+// and separately from the REST API, to size batches so that a query never outspends it
+type graphqlBudget struct {
+	mu        sync.Mutex
+	known     bool
+	remaining int
+	resetAt   time.Time
+	// costFactor corrects the cost estimate with what github actually charged
+	costFactor float64
+}
+
+// baseCost follows github's documented formula: one request for the nodes lookup plus
+// one per repository for each nested connection, divided by 100 and rounded up
+func baseCost(batch int) float64 {
+	requests := 1 + batch*2
+	return math.Max(1, math.Ceil(float64(requests)/100))
+}
+
+func (b *graphqlBudget) estimateCost(batch int) int {
+	return int(math.Ceil(baseCost(batch) * b.factor()))
+}
+
+func (b *graphqlBudget) factor() float64 {
+	if b.costFactor == 0 {
+		return 1
+	}
+	return b.costFactor
+}
+
+// batchSize picks the largest batch whose estimated cost fits both the per query cap
+// and what is left of the budget, zero means the budget is spent until resetAt
+func (b *graphqlBudget) batchSize(pending int) (size int, resetAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	limit := maxQueryCost
+	if b.known && time.Now().Before(b.resetAt) && b.remaining < limit {
+		limit = b.remaining
+	}
+
+	for n := 1; n <= pending && n <= maxNodesPerQuery; n++ {
+		if b.estimateCost(n) > limit {
+			break
+		}
+		size = n
+	}
+	return size, b.resetAt
+}
+
+func (b *graphqlBudget) observe(batch, cost, remaining int, resetAt time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.known = true
+	b.remaining = remaining
+	b.resetAt = resetAt
+	if cost > 0 {
+		b.costFactor = math.Max(1, float64(cost)/baseCost(batch))
+	}
+}
+
+// FetchRepoDetails looks up languages, stars, license and topics of many repositories at once
+// through the GraphQL API, saving the request per repository the REST API needs for languages.
+// Repositories github can't resolve are left out of the result
+// https://docs.github.com/en/graphql/reference/queries#nodes
+func (c *client) FetchRepoDetails(ctx context.Context, nodeIDs []string) (details map[string]RepoDetails, err error) {
+	details = make(map[string]RepoDetails, len(nodeIDs))
+	for len(nodeIDs) > 0 {
+		size, resetAt := c.graphqlBudget.batchSize(len(nodeIDs))
+		if size == 0 {
+			return details, fmt.Errorf("graphql budget spent until %s: %w", resetAt, ErrRateLimit)
+		}
+
+		err = c.fetchRepoDetailsBatch(ctx, nodeIDs[:size], details)
+		if err != nil {
+			return details, err
+		}
+		nodeIDs = nodeIDs[size:]
+	}
+	return details, nil
+}
+
+func (c *client) fetchRepoDetailsBatch(ctx context.Context, nodeIDs []string, details map[string]RepoDetails) error {
+	body, err := json.Marshal(graphqlRequest{
+		Query:     repoDetailsQuery,
+		Variables: map[string]interface{}{"ids": nodeIDs},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal graphql query: %w", err)
+	}
+
+	endpoint := graphqlURL(c.baseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request to %s: %w", endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.do(req, defaultStatusAllowedFn)
+	if err != nil {
+		return fmt.Errorf("failed to do request to %s: %w", endpoint, err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read graphql response body: %w", err)
+	}
+	defer res.Body.Close()
+
+	var out graphqlRepoResponse
+	err = json.Unmarshal(b, &out)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal graphql response: %w", err)
+	}
+
+	// a NOT_FOUND error accompanies every node which came back as null, anything else is fatal
+	for _, gqlErr := range out.Errors {
+		switch gqlErr.Type {
+		case "NOT_FOUND":
+			continue
+		case "RATE_LIMITED":
+			return fmt.Errorf("%s: %w", gqlErr.Message, ErrRateLimit)
+		default:
+			return fmt.Errorf("graphql query failed: %s", gqlErr.Message)
+		}
+	}
+
+	rateLimit := out.Data.RateLimit
+	c.graphqlBudget.observe(len(nodeIDs), rateLimit.Cost, rateLimit.Remaining, rateLimit.ResetAt)
+
+	for _, node := range out.Data.Nodes {
+		if node == nil {
+			continue
+		}
+		details[node.ID] = node.details()
+	}
+	return nil
+}
+
+func (n *graphqlRepoNode) details() RepoDetails {
+	details := RepoDetails{
+		NodeID:    n.ID,
+		CreatedAt: n.CreatedAt,
+		Stars:     n.StargazerCount,
+		Languages: make(map[string]int64, len(n.Languages.Edges)),
+	}
+	if n.LicenseInfo != nil {
+		details.License = n.LicenseInfo.SpdxID
+	}
+	for _, topic := range n.RepositoryTopics.Nodes {
+		details.Topics = append(details.Topics, topic.Topic.Name)
+	}
+	for _, edge := range n.Languages.Edges {
+		details.Languages[edge.Node.Name] = edge.Size
+	}
+	return details
+}
+
+// graphqlURL derives the GraphQL endpoint from the REST base url,
+// GitHub Enterprise Server serves it under /api/graphql rather than /api/v3/graphql
+func graphqlURL(baseURL string) string {
+	if strings.HasSuffix(baseURL, enterprisePathPrefix) {
+		return strings.TrimSuffix(baseURL, enterprisePathPrefix) + "/api/graphql"
+	}
+	return baseURL + "/graphql"
+}
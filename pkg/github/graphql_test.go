@@ -0,0 +1,174 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/stretchr/testify/suite"
+)
+
+type graphqlTestSuite struct {
+	suite.Suite
+}
+
+func TestGraphQL(t *testing.T) {
+	suite.Run(t, new(graphqlTestSuite))
+}
+
+func (s *graphqlTestSuite) fixture(name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	s.Require().NoError(err)
+	return b
+}
+
+type graphqlQuery struct {
+	Query     string `json:"query"`
+	Variables struct {
+		IDs []string `json:"ids"`
+	} `json:"variables"`
+}
+
+// batchServer answers every nodes(ids:) query with an empty repository per ID and records
+// the size of each batch, remaining sets the budget reported after each query
+func (s *graphqlTestSuite) batchServer(remaining func(batch int) int) (*httptest.Server, func() []int) {
+	var mu sync.Mutex
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/graphql", r.URL.Path)
+		s.Equal(http.MethodPost, r.Method)
+
+		var query graphqlQuery
+		s.Require().NoError(json.NewDecoder(r.Body).Decode(&query))
+		mu.Lock()
+		batches = append(batches, len(query.Variables.IDs))
+		batch := len(batches)
+		mu.Unlock()
+
+		nodes := make([]map[string]interface{}, 0, len(query.Variables.IDs))
+		for _, ID := range query.Variables.IDs {
+			nodes = append(nodes, map[string]interface{}{"id": ID})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"rateLimit": map[string]interface{}{
+					"cost":      1,
+					"remaining": remaining(batch),
+					"resetAt":   time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+				},
+				"nodes": nodes,
+			},
+		})
+	}))
+	return server, func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return batches
+	}
+}
+
+func nodeIDs(count int) []string {
+	IDs := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		IDs = append(IDs, fmt.Sprintf("R_%d", i))
+	}
+	return IDs
+}
+
+func (s *graphqlTestSuite) TestFetchRepoDetails_ParsesFixture() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var query graphqlQuery
+		s.Require().NoError(json.NewDecoder(r.Body).Decode(&query))
+		s.Equal([]string{"R_kgDOLtj0ZQ", "R_kgDOLtj0Zg", "R_deleted"}, query.Variables.IDs)
+		s.Contains(query.Query, "nodes(ids: $ids)")
+		s.Equal("Bearer token", r.Header.Get("Authorization"))
+		w.Write(s.fixture("graphql_repo_details.json"))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(http.DefaultClient, server.URL, auth.NewStaticToken("token"))
+	details, err := client.FetchRepoDetails(context.Background(), []string{"R_kgDOLtj0ZQ", "R_kgDOLtj0Zg", "R_deleted"})
+	s.Require().NoError(err)
+
+	s.Require().Len(details, 2)
+	s.Equal(github.RepoDetails{
+		NodeID:    "R_kgDOLtj0ZQ",
+		CreatedAt: time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC),
+		Stars:     42,
+		License:   "MIT",
+		Topics:    []string{"cli", "golang"},
+		Languages: map[string]int64{"Go": 6469, "Makefile": 564},
+	}, details["R_kgDOLtj0ZQ"])
+	s.Empty(details["R_kgDOLtj0Zg"].License)
+	s.Empty(details["R_kgDOLtj0Zg"].Languages)
+}
+
+func (s *graphqlTestSuite) TestFetchRepoDetails_BatchesByHundred() {
+	server, batches := s.batchServer(func(int) int { return 5000 })
+	defer server.Close()
+
+	client := github.NewClient(http.DefaultClient, server.URL, auth.NewStaticToken("token"))
+	details, err := client.FetchRepoDetails(context.Background(), nodeIDs(250))
+	s.Require().NoError(err)
+	s.Len(details, 250)
+	s.Equal([]int{100, 100, 50}, batches())
+}
+
+func (s *graphqlTestSuite) TestFetchRepoDetails_ShrinksBatchesWhenBudgetRunsLow() {
+	// a batch of 100 costs 3 points, 49 is the most that fits in a single point
+	server, batches := s.batchServer(func(batch int) int {
+		if batch == 1 {
+			return 1
+		}
+		return 5000
+	})
+	defer server.Close()
+
+	client := github.NewClient(http.DefaultClient, server.URL, auth.NewStaticToken("token"))
+	_, err := client.FetchRepoDetails(context.Background(), nodeIDs(200))
+	s.Require().NoError(err)
+	s.Equal([]int{100, 49, 51}, batches())
+}
+
+func (s *graphqlTestSuite) TestFetchRepoDetails_StopsWhenBudgetIsSpent() {
+	server, batches := s.batchServer(func(int) int { return 0 })
+	defer server.Close()
+
+	client := github.NewClient(http.DefaultClient, server.URL, auth.NewStaticToken("token"))
+	details, err := client.FetchRepoDetails(context.Background(), nodeIDs(150))
+	s.ErrorIs(err, github.ErrRateLimit)
+	s.Len(details, 100)
+	s.Equal([]int{100}, batches())
+}
+
+func (s *graphqlTestSuite) TestFetchRepoDetails_RateLimitedError() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(s.fixture("graphql_rate_limited.json"))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(http.DefaultClient, server.URL, auth.NewStaticToken("token"))
+	_, err := client.FetchRepoDetails(context.Background(), nodeIDs(1))
+	s.ErrorIs(err, github.ErrRateLimit)
+}
+
+func (s *graphqlTestSuite) TestFetchRepoDetails_EnterpriseEndpoint() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/api/graphql", r.URL.Path)
+		w.Write(s.fixture("graphql_repo_details.json"))
+	}))
+	defer server.Close()
+
+	client := github.NewClient(http.DefaultClient, server.URL+"/api/v3", auth.NewStaticToken("token"))
+	_, err := client.FetchRepoDetails(context.Background(), nodeIDs(1))
+	s.NoError(err)
+}
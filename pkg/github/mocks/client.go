@@ -14,6 +14,7 @@ import (
 	reflect "reflect"
 
 	github "github.com/laouji/git-repo-searcher/pkg/github"
+	auth "github.com/laouji/git-repo-searcher/pkg/github/auth"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -55,6 +56,21 @@ func (mr *MockClientMockRecorder) FetchAttribute(ctx, url any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchAttribute", reflect.TypeOf((*MockClient)(nil).FetchAttribute), ctx, url)
 }
 
+// FetchRepoDetails mocks base method.
+func (m *MockClient) FetchRepoDetails(ctx context.Context, nodeIDs []string) (map[string]github.RepoDetails, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchRepoDetails", ctx, nodeIDs)
+	ret0, _ := ret[0].(map[string]github.RepoDetails)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchRepoDetails indicates an expected call of FetchRepoDetails.
+func (mr *MockClientMockRecorder) FetchRepoDetails(ctx, nodeIDs any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchRepoDetails", reflect.TypeOf((*MockClient)(nil).FetchRepoDetails), ctx, nodeIDs)
+}
+
 // ListPublicEvents mocks base method.
 func (m *MockClient) ListPublicEvents(ctx context.Context, limit, offset int) ([]github.Event, error) {
 	m.ctrl.T.Helper()
@@ -86,10 +102,10 @@ func (mr *MockClientMockRecorder) ListPublicRepos(ctx, since any) *gomock.Call {
 }
 
 // SetAccessToken mocks base method.
-func (m *MockClient) SetAccessToken(ctx context.Context) (github.Token, error) {
+func (m *MockClient) SetAccessToken(ctx context.Context) (auth.Token, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "SetAccessToken", ctx)
-	ret0, _ := ret[0].(github.Token)
+	ret0, _ := ret[0].(auth.Token)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -99,3 +115,31 @@ func (mr *MockClientMockRecorder) SetAccessToken(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAccessToken", reflect.TypeOf((*MockClient)(nil).SetAccessToken), ctx)
 }
+
+// TokenHealth mocks base method.
+func (m *MockClient) TokenHealth() []auth.TokenStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TokenHealth")
+	ret0, _ := ret[0].([]auth.TokenStatus)
+	return ret0
+}
+
+// TokenHealth indicates an expected call of TokenHealth.
+func (mr *MockClientMockRecorder) TokenHealth() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TokenHealth", reflect.TypeOf((*MockClient)(nil).TokenHealth))
+}
+
+// TokenUpdates mocks base method.
+func (m *MockClient) TokenUpdates() <-chan auth.Token {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TokenUpdates")
+	ret0, _ := ret[0].(<-chan auth.Token)
+	return ret0
+}
+
+// TokenUpdates indicates an expected call of TokenUpdates.
+func (mr *MockClientMockRecorder) TokenUpdates() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TokenUpdates", reflect.TypeOf((*MockClient)(nil).TokenUpdates))
+}
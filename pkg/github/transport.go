@@ -0,0 +1,111 @@
+package github
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	publicAPIHost = "api.github.com"
+	// enterprisePathPrefix is where GitHub Enterprise Server serves the REST API
+	enterprisePathPrefix = "/api/v3"
+)
+
+// TransportConfig describes how to reach the github instance
+type TransportConfig struct {
+	Timeout time.Duration
+	// CABundle is the path of a PEM file with extra certificate authorities to trust,
+	// typically needed for GitHub Enterprise Server instances using an internal CA
+	CABundle string
+	// ProxyURL overrides the proxy picked up from the HTTP_PROXY / HTTPS_PROXY environment variables
+	ProxyURL string
+	// APIVersion is sent in the X-GitHub-Api-Version header unless APIVersions has an entry for the host
+	APIVersion  string
+	APIVersions map[string]string
+}
+
+// NewHTTPClient builds the http client shared by the API client and the auth providers
+func NewHTTPClient(cfg TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.CABundle != "" {
+		pemBytes, err := ioutil.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %w", cfg.CABundle, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", cfg.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy url %s: %w", cfg.ProxyURL, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &headerTransport{
+			next:        transport,
+			apiVersion:  cfg.APIVersion,
+			apiVersions: cfg.APIVersions,
+		},
+	}, nil
+}
+
+// headerTransport adds the headers github expects on every request, with the
+// API version depending on the host since enterprise servers lag behind github.com
+type headerTransport struct {
+	next        http.RoundTripper
+	apiVersion  string
+	apiVersions map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", headerAccept)
+	}
+
+	version, ok := t.apiVersions[req.URL.Hostname()]
+	if !ok {
+		version = t.apiVersion
+	}
+	// older enterprise servers reject versions they don't know, so an empty version omits the header
+	if version != "" {
+		req.Header.Set("X-GitHub-Api-Version", version)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// NormalizeBaseURL appends the /api/v3 prefix GitHub Enterprise Server serves its API under,
+// so that the host of an enterprise instance can be configured on its own
+func NormalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse github url %s: %w", raw, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("github url %q must be absolute", raw)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if u.Hostname() != publicAPIHost && u.Path == "" {
+		u.Path = enterprisePathPrefix
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,60 @@
+package githubtest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+)
+
+// recordedBaseURL is the API url found in the recorded responses, the fake swaps it for its own
+const recordedBaseURL = "https://api.github.com"
+
+// recorded are responses of the public API recorded for a few repositories created in a row
+//
+//go:embed recorded.json
+var recorded []byte
+
+// Fixtures is the state the fake starts from. It is written the way github answers
+// so that recorded responses can be pasted as they are
+type Fixtures struct {
+	// Events are listed newest first, as /events returns them
+	Events       []github.Event      `json:"events"`
+	Repositories []github.Repository `json:"repositories"`
+	// Languages are keyed by the full name of the repositories
+	Languages     map[string]map[string]int64 `json:"languages"`
+	Installations []auth.Installation         `json:"installations"`
+}
+
+// Recorded returns the fixtures the package comes with
+func Recorded() Fixtures {
+	fixtures, err := parseFixtures(recorded)
+	if err != nil {
+		panic(err)
+	}
+	return fixtures
+}
+
+// LoadFixtures reads fixtures from a JSON file
+func LoadFixtures(path string) (Fixtures, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("failed to read fixtures %s: %w", path, err)
+	}
+	fixtures, err := parseFixtures(b)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("failed to parse fixtures %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+func parseFixtures(b []byte) (fixtures Fixtures, err error) {
+	err = json.Unmarshal(b, &fixtures)
+	if err != nil {
+		return fixtures, fmt.Errorf("failed to unmarshal fixtures: %w", err)
+	}
+	return fixtures, nil
+}
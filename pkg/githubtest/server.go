@@ -0,0 +1,459 @@
+package githubtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+)
+
+const (
+	// enterprisePathPrefix is where a GitHub Enterprise Server serves its API, the fake answers with or without it
+	enterprisePathPrefix = "/api/v3"
+
+	installationTokenPrefix = "ghs_"
+
+	defaultRateLimit = 5000
+	defaultPerPage   = 30
+	maxPerPage       = 100
+	reposPerPage     = 100
+)
+
+var (
+	languagesPath    = regexp.MustCompile(`^/repos/([^/]+)/([^/]+)/languages$`)
+	accessTokensPath = regexp.MustCompile(`^/app/installations/(\d+)/access_tokens$`)
+)
+
+// Response is a scripted answer which is handed out in place of the fake's own
+type Response struct {
+	Status int
+	Header http.Header
+	Body   string
+	// Delay holds the response back, unless the client gives up first
+	Delay time.Duration
+}
+
+// RateLimited is the answer github gives once the rate limit is reached, until reset
+func RateLimited(reset time.Time) Response {
+	header := http.Header{}
+	header.Set("X-RateLimit-Remaining", "0")
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	header.Set("X-RateLimit-Resource", "core")
+	return Response{Status: http.StatusForbidden, Header: header, Body: `{"message":"API rate limit exceeded"}`}
+}
+
+// Error is an answer with the status and github's error body
+func Error(status int) Response {
+	return Response{Status: status, Body: fmt.Sprintf(`{"message":%q}`, http.StatusText(status))}
+}
+
+// budget counts the requests made with a credential in the current rate limit window
+type budget struct {
+	used  int
+	reset time.Time
+}
+
+// Server is a stateful fake of the endpoints of the github API the service uses: /events,
+// /repositories, the languages of the repositories, and the installations of github apps with
+// their access tokens. Requests are counted against a rate limit per credential like github does,
+// and scripted responses can be injected to play errors
+type Server struct {
+	URL    string
+	server *httptest.Server
+
+	mu            sync.Mutex
+	events        []github.Event
+	repos         []github.Repository
+	languages     map[string]map[string]int64
+	installations []auth.Installation
+	// tokens are the installation tokens handed out with their expiry
+	tokens   map[string]time.Time
+	issued   int
+	tokenTTL time.Duration
+
+	limit   int
+	window  time.Duration
+	budgets map[string]*budget
+
+	scripts  map[string][]Response
+	requests map[string]int
+}
+
+// NewServer starts a fake serving the fixtures, the url of the recorded responses is replaced with its own
+func NewServer(fixtures Fixtures) *Server {
+	s := &Server{
+		events:        append([]github.Event(nil), fixtures.Events...),
+		repos:         append([]github.Repository(nil), fixtures.Repositories...),
+		languages:     make(map[string]map[string]int64, len(fixtures.Languages)),
+		installations: append([]auth.Installation(nil), fixtures.Installations...),
+		tokens:        make(map[string]time.Time),
+		tokenTTL:      time.Hour,
+		limit:         defaultRateLimit,
+		window:        time.Hour,
+		budgets:       make(map[string]*budget),
+		scripts:       make(map[string][]Response),
+		requests:      make(map[string]int),
+	}
+	for fullName, languages := range fixtures.Languages {
+		s.languages[fullName] = languages
+	}
+	sort.Slice(s.repos, func(i, j int) bool { return s.repos[i].ID < s.repos[j].ID })
+
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// SetRateLimit sets how many requests each credential can make per window, the counts start over
+func (s *Server) SetRateLimit(limit int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.window = window
+	s.budgets = make(map[string]*budget)
+}
+
+// SetTokenTTL sets how long the installation tokens handed out from now on are valid
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTTL = ttl
+}
+
+// RevokeTokens rejects every installation token handed out so far, as github does once they expired
+func (s *Server) RevokeTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = make(map[string]time.Time)
+}
+
+// IssuedTokens is the number of installation tokens handed out
+func (s *Server) IssuedTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+// Script queues responses for the path, they are handed out one per request before the fake answers again
+func (s *Server) Script(path string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[path] = append(s.scripts[path], responses...)
+}
+
+// Requests is the number of requests made to the path, scripted ones included
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// CreateRepository adds a repository after the newest one, along with the event of its creation
+func (s *Server) CreateRepository(owner, name string, languages map[string]int64) github.Repository {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var id int64 = 1
+	if len(s.repos) > 0 {
+		id = s.repos[len(s.repos)-1].ID + 1
+	}
+	fullName := owner + "/" + name
+	repo := github.Repository{
+		ID:           id,
+		Name:         name,
+		FullName:     fullName,
+		Owner:        github.Owner{Login: owner, Type: "User", URL: s.URL + "/users/" + owner},
+		HTMLURL:      "https://github.com/" + fullName,
+		URL:          s.URL + "/repos/" + fullName,
+		LanguagesURL: s.URL + "/repos/" + fullName + "/languages",
+	}
+	s.repos = append(s.repos, repo)
+	if len(languages) > 0 {
+		s.languages[fullName] = languages
+	}
+
+	event := github.Event{
+		ID:        strconv.FormatInt(id, 10),
+		Type:      "CreateEvent",
+		Actor:     github.Actor{Login: owner, DisplayLogin: owner},
+		Repo:      github.Repo{ID: id, Name: fullName, URL: repo.URL},
+		Payload:   github.Payload{RefType: "repository"},
+		Public:    true,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	s.events = append([]github.Event{event}, s.events...)
+	return repo
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, enterprisePathPrefix)
+
+	s.mu.Lock()
+	s.requests[path]++
+	response, scripted := s.nextScripted(path)
+	s.mu.Unlock()
+	if scripted {
+		s.writeScripted(w, r, response)
+		return
+	}
+
+	// the app endpoints are authenticated with the app's json web token rather than a token
+	if path == "/app/installations" && r.Method == http.MethodGet {
+		s.listInstallations(w, r)
+		return
+	}
+	if match := accessTokensPath.FindStringSubmatch(path); match != nil && r.Method == http.MethodPost {
+		s.createAccessToken(w, r, match[1])
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		s.writeMessage(w, http.StatusNotFound, "")
+		return
+	}
+	if !s.authorize(w, r) {
+		return
+	}
+	switch {
+	case path == "/events":
+		s.listEvents(w, r)
+	case path == "/repositories":
+		s.listRepositories(w, r)
+	case languagesPath.MatchString(path):
+		match := languagesPath.FindStringSubmatch(path)
+		s.listLanguages(w, match[1]+"/"+match[2])
+	default:
+		s.writeMessage(w, http.StatusNotFound, "")
+	}
+}
+
+func (s *Server) nextScripted(path string) (Response, bool) {
+	queue := s.scripts[path]
+	if len(queue) == 0 {
+		return Response{}, false
+	}
+	s.scripts[path] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) writeScripted(w http.ResponseWriter, r *http.Request, response Response) {
+	if response.Delay > 0 {
+		select {
+		case <-time.After(response.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	for key, values := range response.Header {
+		w.Header()[key] = values
+	}
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(response.Body))
+}
+
+// authorize rejects the installation tokens it didn't hand out or which expired, and counts the
+// request against the rate limit of its credential. Anonymous requests and other tokens are let through
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	token := credential(r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.HasPrefix(token, installationTokenPrefix) {
+		expiresAt, ok := s.tokens[token]
+		if !ok || !time.Now().Before(expiresAt) {
+			s.writeMessage(w, http.StatusUnauthorized, "Bad credentials")
+			return false
+		}
+	}
+
+	now := time.Now()
+	b, ok := s.budgets[token]
+	if !ok || !now.Before(b.reset) {
+		b = &budget{reset: now.Add(s.window)}
+		s.budgets[token] = b
+	}
+	exceeded := b.used >= s.limit
+	if !exceeded {
+		b.used++
+	}
+
+	header := w.Header()
+	header.Set("X-RateLimit-Limit", strconv.Itoa(s.limit))
+	header.Set("X-RateLimit-Remaining", strconv.Itoa(s.limit-b.used))
+	header.Set("X-RateLimit-Used", strconv.Itoa(b.used))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(b.reset.Unix(), 10))
+	header.Set("X-RateLimit-Resource", "core")
+	if exceeded {
+		s.writeMessage(w, http.StatusForbidden, "API rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+// appInstallations returns the installations of the app which signed the request. The signature
+// isn't verified since the fake doesn't know the private keys of the apps
+func (s *Server) appInstallations(r *http.Request) (installations []auth.Installation, ok bool) {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(credential(r), claims)
+	if err != nil {
+		return nil, false
+	}
+	issuer, _ := claims["iss"].(string)
+
+	for _, installation := range s.installations {
+		if strconv.Itoa(installation.AppID) == issuer {
+			installations = append(installations, installation)
+		}
+	}
+	return installations, issuer != ""
+}
+
+func (s *Server) listInstallations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	installations, ok := s.appInstallations(r)
+	if !ok {
+		s.writeMessage(w, http.StatusUnauthorized, "A JSON web token could not be decoded")
+		return
+	}
+	if installations == nil {
+		installations = []auth.Installation{}
+	}
+	s.writeJSON(w, http.StatusOK, installations)
+}
+
+func (s *Server) createAccessToken(w http.ResponseWriter, r *http.Request, installationID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	installations, ok := s.appInstallations(r)
+	if !ok {
+		s.writeMessage(w, http.StatusUnauthorized, "A JSON web token could not be decoded")
+		return
+	}
+	for _, installation := range installations {
+		if strconv.Itoa(installation.ID) != installationID {
+			continue
+		}
+		s.issued++
+		token := auth.Token{
+			Token:     fmt.Sprintf("%s%d_%d", installationTokenPrefix, installation.ID, s.issued),
+			ExpiresAt: time.Now().Add(s.tokenTTL).UTC().Truncate(time.Second),
+		}
+		s.tokens[token.Token] = token.ExpiresAt
+		s.writeJSON(w, http.StatusCreated, token)
+		return
+	}
+	s.writeMessage(w, http.StatusNotFound, "")
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request) {
+	perPage := queryInt(r, "per_page", defaultPerPage)
+	if perPage < 1 || perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	// github serves the first page for page=0
+	page := queryInt(r, "page", 1)
+	if page < 1 {
+		page = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := []github.Event{}
+	if start := (page - 1) * perPage; start < len(s.events) {
+		events = s.events[start:min(start+perPage, len(s.events))]
+	}
+	s.writeJSON(w, http.StatusOK, events)
+}
+
+func (s *Server) listRepositories(w http.ResponseWriter, r *http.Request) {
+	since := int64(queryInt(r, "since", 0))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := sort.Search(len(s.repos), func(i int) bool { return s.repos[i].ID > since })
+	repos := s.repos[start:min(start+reposPerPage, len(s.repos))]
+	if repos == nil {
+		repos = []github.Repository{}
+	}
+	s.writeJSON(w, http.StatusOK, repos)
+}
+
+func (s *Server) listLanguages(w http.ResponseWriter, fullName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, repo := range s.repos {
+		if repo.FullName != fullName {
+			continue
+		}
+		languages := s.languages[fullName]
+		if languages == nil {
+			languages = map[string]int64{}
+		}
+		s.writeJSON(w, http.StatusOK, languages)
+		return
+	}
+	s.writeMessage(w, http.StatusNotFound, "")
+}
+
+// writeJSON answers with the body, pointing the urls of the recorded responses to the fake
+func (s *Server) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		s.writeMessage(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	b = []byte(strings.ReplaceAll(string(b), recordedBaseURL, s.URL))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// writeMessage answers with github's error body, the status text is used when the message is empty
+func (s *Server) writeMessage(w http.ResponseWriter, status int, message string) {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	s.writeJSON(w, status, map[string]string{"message": message})
+}
+
+// credential is the token or json web token of the request, empty when it is anonymous
+func credential(r *http.Request) string {
+	value := r.Header.Get("Authorization")
+	for _, scheme := range []string{"Bearer ", "token "} {
+		if strings.HasPrefix(value, scheme) {
+			return strings.TrimPrefix(value, scheme)
+		}
+	}
+	return ""
+}
+
+func queryInt(r *http.Request, name string, fallback int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,221 @@
+package githubtest_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/laouji/git-repo-searcher/pkg/githubtest"
+	"github.com/stretchr/testify/suite"
+)
+
+type serverTestSuite struct {
+	suite.Suite
+	fake   *githubtest.Server
+	client github.Client
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, new(serverTestSuite))
+}
+
+func (s *serverTestSuite) SetupTest() {
+	s.fake = githubtest.NewServer(githubtest.Recorded())
+	s.client = github.NewClient(&http.Client{Timeout: time.Second}, s.fake.URL, auth.NewUnauthenticated())
+}
+
+func (s *serverTestSuite) TearDownTest() {
+	s.fake.Close()
+}
+
+func (s *serverTestSuite) appClient() github.Client {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	ring, err := auth.NewStaticKeyRing(logger.Default(), key)
+	s.Require().NoError(err)
+	// the recorded installation belongs to the app 1
+	provider := auth.NewAppInstallation(http.DefaultClient, s.fake.URL, auth.App{ID: "1", Keys: ring})
+	return github.NewClient(&http.Client{Timeout: time.Second}, s.fake.URL, provider)
+}
+
+func (s *serverTestSuite) TestRecordedFixtures() {
+	ctx := context.Background()
+	events, err := s.client.ListPublicEvents(ctx, 100, 0)
+	s.Require().NoError(err)
+	s.Len(events, 6)
+	s.Equal("PushEvent", events[0].Type)
+
+	repos, err := s.client.ListPublicRepos(ctx, 812345620)
+	s.Require().NoError(err)
+	s.Require().Len(repos, 5)
+	s.Equal("pkhanna/linkshort", repos[0].FullName)
+	// the urls of the recorded responses point to the fake
+	s.Equal(s.fake.URL+"/repos/pkhanna/linkshort/languages", repos[0].LanguagesURL)
+
+	languages, err := s.client.FetchAttribute(ctx, repos[0].LanguagesURL)
+	s.Require().NoError(err)
+	s.Equal(int64(18734), languages["TypeScript"])
+	languages, err = s.client.FetchAttribute(ctx, s.fake.URL+"/repos/nobody/nothing/languages")
+	s.NoError(err)
+	s.Empty(languages)
+}
+
+func (s *serverTestSuite) TestEventsPagination() {
+	ctx := context.Background()
+	first, err := s.client.ListPublicEvents(ctx, 4, 0)
+	s.Require().NoError(err)
+	s.Len(first, 4)
+	// github serves the first page for page=0
+	same, err := s.client.ListPublicEvents(ctx, 4, 1)
+	s.Require().NoError(err)
+	s.Equal(first, same)
+	second, err := s.client.ListPublicEvents(ctx, 4, 2)
+	s.Require().NoError(err)
+	s.Len(second, 2)
+	past, err := s.client.ListPublicEvents(ctx, 4, 3)
+	s.Require().NoError(err)
+	s.Empty(past)
+}
+
+func (s *serverTestSuite) TestCreateRepository_SearchedByTheForge() {
+	repo := s.fake.CreateRepository("octocat", "hello", map[string]int64{"Go": 100})
+	s.Equal(int64(812345669), repo.ID)
+
+	f := forge.NewGitHub(s.client)
+	newest, err := f.NewestProjectID(context.Background())
+	s.Require().NoError(err)
+	s.Equal(repo.ID, newest)
+
+	projects, err := f.ListProjects(context.Background(), newest-1, 100)
+	s.Require().NoError(err)
+	s.Require().Len(projects, 1)
+	s.Equal("octocat/hello", projects[0].FullName)
+	s.False(projects[0].CreatedAt.IsZero())
+
+	languages, err := f.FetchLanguages(context.Background(), projects[0])
+	s.Require().NoError(err)
+	s.Contains(languages, "Go")
+}
+
+func (s *serverTestSuite) TestAppInstallation_TokenExchange() {
+	client := s.appClient()
+	token, err := client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+	s.Contains(token.Token, "ghs_51234567_")
+	s.WithinDuration(time.Now().Add(time.Hour), token.ExpiresAt, 5*time.Second)
+
+	_, err = client.ListPublicRepos(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Equal(1, s.fake.IssuedTokens())
+
+	// the revoked token is rejected, the client renews it and retries
+	s.fake.RevokeTokens()
+	_, err = client.ListPublicRepos(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Equal(2, s.fake.IssuedTokens())
+}
+
+func (s *serverTestSuite) TestAppInstallation_RequiresAnInstalledApp() {
+	_, err := s.client.ListPublicRepos(context.Background(), 0)
+	s.Require().NoError(err)
+
+	// tokens the fake didn't hand out are rejected
+	client := github.NewClient(&http.Client{Timeout: time.Second}, s.fake.URL, auth.NewStaticToken("ghs_forged"))
+	_, err = client.ListPublicRepos(context.Background(), 0)
+	s.ErrorIs(err, github.ErrAuthentication)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	ring, err := auth.NewStaticKeyRing(logger.Default(), key)
+	s.Require().NoError(err)
+	provider := auth.NewAppInstallation(http.DefaultClient, s.fake.URL, auth.App{ID: "2", Keys: ring})
+	_, err = provider.Refresh(context.Background())
+	s.ErrorIs(err, auth.ErrAppNotInstalled)
+}
+
+func (s *serverTestSuite) TestAppInstallation_OtherAppsRefreshedWhenOneFails() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	s.Require().NoError(err)
+	ring, err := auth.NewStaticKeyRing(logger.Default(), key)
+	s.Require().NoError(err)
+	// the app 2 has no installation, it is listed first
+	provider := auth.NewAppInstallation(http.DefaultClient, s.fake.URL, auth.App{ID: "2", Keys: ring}, auth.App{ID: "1", Keys: ring})
+
+	token, err := provider.Refresh(context.Background())
+	s.ErrorIs(err, auth.ErrAppNotInstalled)
+	s.Contains(token.Token, "ghs_51234567_")
+	client := github.NewClient(&http.Client{Timeout: time.Second}, s.fake.URL, provider)
+	_, err = client.ListPublicRepos(context.Background(), 0)
+	s.NoError(err)
+}
+
+func (s *serverTestSuite) TestRateLimit() {
+	s.fake.SetRateLimit(2, time.Hour)
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := s.client.ListPublicRepos(ctx, 0)
+		s.Require().NoError(err)
+	}
+	_, err := s.client.ListPublicRepos(ctx, 0)
+	s.ErrorIs(err, github.ErrRateLimit)
+
+	// every credential has its own budget
+	_, err = s.appClient().SetAccessToken(ctx)
+	s.Require().NoError(err)
+}
+
+func (s *serverTestSuite) TestRateLimit_Headers() {
+	client := s.appClient()
+	_, err := client.SetAccessToken(context.Background())
+	s.Require().NoError(err)
+	s.fake.SetRateLimit(10, time.Hour)
+
+	_, err = client.ListPublicRepos(context.Background(), 0)
+	s.Require().NoError(err)
+	health := client.TokenHealth()
+	s.Require().Len(health, 1)
+	s.Equal(10, health[0].RateLimit)
+	s.Equal(9, health[0].Remaining)
+}
+
+func (s *serverTestSuite) TestScript() {
+	s.fake.Script("/repositories",
+		githubtest.Error(http.StatusBadGateway),
+		githubtest.RateLimited(time.Now().Add(time.Minute)),
+	)
+	ctx := context.Background()
+
+	_, err := s.client.ListPublicRepos(ctx, 0)
+	s.ErrorContains(err, "unexpected status of 502")
+	_, err = s.client.ListPublicRepos(ctx, 0)
+	s.ErrorIs(err, github.ErrRateLimit)
+	// the script is over, the fake answers again
+	repos, err := s.client.ListPublicRepos(ctx, 0)
+	s.NoError(err)
+	s.Len(repos, 8)
+	s.Equal(3, s.fake.Requests("/repositories"))
+}
+
+func (s *serverTestSuite) TestScript_Delay() {
+	s.fake.Script("/events", githubtest.Response{Delay: time.Second, Body: `[]`})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := s.client.ListPublicEvents(ctx, 100, 0)
+	s.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (s *serverTestSuite) TestEnterprisePathPrefix() {
+	baseURL, err := github.NormalizeBaseURL(s.fake.URL)
+	s.Require().NoError(err)
+	client := github.NewClient(&http.Client{Timeout: time.Second}, baseURL, auth.NewUnauthenticated())
+	repos, err := client.ListPublicRepos(context.Background(), 0)
+	s.Require().NoError(err)
+	s.Len(repos, 8)
+}
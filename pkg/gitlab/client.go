@@ -0,0 +1,155 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// apiPathPrefix is where GitLab serves the v4 REST API
+const apiPathPrefix = "/api/v4"
+
+var (
+	ErrAuthentication = errors.New("gitlab API returned 401")
+	ErrRateLimit      = errors.New("gitlab API rate limit reached")
+)
+
+type Client interface {
+	ListProjects(ctx context.Context, opts ListProjectsOptions) (projects []Project, err error)
+	ProjectLanguages(ctx context.Context, projectID int64) (languages map[string]float64, err error)
+}
+
+// ListProjectsOptions maps to the query parameters of the list all projects API
+type ListProjectsOptions struct {
+	OrderBy string
+	Sort    string
+	IDAfter int64
+	PerPage int
+}
+
+type client struct {
+	innerClient *http.Client
+	baseURL     string
+	token       string
+}
+
+// NewClient builds a gitlab API client, the token is optional but without it only public projects are visible
+func NewClient(innerClient *http.Client, baseURL string, token string) Client {
+	return &client{
+		innerClient: innerClient,
+		baseURL:     baseURL,
+		token:       token,
+	}
+}
+
+// NormalizeBaseURL appends the /api/v4 prefix so that the host of a gitlab instance can be configured on its own
+func NormalizeBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse gitlab url %s: %w", raw, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("gitlab url %q must be absolute", raw)
+	}
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	if u.Path == "" {
+		u.Path = apiPathPrefix
+	}
+	return u.String(), nil
+}
+
+func (c *client) do(req *http.Request) (body []byte, err error) {
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.innerClient.Do(req)
+	if err != nil {
+		return body, fmt.Errorf("failed to do request: %w", err)
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusUnauthorized:
+		return body, ErrAuthentication
+	case http.StatusTooManyRequests:
+		return body, ErrRateLimit
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return body, fmt.Errorf("failed to read response body for status %d: %w", res.StatusCode, err)
+	}
+	if res.StatusCode > 399 {
+		return body, fmt.Errorf("unexpected status of %d for req: %q", res.StatusCode, body)
+	}
+	return body, nil
+}
+
+// ListProjects lists the projects visible to the client
+// https://docs.gitlab.com/ee/api/projects.html#list-all-projects
+func (c *client) ListProjects(ctx context.Context, opts ListProjectsOptions) (projects []Project, err error) {
+	path := "/projects"
+	u, err := url.Parse(c.baseURL + path)
+	if err != nil {
+		return projects, fmt.Errorf("failed to parse url %s%s: %w", c.baseURL, path, err)
+	}
+
+	q := u.Query()
+	if opts.OrderBy != "" {
+		q.Add("order_by", opts.OrderBy)
+	}
+	if opts.Sort != "" {
+		q.Add("sort", opts.Sort)
+	}
+	if opts.IDAfter > 0 {
+		q.Add("id_after", strconv.FormatInt(opts.IDAfter, 10))
+	}
+	if opts.PerPage > 0 {
+		q.Add("per_page", strconv.Itoa(opts.PerPage))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return projects, fmt.Errorf("failed to create request to %s: %w", path, err)
+	}
+	b, err := c.do(req)
+	if err != nil {
+		return projects, fmt.Errorf("failed to do request to %s: %w", path, err)
+	}
+
+	err = json.Unmarshal(b, &projects)
+	if err != nil {
+		return projects, fmt.Errorf("failed to unmarshal projects response: %w", err)
+	}
+	return projects, nil
+}
+
+// ProjectLanguages returns the percentage of the code base written in each language
+// https://docs.gitlab.com/ee/api/projects.html#languages
+func (c *client) ProjectLanguages(ctx context.Context, projectID int64) (languages map[string]float64, err error) {
+	path := fmt.Sprintf("/projects/%d/languages", projectID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return languages, fmt.Errorf("failed to create request to %s: %w", path, err)
+	}
+	b, err := c.do(req)
+	if err != nil {
+		return languages, fmt.Errorf("failed to do request to %s: %w", path, err)
+	}
+
+	err = json.Unmarshal(b, &languages)
+	if err != nil {
+		return languages, fmt.Errorf("failed to unmarshal languages response: %w", err)
+	}
+	return languages, nil
+}
@@ -0,0 +1,75 @@
+package gitlab_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/gitlab"
+	"github.com/stretchr/testify/suite"
+)
+
+type clientTestSuite struct {
+	suite.Suite
+}
+
+func TestClient(t *testing.T) {
+	suite.Run(t, new(clientTestSuite))
+}
+
+func (s *clientTestSuite) TestListProjects() {
+	handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/api/v4/projects", r.URL.Path)
+		s.Equal("id_after=40&order_by=created_at&per_page=100&sort=asc", r.URL.RawQuery)
+		s.Equal("secret", r.Header.Get("PRIVATE-TOKEN"))
+		w.Write([]byte(`[{"id":42,"path":"repo","path_with_namespace":"group/repo","namespace":{"full_path":"group","kind":"group"}}]`))
+	})
+	server := httptest.NewServer(handlerFn)
+	defer server.Close()
+
+	baseURL, err := gitlab.NormalizeBaseURL(server.URL)
+	s.Require().NoError(err)
+	client := gitlab.NewClient(&http.Client{Timeout: time.Second}, baseURL, "secret")
+	projects, err := client.ListProjects(context.Background(), gitlab.ListProjectsOptions{
+		OrderBy: "created_at",
+		Sort:    "asc",
+		IDAfter: 40,
+		PerPage: 100,
+	})
+	s.Require().NoError(err)
+	s.Require().Len(projects, 1)
+	s.Equal("group/repo", projects[0].PathWithNamespace)
+	s.Equal("group", projects[0].Namespace.FullPath)
+}
+
+func (s *clientTestSuite) TestProjectLanguages() {
+	handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Equal("/api/v4/projects/42/languages", r.URL.Path)
+		w.Write([]byte(`{"Ruby": 66.69, "JavaScript": 33.31}`))
+	})
+	server := httptest.NewServer(handlerFn)
+	defer server.Close()
+
+	client := gitlab.NewClient(&http.Client{Timeout: time.Second}, server.URL+"/api/v4", "")
+	languages, err := client.ProjectLanguages(context.Background(), 42)
+	s.Require().NoError(err)
+	s.Equal(66.69, languages["Ruby"])
+}
+
+func (s *clientTestSuite) TestErrors() {
+	for status, expected := range map[int]error{
+		http.StatusUnauthorized:    gitlab.ErrAuthentication,
+		http.StatusTooManyRequests: gitlab.ErrRateLimit,
+	} {
+		handlerFn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})
+		server := httptest.NewServer(handlerFn)
+		client := gitlab.NewClient(&http.Client{Timeout: time.Second}, server.URL, "")
+		_, err := client.ProjectLanguages(context.Background(), 1)
+		s.ErrorIs(err, expected)
+		server.Close()
+	}
+}
@@ -0,0 +1,30 @@
+package gitlab
+
+import "time"
+
+type Namespace struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Kind     string `json:"kind"`
+	FullPath string `json:"full_path"`
+}
+
+type ForkParent struct {
+	ID                int64  `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+}
+
+type Project struct {
+	ID                int64     `json:"id"`
+	Name              string    `json:"name"`
+	Path              string    `json:"path"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	Description       string    `json:"description"`
+	WebURL            string    `json:"web_url"`
+	Visibility        string    `json:"visibility"`
+	CreatedAt         time.Time `json:"created_at"`
+	Namespace         Namespace `json:"namespace"`
+	// ForkedFromProject is only set on forks
+	ForkedFromProject *ForkParent `json:"forked_from_project"`
+}
@@ -0,0 +1,106 @@
+package graphqlapi
+
+import (
+	"context"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	codeBadUserInput    = "BAD_USER_INPUT"
+	codeUnauthenticated = "UNAUTHENTICATED"
+	codeRateLimited     = "RATE_LIMITED"
+	codeQueryTooComplex = "QUERY_TOO_COMPLEX"
+	codeInternal        = "INTERNAL"
+)
+
+// Searchers picks the forges a live search runs on, see handler.Search.Searcher
+type Searchers func(provider string, log logrus.FieldLogger) (*federation.Searcher, error)
+
+// Limits bound what a single query may cost, since every live search
+// fetches the languages of a hundred repositories from the forges
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// Request is a GraphQL query as sent over HTTP
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Executor runs the queries of the GraphQL API against the searcher and the index
+type Executor struct {
+	schema graphql.Schema
+	limits Limits
+}
+
+func NewExecutor(searchers Searchers, index store.Store, limits Limits) (*Executor, error) {
+	schema, err := newSchema(&resolver{searchers: searchers, index: index})
+	if err != nil {
+		return nil, err
+	}
+	return &Executor{schema: schema, limits: limits}, nil
+}
+
+// Execute runs the query unless it is malformed, invalid or over the limits, in which
+// case it is rejected without running anything and the result only holds the errors
+func (e *Executor) Execute(ctx context.Context, req Request) (result *graphql.Result, rejected bool) {
+	doc, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"}),
+	})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, true
+	}
+
+	validation := graphql.ValidateDocument(&e.schema, doc, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}, true
+	}
+
+	if err := e.limits.check(doc, req); err != nil {
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{err.format()}}, true
+	}
+
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        e.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	}), false
+}
+
+// queryError carries a machine readable code in the extensions of the GraphQL error
+type queryError struct {
+	code    string
+	message string
+}
+
+func (e queryError) Error() string {
+	return e.message
+}
+
+func (e queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// ErrorCode returns the code of a GraphQL error, or an empty string when it has none
+func ErrorCode(err gqlerrors.FormattedError) string {
+	code, _ := err.Extensions["code"].(string)
+	return code
+}
+
+// format is for the errors raised before execution, which the library doesn't extend
+func (e queryError) format() gqlerrors.FormattedError {
+	return gqlerrors.FormattedError{Message: e.message, Locations: []location.SourceLocation{}, Extensions: e.Extensions()}
+}
@@ -0,0 +1,290 @@
+package graphqlapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/graphqlapi"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type executorTestSuite struct {
+	suite.Suite
+	created  time.Time
+	index    store.Store
+	executor *graphqlapi.Executor
+}
+
+func TestExecutor(t *testing.T) {
+	suite.Run(t, new(executorTestSuite))
+}
+
+func (s *executorTestSuite) SetupTest() {
+	s.created = time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC)
+	search := handler.Search{
+		Forges: map[string]forge.Forge{
+			"github": &forgetest.Stub{
+				Provider: "github",
+				Projects: []forge.Project{
+					{ID: 1, Name: "old", FullName: "owner/old", Owner: "owner", CreatedAt: s.created.Add(-2 * time.Minute)},
+					{ID: 2, Name: "mid", FullName: "owner/mid", Owner: "owner", CreatedAt: s.created.Add(-time.Minute)},
+					{
+						ID:        3,
+						Name:      "new",
+						FullName:  "owner/new",
+						Owner:     "owner",
+						HTMLURL:   "https://github.com/owner/new",
+						CreatedAt: s.created,
+					},
+				},
+				Languages: map[string]model.Language{
+					"Go":    {Bytes: 300, Percent: 75},
+					"Shell": {Bytes: 100, Percent: 25},
+				},
+			},
+			"gitlab": &forgetest.Stub{Provider: "gitlab", Err: forge.ErrRateLimit},
+			"gitea":  &forgetest.Stub{Provider: "gitea", Err: forge.ErrAuthentication},
+		},
+		DefaultProvider: "github",
+		WorkerCount:     2,
+		SourceTimeout:   time.Second,
+	}
+	s.index = store.NewMemory()
+
+	var err error
+	s.executor, err = graphqlapi.NewExecutor(search.Searcher, s.index, graphqlapi.Limits{MaxDepth: 6, MaxComplexity: 2500})
+	s.Require().NoError(err)
+}
+
+// execute runs the query and decodes its data into out
+func (s *executorTestSuite) execute(req graphqlapi.Request, out interface{}) *executed {
+	ctx := logger.ToCtx(context.Background(), logger.Default())
+	result, rejected := s.executor.Execute(ctx, req)
+
+	res := &executed{rejected: rejected}
+	for _, err := range result.Errors {
+		res.codes = append(res.codes, graphqlapi.ErrorCode(err))
+	}
+	if out != nil && result.Data != nil {
+		raw, err := json.Marshal(result.Data)
+		s.Require().NoError(err)
+		s.Require().NoError(json.Unmarshal(raw, out))
+	}
+	return res
+}
+
+type executed struct {
+	rejected bool
+	codes    []string
+}
+
+type page struct {
+	Repositories struct {
+		Edges []struct {
+			Cursor string `json:"cursor"`
+			Node   struct {
+				FullName string `json:"fullName"`
+			} `json:"node"`
+		} `json:"edges"`
+		Nodes []struct {
+			ID        string `json:"id"`
+			FullName  string `json:"fullName"`
+			CreatedAt string `json:"createdAt"`
+			Owner     struct {
+				Login   string  `json:"login"`
+				HTMLURL *string `json:"htmlUrl"`
+			} `json:"owner"`
+			Languages []struct {
+				Name    string  `json:"name"`
+				Percent float64 `json:"percent"`
+			} `json:"languages"`
+		} `json:"nodes"`
+		PageInfo struct {
+			HasNextPage bool   `json:"hasNextPage"`
+			EndCursor   string `json:"endCursor"`
+		} `json:"pageInfo"`
+		TotalCount int `json:"totalCount"`
+		Sources    []struct {
+			Provider string  `json:"provider"`
+			Count    int     `json:"count"`
+			Error    *string `json:"error"`
+		} `json:"sources"`
+	} `json:"repositories"`
+}
+
+func (s *executorTestSuite) TestRepositories_LiveWithOwnerAndLanguages() {
+	var data page
+	res := s.execute(graphqlapi.Request{Query: `{
+		repositories(filter: {language: "go"}, first: 1) {
+			nodes { id fullName createdAt owner { login htmlUrl } languages { name percent } }
+			totalCount
+			sources { provider count error }
+		}
+	}`}, &data)
+	s.Require().False(res.rejected)
+	s.Require().Empty(res.codes)
+
+	s.Require().Len(data.Repositories.Nodes, 1)
+	repo := data.Repositories.Nodes[0]
+	s.Equal("github:3", repo.ID)
+	s.Equal("owner/new", repo.FullName)
+	s.Equal("2024-05-02T17:41:07Z", repo.CreatedAt)
+	s.Equal("owner", repo.Owner.Login)
+	s.Require().NotNil(repo.Owner.HTMLURL)
+	s.Equal("https://github.com/owner", *repo.Owner.HTMLURL)
+	s.Require().Len(repo.Languages, 2)
+	s.Equal("go", repo.Languages[0].Name)
+	s.Equal(75.0, repo.Languages[0].Percent)
+
+	s.Equal(3, data.Repositories.TotalCount)
+	s.Require().Len(data.Repositories.Sources, 1)
+	s.Equal(3, data.Repositories.Sources[0].Count)
+	s.Nil(data.Repositories.Sources[0].Error)
+}
+
+func (s *executorTestSuite) TestRepositories_PaginatesWithCursors() {
+	query := `query Page($after: String) {
+		repositories(first: 2, after: $after) {
+			edges { cursor node { fullName } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+
+	var first page
+	s.execute(graphqlapi.Request{Query: query}, &first)
+	s.Require().Len(first.Repositories.Edges, 2)
+	s.Equal("owner/new", first.Repositories.Edges[0].Node.FullName)
+	s.Equal("owner/mid", first.Repositories.Edges[1].Node.FullName)
+	s.True(first.Repositories.PageInfo.HasNextPage)
+	s.Equal(first.Repositories.Edges[1].Cursor, first.Repositories.PageInfo.EndCursor)
+
+	var second page
+	s.execute(graphqlapi.Request{
+		Query:     query,
+		Variables: map[string]interface{}{"after": first.Repositories.PageInfo.EndCursor},
+	}, &second)
+	s.Require().Len(second.Repositories.Edges, 1)
+	s.Equal("owner/old", second.Repositories.Edges[0].Node.FullName)
+	s.False(second.Repositories.PageInfo.HasNextPage)
+}
+
+func (s *executorTestSuite) TestRepositories_FromIndex() {
+	s.index.Upsert(model.Repository{
+		Provider:  "github",
+		ID:        42,
+		FullName:  "owner/indexed",
+		Owner:     "owner",
+		CreatedAt: s.created,
+		Languages: map[string]model.Language{"rust": {Bytes: 10, Percent: 100}},
+	})
+	s.index.Upsert(model.Repository{Provider: "gitlab", ID: 7, FullName: "owner/elsewhere", CreatedAt: s.created})
+
+	var data page
+	res := s.execute(graphqlapi.Request{Query: `{
+		repositories(filter: {source: INDEX, providers: ["github"], language: "rust"}) {
+			nodes { fullName }
+			totalCount
+			sources { provider }
+		}
+	}`}, &data)
+	s.Require().Empty(res.codes)
+	s.Require().Len(data.Repositories.Nodes, 1)
+	s.Equal("owner/indexed", data.Repositories.Nodes[0].FullName)
+	s.Empty(data.Repositories.Sources)
+}
+
+func (s *executorTestSuite) TestRepositories_ReportsFailedSources() {
+	var data page
+	res := s.execute(graphqlapi.Request{Query: `{
+		repositories(filter: {providers: ["github", "gitlab"]}) { totalCount sources { provider error } }
+	}`}, &data)
+	s.Require().Empty(res.codes)
+	s.Equal(3, data.Repositories.TotalCount)
+	s.Require().Len(data.Repositories.Sources, 2)
+	s.Equal("gitlab", data.Repositories.Sources[1].Provider)
+	s.NotNil(data.Repositories.Sources[1].Error)
+}
+
+func (s *executorTestSuite) TestRepositories_ErrorCodes() {
+	for query, code := range map[string]string{
+		`{ repositories(filter: {providers: ["nope"]}) { totalCount } }`:   "BAD_USER_INPUT",
+		`{ repositories(filter: {providers: ["gitlab"]}) { totalCount } }`: "RATE_LIMITED",
+		`{ repositories(filter: {providers: ["gitea"]}) { totalCount } }`:  "UNAUTHENTICATED",
+		`{ repositories(first: 101) { totalCount } }`:                      "BAD_USER_INPUT",
+		`{ repositories(after: "not a cursor") { totalCount } }`:           "BAD_USER_INPUT",
+	} {
+		res := s.execute(graphqlapi.Request{Query: query}, nil)
+		s.False(res.rejected, query)
+		s.Equal([]string{code}, res.codes, query)
+	}
+}
+
+func (s *executorTestSuite) TestExecute_RejectsTooDeepQueries() {
+	res := s.execute(graphqlapi.Request{Query: `{
+		repositories(first: 1) { edges { node { owner { login } languages { name } } } }
+	}`}, nil)
+	s.False(res.rejected)
+
+	res = s.execute(graphqlapi.Request{Query: `
+		fragment deep on Repository { owner { login } }
+		{ repositories(first: 1) { edges { node { ...deep } } pageInfo { hasNextPage } } }
+		`}, nil)
+	s.False(res.rejected)
+
+	s.executor, _ = graphqlapi.NewExecutor(nil, s.index, graphqlapi.Limits{MaxDepth: 4})
+	res = s.execute(graphqlapi.Request{Query: `
+		fragment deep on Repository { owner { login } }
+		{ repositories(first: 1) { edges { node { ...deep } } } }
+		`}, nil)
+	s.True(res.rejected)
+	s.Equal([]string{"QUERY_TOO_COMPLEX"}, res.codes)
+}
+
+func (s *executorTestSuite) TestExecute_RejectsTooComplexQueries() {
+	// five live searches cost 2500 on their own
+	res := s.execute(graphqlapi.Request{Query: `{
+		a: repositories(first: 0) { totalCount }
+		b: repositories(first: 0) { totalCount }
+		c: repositories(first: 0) { totalCount }
+		d: repositories(first: 0) { totalCount }
+	}`}, nil)
+	s.False(res.rejected)
+
+	res = s.execute(graphqlapi.Request{Query: `{
+		a: repositories(first: 0) { totalCount }
+		b: repositories(first: 0) { totalCount }
+		c: repositories(first: 0) { totalCount }
+		d: repositories(first: 0) { totalCount }
+		e: repositories(first: 0) { totalCount }
+	}`}, nil)
+	s.True(res.rejected)
+	s.Equal([]string{"QUERY_TOO_COMPLEX"}, res.codes)
+
+	// the page size comes from the variables, every node costs its fields
+	query := `query($first: Int) {
+		repositories(filter: {source: INDEX}, first: $first) { nodes { fullName languages { name percent } } }
+	}`
+	res = s.execute(graphqlapi.Request{Query: query, Variables: map[string]interface{}{"first": 10}}, nil)
+	s.False(res.rejected)
+
+	s.executor, _ = graphqlapi.NewExecutor(nil, s.index, graphqlapi.Limits{MaxComplexity: 100})
+	res = s.execute(graphqlapi.Request{Query: query, Variables: map[string]interface{}{"first": 20}}, nil)
+	s.True(res.rejected)
+	s.Equal([]string{"QUERY_TOO_COMPLEX"}, res.codes)
+}
+
+func (s *executorTestSuite) TestExecute_RejectsInvalidQueries() {
+	res := s.execute(graphqlapi.Request{Query: `{ repositories {`}, nil)
+	s.True(res.rejected)
+
+	res = s.execute(graphqlapi.Request{Query: `{ repositories { unknown } }`}, nil)
+	s.True(res.rejected)
+}
@@ -0,0 +1,200 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const (
+	// liveSearchCost stands for the hundred language lookups a live search makes on each forge
+	liveSearchCost = 500
+	// indexCost is the cost of reading the local index, which doesn't reach the forges
+	indexCost = 1
+)
+
+// check walks the operation about to run and rejects it if it is nested too deeply or
+// too costly. Every field costs one, the fields under a connection's edges or nodes are
+// counted once per requested repository and every live search adds liveSearchCost.
+// A zero limit isn't enforced
+func (l Limits) check(doc *ast.Document, req Request) *queryError {
+	a := analysis{
+		limits:    l,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		variables: req.Variables,
+	}
+	var op *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			a.fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if req.OperationName == "" || (def.Name != nil && def.Name.Value == req.OperationName) {
+				op = def
+			}
+		}
+	}
+	// the executor reports a missing operation by itself
+	if op == nil {
+		return nil
+	}
+	a.defaults = make(map[string]ast.Value)
+	for _, def := range op.VariableDefinitions {
+		if def.DefaultValue != nil {
+			a.defaults[def.Variable.Name.Value] = def.DefaultValue
+		}
+	}
+
+	complexity, err := a.selectionSet(op.SelectionSet, 0, 0)
+	if err != nil {
+		return err
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return &queryError{
+			code:    codeQueryTooComplex,
+			message: fmt.Sprintf("query has a complexity of %d, the limit is %d", complexity, l.MaxComplexity),
+		}
+	}
+	return nil
+}
+
+type analysis struct {
+	limits    Limits
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	defaults  map[string]ast.Value
+}
+
+// selectionSet returns the complexity of the selections at the given depth, first
+// is how many repositories the enclosing connection returns
+func (a *analysis) selectionSet(set *ast.SelectionSet, depth, first int) (complexity int, err *queryError) {
+	if set == nil {
+		return 0, nil
+	}
+	for _, selection := range set.Selections {
+		var cost int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			cost, err = a.field(selection, depth+1, first)
+		case *ast.FragmentSpread:
+			if def, ok := a.fragments[selection.Name.Value]; ok {
+				cost, err = a.selectionSet(def.SelectionSet, depth, first)
+			}
+		case *ast.InlineFragment:
+			cost, err = a.selectionSet(selection.SelectionSet, depth, first)
+		}
+		if err != nil {
+			return 0, err
+		}
+		complexity += cost
+	}
+	return complexity, nil
+}
+
+func (a *analysis) field(field *ast.Field, depth, first int) (int, *queryError) {
+	// introspection doesn't reach the forges, GraphQL tools need it to nest deeply
+	if strings.HasPrefix(field.Name.Value, "__") {
+		return 0, nil
+	}
+	if a.limits.MaxDepth > 0 && depth > a.limits.MaxDepth {
+		return 0, &queryError{
+			code:    codeQueryTooComplex,
+			message: fmt.Sprintf("query is nested deeper than the limit of %d", a.limits.MaxDepth),
+		}
+	}
+
+	switch field.Name.Value {
+	case fieldRepositories:
+		n := a.first(field)
+		children, err := a.selectionSet(field.SelectionSet, depth, n)
+		if err != nil {
+			return 0, err
+		}
+		if a.source(field) == sourceIndex {
+			return indexCost + children, nil
+		}
+		return liveSearchCost + children, nil
+	case fieldEdges, fieldNodes:
+		children, err := a.selectionSet(field.SelectionSet, depth, first)
+		if err != nil {
+			return 0, err
+		}
+		return first * (1 + children), nil
+	}
+	children, err := a.selectionSet(field.SelectionSet, depth, first)
+	if err != nil {
+		return 0, err
+	}
+	return 1 + children, nil
+}
+
+// first is the page size the connection will be asked for, the resolver rejects values over maxFirst
+func (a *analysis) first(field *ast.Field) int {
+	first := defaultFirst
+	switch v := a.value(argument(field, argFirst)).(type) {
+	case int:
+		first = v
+	case float64:
+		first = int(v)
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			first = n
+		}
+	}
+	if first < 0 {
+		return 0
+	}
+	if first > maxFirst {
+		return maxFirst
+	}
+	return first
+}
+
+func (a *analysis) source(field *ast.Field) string {
+	filter, ok := a.value(argument(field, argFilter)).(map[string]interface{})
+	if !ok {
+		return sourceLive
+	}
+	if source, ok := filter[filterSource].(string); ok {
+		return source
+	}
+	return sourceLive
+}
+
+// value resolves an argument literal or variable into the shape variables are decoded into from JSON
+func (a *analysis) value(v ast.Value) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case *ast.Variable:
+		name := v.Name.Value
+		if value, ok := a.variables[name]; ok {
+			return value
+		}
+		return a.value(a.defaults[name])
+	case *ast.IntValue:
+		return v.Value
+	case *ast.EnumValue:
+		return v.Value
+	case *ast.StringValue:
+		return v.Value
+	case *ast.ObjectValue:
+		out := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			out[field.Name.Value] = a.value(field.Value)
+		}
+		return out
+	}
+	return nil
+}
+
+func argument(field *ast.Field, name string) ast.Value {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value == name {
+			return arg.Value
+		}
+	}
+	return nil
+}
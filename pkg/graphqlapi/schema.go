@@ -0,0 +1,484 @@
+package graphqlapi
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/laouji/git-repo-searcher/pkg/subrequester"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	fieldRepositories = "repositories"
+	fieldEdges        = "edges"
+	fieldNodes        = "nodes"
+
+	argFilter = "filter"
+	argFirst  = "first"
+	argAfter  = "after"
+
+	filterProviders = "providers"
+	filterLanguage  = "language"
+	filterSource    = "source"
+
+	// sourceLive searches the forges, sourceIndex reads the repositories the service already knows
+	sourceLive  = "LIVE"
+	sourceIndex = "INDEX"
+
+	defaultFirst = 20
+	maxFirst     = 100
+)
+
+type resolver struct {
+	searchers Searchers
+	index     store.Store
+}
+
+// connection is a page of repositories in the relay connection style
+type connection struct {
+	repos   []model.Repository
+	hasNext bool
+	total   int
+	sources []federation.Source
+}
+
+type owner struct {
+	login   string
+	htmlURL string
+}
+
+type language struct {
+	name string
+	model.Language
+}
+
+// int64Scalar carries repository IDs and byte counts, which can overflow GraphQL's 32 bit Int
+var int64Scalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "Int64",
+	Description: "A 64 bit integer",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case float64:
+			return int64(v)
+		case int:
+			return int64(v)
+		}
+		return nil
+	},
+	ParseLiteral: func(value ast.Value) interface{} {
+		if v, ok := value.(*ast.IntValue); ok {
+			n, err := strconv.ParseInt(v.Value, 10, 64)
+			if err == nil {
+				return n
+			}
+		}
+		return nil
+	},
+})
+
+func newSchema(r *resolver) (graphql.Schema, error) {
+	languageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Language",
+		Fields: graphql.Fields{
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(language).name, nil
+			}},
+			"bytes": &graphql.Field{Type: int64Scalar, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(language).Bytes, nil
+			}},
+			"percent": &graphql.Field{Type: graphql.NewNonNull(graphql.Float), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(language).Percent, nil
+			}},
+		},
+	})
+
+	ownerType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Owner",
+		Fields: graphql.Fields{
+			"login": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(owner).login, nil
+			}},
+			"htmlUrl": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optional(p.Source.(owner).htmlURL), nil
+			}},
+		},
+	})
+
+	repositoryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Repository",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.ID),
+				Description: "Unique across forges",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					repo := p.Source.(model.Repository)
+					return fmt.Sprintf("%s:%d", repo.Provider, repo.ID), nil
+				},
+			},
+			"databaseId": &graphql.Field{
+				Type:        graphql.NewNonNull(int64Scalar),
+				Description: "ID of the repository on its forge",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(model.Repository).ID, nil
+				},
+			},
+			"provider": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(model.Repository).Provider, nil
+			}},
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(model.Repository).Repository, nil
+			}},
+			"fullName": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(model.Repository).FullName, nil
+			}},
+			"description": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optional(p.Source.(model.Repository).Description), nil
+			}},
+			"htmlUrl": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optional(p.Source.(model.Repository).HTMLURL), nil
+			}},
+			"createdAt": &graphql.Field{Type: graphql.DateTime, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if created := p.Source.(model.Repository).CreatedAt; !created.IsZero() {
+					return created, nil
+				}
+				return nil, nil
+			}},
+			"stars": &graphql.Field{
+				Type:        graphql.Int,
+				Description: "Only known when github repositories are enriched with GraphQL",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(model.Repository).Stars, nil
+				},
+			},
+			"license": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optional(p.Source.(model.Repository).License), nil
+			}},
+			"topics": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				if topics := p.Source.(model.Repository).Topics; topics != nil {
+					return topics, nil
+				}
+				return []string{}, nil
+			}},
+			"owner": &graphql.Field{Type: graphql.NewNonNull(ownerType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return ownerOf(p.Source.(model.Repository)), nil
+			}},
+			"languages": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(languageType))),
+				Description: "Largest share first",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return languagesOf(p.Source.(model.Repository)), nil
+				},
+			},
+		},
+	})
+
+	edgeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "RepositoryEdge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return encodeCursor(p.Source.(model.Repository)), nil
+			}},
+			"node": &graphql.Field{Type: graphql.NewNonNull(repositoryType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source, nil
+			}},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*connection).hasNext, nil
+			}},
+			"endCursor": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				c := p.Source.(*connection)
+				if len(c.repos) == 0 {
+					return nil, nil
+				}
+				return encodeCursor(c.repos[len(c.repos)-1]), nil
+			}},
+		},
+	})
+
+	sourceType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Source",
+		Description: "How a forge fared during a live search",
+		Fields: graphql.Fields{
+			"provider": &graphql.Field{Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(federation.Source).Provider, nil
+			}},
+			"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(federation.Source).Count, nil
+			}},
+			"durationMs": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(federation.Source).Duration, nil
+			}},
+			"error": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return optional(p.Source.(federation.Source).Error), nil
+			}},
+		},
+	})
+
+	connectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "RepositoryConnection",
+		Fields: graphql.Fields{
+			fieldEdges: &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edgeType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*connection).repos, nil
+			}},
+			fieldNodes: &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(repositoryType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*connection).repos, nil
+			}},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source, nil
+			}},
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*connection).total, nil
+			}},
+			"sources": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(sourceType))), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*connection).sources, nil
+			}},
+		},
+	})
+
+	sourceEnum := graphql.NewEnum(graphql.EnumConfig{
+		Name: "RepositorySource",
+		Values: graphql.EnumValueConfigMap{
+			sourceLive:  &graphql.EnumValueConfig{Value: sourceLive, Description: "Search the forges"},
+			sourceIndex: &graphql.EnumValueConfig{Value: sourceIndex, Description: "Read the repositories the service already found"},
+		},
+	})
+
+	filterType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "RepositoryFilter",
+		Fields: graphql.InputObjectConfigFieldMap{
+			filterProviders: &graphql.InputObjectFieldConfig{
+				Type:        graphql.NewList(graphql.NewNonNull(graphql.String)),
+				Description: "Forges to search, all of them with \"all\" and the default ones when empty",
+			},
+			filterLanguage: &graphql.InputObjectFieldConfig{
+				Type:        graphql.String,
+				Description: "Comma separated languages of which a repository must use at least one",
+			},
+			filterSource: &graphql.InputObjectFieldConfig{Type: sourceEnum, DefaultValue: sourceLive},
+		},
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			fieldRepositories: &graphql.Field{
+				Type:        graphql.NewNonNull(connectionType),
+				Description: "Most recently created repositories, newest first",
+				Args: graphql.FieldConfigArgument{
+					argFilter: &graphql.ArgumentConfig{Type: filterType},
+					argFirst:  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultFirst},
+					argAfter:  &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: r.repositories,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		return schema, fmt.Errorf("failed to build graphql schema: %w", err)
+	}
+	return schema, nil
+}
+
+func (r *resolver) repositories(p graphql.ResolveParams) (interface{}, error) {
+	log := logger.Get(p.Context)
+
+	first, _ := p.Args[argFirst].(int)
+	if first < 0 || first > maxFirst {
+		return nil, queryError{code: codeBadUserInput, message: fmt.Sprintf("first must be between 0 and %d", maxFirst)}
+	}
+
+	filter, _ := p.Args[argFilter].(map[string]interface{})
+	var providers []string
+	if list, ok := filter[filterProviders].([]interface{}); ok {
+		for _, provider := range list {
+			providers = append(providers, fmt.Sprint(provider))
+		}
+	}
+	filters := make(map[string]string)
+	if language, ok := filter[filterLanguage].(string); ok && language != "" {
+		filters[subrequester.FilterKeyLanguage] = language
+	}
+
+	var repos []model.Repository
+	var sources []federation.Source
+	if source, _ := filter[filterSource].(string); source == sourceIndex {
+		repos = r.fromIndex(providers, filters)
+	} else {
+		searcher, err := r.searchers(strings.Join(providers, ","), log)
+		if err != nil {
+			return nil, searchError(log, err)
+		}
+		repos, sources = searcher.Search(p.Context, filters)
+		if err := failure(log, sources); err != nil {
+			return nil, err
+		}
+	}
+
+	start := 0
+	if after, ok := p.Args[argAfter].(string); ok {
+		c, err := decodeCursor(after)
+		if err != nil {
+			return nil, queryError{code: codeBadUserInput, message: err.Error()}
+		}
+		start = sort.Search(len(repos), func(i int) bool {
+			return c.before(repos[i])
+		})
+	}
+	end := start + first
+	if end > len(repos) {
+		end = len(repos)
+	}
+	return &connection{
+		repos:   repos[start:end],
+		hasNext: end < len(repos),
+		total:   len(repos),
+		sources: sources,
+	}, nil
+}
+
+func (r *resolver) fromIndex(providers []string, filters map[string]string) []model.Repository {
+	if r.index == nil {
+		return nil
+	}
+	wanted := make(map[string]struct{}, len(providers))
+	for _, provider := range providers {
+		wanted[strings.ToLower(provider)] = struct{}{}
+	}
+	_, all := wanted["all"]
+
+	var repos []model.Repository
+	for _, record := range r.index.List() {
+		if _, ok := wanted[record.Provider]; !ok && !all && len(wanted) > 0 {
+			continue
+		}
+		if !subrequester.Relevant(record.Languages, filters) {
+			continue
+		}
+		repos = append(repos, record.Repository)
+	}
+	return repos
+}
+
+// failure fails the search the same way /repos does: a single forge fails like it always did,
+// several only fail if none of them answered
+func failure(log logrus.FieldLogger, sources []federation.Source) error {
+	if len(sources) == 1 && sources[0].Err != nil {
+		return searchError(log, sources[0].Err)
+	}
+	if len(sources) > 1 {
+		if err := federation.AllFailed(sources); err != nil {
+			return searchError(log, err)
+		}
+	}
+	return nil
+}
+
+func searchError(log logrus.FieldLogger, err error) error {
+	log.WithError(err).Error("Request failed")
+	switch {
+	case errors.Is(err, federation.ErrUnknownProvider):
+		return queryError{code: codeBadUserInput, message: err.Error()}
+	case errors.Is(err, forge.ErrAuthentication):
+		return queryError{code: codeUnauthenticated, message: forge.ErrAuthentication.Error()}
+	case errors.Is(err, forge.ErrRateLimit):
+		return queryError{code: codeRateLimited, message: forge.ErrRateLimit.Error()}
+	}
+	return queryError{code: codeInternal, message: "internal error"}
+}
+
+// cursor points at a repository by its place in the newest first order rather than by
+// its index, so that pages stay consistent when new repositories show up in between
+type cursor struct {
+	createdAt time.Time
+	provider  string
+	id        int64
+}
+
+func encodeCursor(repo model.Repository) string {
+	raw := fmt.Sprintf("%s|%s|%d", repo.CreatedAt.Format(time.RFC3339Nano), repo.Provider, repo.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (c cursor, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	c.createdAt, err = time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	c.id, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor %q", s)
+	}
+	c.provider = parts[1]
+	return c, nil
+}
+
+// before reports whether the cursor's repository comes before the given one in the newest first order
+func (c cursor) before(repo model.Repository) bool {
+	if !c.createdAt.Equal(repo.CreatedAt) {
+		return c.createdAt.After(repo.CreatedAt)
+	}
+	if c.provider != repo.Provider {
+		return c.provider < repo.Provider
+	}
+	return c.id > repo.ID
+}
+
+func ownerOf(repo model.Repository) owner {
+	o := owner{login: repo.Owner}
+	if i := strings.LastIndex(repo.HTMLURL, "/"); i > 0 {
+		o.htmlURL = repo.HTMLURL[:i]
+	}
+	return o
+}
+
+func languagesOf(repo model.Repository) []language {
+	out := make([]language, 0, len(repo.Languages))
+	for name, l := range repo.Languages {
+		out = append(out, language{name: name, Language: l})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Percent != out[j].Percent {
+			return out[i].Percent > out[j].Percent
+		}
+		return out[i].name < out[j].name
+	})
+	return out
+}
+
+// optional turns empty strings into nulls
+func optional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/httpcache"
+	"github.com/sirupsen/logrus"
+)
+
+// writeEntry answers with the response, or with a 304 when the client already has it. The
+// age of a response served from the cache is reported so that it isn't reused for longer than MaxAge
+func (s Search) writeEntry(w http.ResponseWriter, r *http.Request, log logrus.FieldLogger, entry httpcache.Entry, cached bool) error {
+	header := w.Header()
+	header.Set("ETag", entry.ETag)
+	header.Set("Cache-Control", cacheControl(s.MaxAge, s.Private))
+	if s.Private {
+		header.Set("Vary", "Authorization, X-API-Key")
+	}
+	if cached {
+		header.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt).Seconds())))
+	}
+
+	if !httpcache.NoneMatch(r.Header.Get("If-None-Match"), entry.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	header.Set("Content-Type", entry.ContentType)
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(entry.Body)
+	if err != nil {
+		log.WithError(err).Error("Failed to write repos response")
+		return err
+	}
+	return nil
+}
+
+func cacheControl(maxAge time.Duration, private bool) string {
+	directive := "no-cache"
+	if maxAge > 0 {
+		directive = "max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	}
+	if private {
+		return "private, " + directive
+	}
+	return directive
+}
@@ -0,0 +1,166 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/httpcache"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+// countingForge counts the searches which reached it
+type countingForge struct {
+	forgetest.Stub
+	searches atomic.Int32
+}
+
+func (f *countingForge) NewestProjectID(ctx context.Context) (int64, error) {
+	f.searches.Add(1)
+	return f.Stub.NewestProjectID(ctx)
+}
+
+type cacheTestSuite struct {
+	suite.Suite
+	forge *countingForge
+}
+
+func TestCache(t *testing.T) {
+	suite.Run(t, new(cacheTestSuite))
+}
+
+func (s *cacheTestSuite) SetupTest() {
+	s.forge = &countingForge{Stub: forgetest.Stub{
+		Provider: "github",
+		Projects: []forge.Project{
+			{ID: 1, Name: "repo", FullName: "owner/repo", Owner: "owner", CreatedAt: time.Now()},
+		},
+		Languages: map[string]model.Language{"go": {Bytes: 100, Percent: 100}},
+	}}
+}
+
+func (s *cacheTestSuite) server(search handler.Search) *httptest.Server {
+	if search.Forges == nil {
+		search.Forges = map[string]forge.Forge{"github": s.forge}
+	}
+	search.DefaultProvider = "github"
+	search.WorkerCount = 2
+	search.SourceTimeout = time.Second
+	search.Index = store.NewMemory()
+
+	router := handlers.NewRouter(logger.Default())
+	router.HandleFunc("/repos", handler.Repos(search))
+	server := httptest.NewServer(router)
+	s.T().Cleanup(server.Close)
+	return server
+}
+
+func (s *cacheTestSuite) get(url string, header ...string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	s.Require().NoError(err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	res.Body.Close()
+	return res
+}
+
+func (s *cacheTestSuite) TestRepos_ETag() {
+	server := s.server(handler.Search{MaxAge: 30 * time.Second})
+
+	res := s.get(server.URL + "/repos")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	s.NotEmpty(etag)
+	s.Equal("max-age=30", res.Header.Get("Cache-Control"))
+	s.Empty(res.Header.Get("Age"))
+
+	// the result set didn't change, the client keeps what it has
+	res = s.get(server.URL+"/repos", "If-None-Match", etag)
+	s.Equal(http.StatusNotModified, res.StatusCode)
+	s.Equal(etag, res.Header.Get("ETag"))
+	s.Empty(res.Header.Get("Content-Type"))
+
+	res = s.get(server.URL+"/repos", "If-None-Match", `"stale"`)
+	s.Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *cacheTestSuite) TestRepos_ETagLeavesOutSourceDurations() {
+	slow := &forgetest.Stub{Provider: "gitlab", Projects: []forge.Project{{ID: 1, Name: "repo", FullName: "group/repo", Owner: "group"}}}
+	server := s.server(handler.Search{Forges: map[string]forge.Forge{"github": s.forge, "gitlab": slow}})
+
+	res := s.get(server.URL + "/repos?provider=all&facets=language")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	etag := res.Header.Get("ETag")
+	s.NotEmpty(etag)
+
+	// the sources report a longer duration, the results are the same
+	slow.Delay = 20 * time.Millisecond
+	res = s.get(server.URL+"/repos?provider=all&facets=language", "If-None-Match", etag)
+	s.Equal(http.StatusNotModified, res.StatusCode)
+}
+
+func (s *cacheTestSuite) TestRepos_NoCacheWithoutMaxAge() {
+	server := s.server(handler.Search{})
+	res := s.get(server.URL + "/repos")
+	s.Equal("no-cache", res.Header.Get("Cache-Control"))
+}
+
+func (s *cacheTestSuite) TestRepos_PrivateWithAPIKeys() {
+	server := s.server(handler.Search{MaxAge: 30 * time.Second, Private: true})
+	res := s.get(server.URL + "/repos")
+	s.Equal("private, max-age=30", res.Header.Get("Cache-Control"))
+	s.Equal("Authorization, X-API-Key", res.Header.Get("Vary"))
+
+	server = s.server(handler.Search{Private: true})
+	res = s.get(server.URL + "/repos")
+	s.Equal("private, no-cache", res.Header.Get("Cache-Control"))
+
+	server = s.server(handler.Search{MaxAge: 30 * time.Second})
+	res = s.get(server.URL + "/repos")
+	s.Empty(res.Header.Get("Vary"))
+}
+
+func (s *cacheTestSuite) TestRepos_ServedFromTheCache() {
+	server := s.server(handler.Search{MaxAge: 10 * time.Second, Cache: httpcache.New(time.Minute, 10)})
+
+	first := s.get(server.URL + "/repos?language=Go&limit=10")
+	s.Require().Equal(http.StatusOK, first.StatusCode)
+	// the same query written differently is answered from the cache
+	second := s.get(server.URL + "/repos?limit=10&language=go")
+	s.Require().Equal(http.StatusOK, second.StatusCode)
+	s.Equal(first.Header.Get("ETag"), second.Header.Get("ETag"))
+	age, err := strconv.Atoi(second.Header.Get("Age"))
+	s.Require().NoError(err)
+	s.LessOrEqual(age, 1)
+	s.Equal(int32(1), s.forge.searches.Load())
+
+	res := s.get(server.URL+"/repos?language=go&limit=10", "If-None-Match", first.Header.Get("ETag"))
+	s.Equal(http.StatusNotModified, res.StatusCode)
+
+	s.get(server.URL + "/repos?language=rust")
+	s.Equal(int32(2), s.forge.searches.Load())
+}
+
+func (s *cacheTestSuite) TestRepos_ExportsAreNotCached() {
+	server := s.server(handler.Search{Cache: httpcache.New(time.Minute, 10)})
+	for i := 0; i < 2; i++ {
+		res := s.get(server.URL + "/repos?format=csv")
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+		s.Empty(res.Header.Get("ETag"))
+	}
+	s.Equal(int32(2), s.forge.searches.Load())
+}
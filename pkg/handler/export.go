@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/export"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queryKeyFormat = "format"
+	queryKeyLayout = "layout"
+	queryKeyExcel  = "excel"
+
+	formatJSON = "json"
+
+	headerFailedSources = "X-Failed-Sources"
+)
+
+// exportOptions picks the response format from the format query parameter,
+// falling back to the Accept header so that spreadsheet tools can negotiate it
+func exportOptions(r *http.Request) (opts export.Options, exporting bool, err error) {
+	query := r.URL.Query()
+	opts.Format = strings.ToLower(query.Get(queryKeyFormat))
+	if opts.Format == "" {
+		opts.Format = negotiateFormat(r.Header.Get("Accept"))
+	}
+	if opts.Format == formatJSON {
+		return opts, false, nil
+	}
+
+	opts.Layout = strings.ToLower(query.Get(queryKeyLayout))
+	if opts.Layout == "" {
+		opts.Layout = export.LayoutWide
+	}
+	if excel := query.Get(queryKeyExcel); excel != "" {
+		opts.Excel, err = strconv.ParseBool(excel)
+		if err != nil {
+			return opts, false, fmt.Errorf("%w: excel must be a boolean", errInvalidParameter)
+		}
+	}
+	return opts, true, opts.Validate()
+}
+
+func negotiateFormat(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "text/csv":
+			return export.FormatCSV
+		case "text/tab-separated-values":
+			return export.FormatTSV
+		case "application/json":
+			return formatJSON
+		}
+	}
+	return formatJSON
+}
+
+// streamable tells whether the export can be written as the forges find the repositories: the long
+// layout needs no other repository to write the rows of one, as long as they don't have to be ranked
+func streamable(r *http.Request, opts export.Options) bool {
+	query := r.URL.Query()
+	return opts.Layout == export.LayoutLong &&
+		query.Get(queryKeySort) == "" && query.Get(queryKeyOrder) == "" && query.Get(queryKeyText) == ""
+}
+
+// writeExport writes the repositories as a download, the sources which failed
+// are listed in a header since the rows have nowhere to report them
+func writeExport(
+	w http.ResponseWriter,
+	log logrus.FieldLogger,
+	repos []model.Repository,
+	sources []federation.Source,
+	opts export.Options,
+) error {
+	if failed := failedSources(sources); failed != "" {
+		w.Header().Set(headerFailedSources, failed)
+	}
+	writeExportHeader(w, opts)
+
+	err := export.Write(w, repos, opts)
+	if err != nil {
+		log.WithError(err).Error("Failed to write repos export")
+		return err
+	}
+	return nil
+}
+
+// streamExport writes the rows of every repository as soon as a forge finds it, in no particular order.
+// The response starts with the first repository, so that a search which fails before finding any
+// still gets an error status. Since the status is sent by the time the other forges are done,
+// the sources which failed are listed in a trailer
+func (s Search) streamExport(w http.ResponseWriter, r *http.Request, log logrus.FieldLogger, opts export.Options) error {
+	searcher, err := s.Searcher(r.URL.Query().Get(queryKeyProvider), log)
+	if err != nil {
+		errorResponse(w, log, http.StatusBadRequest, err)
+		return err
+	}
+
+	var rows *export.LongWriter
+	start := func() {
+		w.Header().Set("Trailer", headerFailedSources)
+		writeExportHeader(w, opts)
+		rows, err = export.NewLongWriter(w, opts)
+	}
+	sources := searcher.Stream(r.Context(), filters(r), func(repo model.Repository) {
+		if rows == nil && err == nil {
+			start()
+		}
+		if rows != nil {
+			rows.Write(repo)
+		}
+	})
+	if rows == nil && err == nil {
+		if status, err := failure(sources); err != nil {
+			errorResponse(w, log, status, err)
+			return err
+		}
+		start()
+	}
+	if err == nil {
+		err = rows.Close()
+	}
+	if err != nil {
+		log.WithError(err).Error("Failed to write repos export")
+		return err
+	}
+	if failed := failedSources(sources); failed != "" {
+		w.Header().Set(headerFailedSources, failed)
+	}
+	return nil
+}
+
+func writeExportHeader(w http.ResponseWriter, opts export.Options) {
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": opts.Filename(time.Now()),
+	}))
+	w.WriteHeader(http.StatusOK)
+}
+
+// failedSources lists the providers which failed, separated by commas
+func failedSources(sources []federation.Source) string {
+	var failed []string
+	for _, source := range sources {
+		if source.Err != nil {
+			failed = append(failed, source.Provider)
+		}
+	}
+	return strings.Join(failed, ",")
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/feed"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	FeedAtom = "atom"
+	FeedRSS  = "rss"
+)
+
+// ReposFeed serves the same search as Repos as an Atom or RSS feed so that new repositories
+// matching a filter can be followed from a feed reader
+func ReposFeed(search Search, format string) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+		log := logger.Get(r.Context())
+
+		repos, _, err := search.run(w, r, log)
+		if err != nil {
+			return err
+		}
+
+		out := feed.Feed{
+			ID:       feedID(r),
+			Title:    feedTitle(r),
+			SelfLink: selfLink(r),
+			Entries:  make([]feed.Entry, 0, len(repos)),
+		}
+		for _, repo := range repos {
+			repo, seenAt := indexed(search, repo)
+			out.Entries = append(out.Entries, feed.NewEntry(repo, seenAt))
+		}
+
+		if format == FeedRSS {
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			err = feed.WriteRSS(w, out)
+		} else {
+			w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			err = feed.WriteAtom(w, out)
+		}
+		if err != nil {
+			log.WithError(err).Error("Failed to write repos feed")
+			return err
+		}
+		return nil
+	}
+}
+
+// indexed returns the creation time the index kept for the repository along with when the service
+// first came across it, both stay the same from one fetch of the feed to the next unlike the time
+// of the request
+func indexed(search Search, repo model.Repository) (model.Repository, time.Time) {
+	if search.Index != nil {
+		if record, ok := search.Index.Get(repo.Provider, repo.ID); ok {
+			repo.CreatedAt = record.CreatedAt
+			repo.CreatedAtEstimated = record.CreatedAtEstimated
+			return repo, record.IndexedAt
+		}
+	}
+	return repo, time.Now().UTC()
+}
+
+// feedID only depends on the query so that every fetch of the same feed has the same ID
+func feedID(r *http.Request) string {
+	return fmt.Sprintf("tag:%s,2024:%s?%s", hostname(r), r.URL.Path, r.URL.Query().Encode())
+}
+
+func feedTitle(r *http.Request) string {
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	criteria := make([]string, 0, len(keys))
+	for _, key := range keys {
+		criteria = append(criteria, key+"="+strings.Join(query[key], ","))
+	}
+	if len(criteria) == 0 {
+		return "New repositories"
+	}
+	return "New repositories matching " + strings.Join(criteria, " ")
+}
+
+func selfLink(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.RequestURI())
+}
+
+func hostname(r *http.Request) string {
+	host, _, found := strings.Cut(r.Host, ":")
+	if !found {
+		return r.Host
+	}
+	return host
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/graphqlapi"
+)
+
+// maxGraphQLRequest is far above any legitimate query, it only stops oversized bodies from being buffered
+const maxGraphQLRequest = 1 << 20
+
+// GraphQL runs queries sent either as JSON in the body of a POST or in the query string
+// of a GET. Queries which are malformed, invalid or over the limits are answered with
+// a 400, the errors raised while running a query are reported next to the data with a 200
+func GraphQL(executor *graphqlapi.Executor) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+
+		req, err := graphQLRequest(r)
+		if err != nil {
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+
+		result, rejected := executor.Execute(r.Context(), req)
+		status := http.StatusOK
+		if rejected {
+			status = http.StatusBadRequest
+			log.WithField("errors", result.Errors).Info("GraphQL query rejected")
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(status)
+
+		err = json.NewEncoder(w).Encode(result)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode graphql response JSON")
+			return err
+		}
+		return nil
+	}
+}
+
+func graphQLRequest(r *http.Request) (req graphqlapi.Request, err error) {
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req.Query = query.Get("query")
+		req.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return req, fmt.Errorf("%w: variables must be a JSON object", errInvalidParameter)
+			}
+		}
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLRequest))
+		if err != nil {
+			return req, fmt.Errorf("failed to read graphql request: %w", err)
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			return req, fmt.Errorf("%w: %w", errInvalidPayload, err)
+		}
+	}
+	if req.Query == "" {
+		return req, fmt.Errorf("%w: missing query", errInvalidParameter)
+	}
+	return req, nil
+}
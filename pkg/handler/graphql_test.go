@@ -0,0 +1,128 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/graphqlapi"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type graphqlTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+func TestGraphQL(t *testing.T) {
+	suite.Run(t, new(graphqlTestSuite))
+}
+
+func (s *graphqlTestSuite) SetupTest() {
+	search := handler.Search{
+		Forges: map[string]forge.Forge{
+			"github": &forgetest.Stub{
+				Provider:  "github",
+				Projects:  []forge.Project{{ID: 1, FullName: "owner/repo", Owner: "owner", CreatedAt: time.Now()}},
+				Languages: map[string]model.Language{"Go": {Bytes: 100, Percent: 100}},
+			},
+		},
+		DefaultProvider: "github",
+		WorkerCount:     2,
+		SourceTimeout:   time.Second,
+	}
+	executor, err := graphqlapi.NewExecutor(search.Searcher, store.NewMemory(), graphqlapi.Limits{MaxDepth: 3})
+	s.Require().NoError(err)
+
+	router := handlers.NewRouter(logger.Default())
+	router.HandleFunc("/graphql", handler.GraphQL(executor)).Methods(http.MethodGet, http.MethodPost)
+	s.server = httptest.NewServer(router)
+}
+
+func (s *graphqlTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+type graphqlResponse struct {
+	Data struct {
+		Repositories struct {
+			Nodes []struct {
+				FullName string `json:"fullName"`
+			} `json:"nodes"`
+		} `json:"repositories"`
+	} `json:"data"`
+	Errors []struct {
+		Message    string `json:"message"`
+		Extensions struct {
+			Code string `json:"code"`
+		} `json:"extensions"`
+	} `json:"errors"`
+}
+
+func (s *graphqlTestSuite) decode(res *http.Response) graphqlResponse {
+	defer res.Body.Close()
+	var out graphqlResponse
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&out))
+	return out
+}
+
+func (s *graphqlTestSuite) TestPost() {
+	res, err := http.Post(s.server.URL+"/graphql", "application/json", strings.NewReader(
+		`{"query": "query($first: Int) { repositories(first: $first) { nodes { fullName } } }", "variables": {"first": 5}}`,
+	))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("application/json", res.Header.Get("Content-Type"))
+
+	body := s.decode(res)
+	s.Empty(body.Errors)
+	s.Require().Len(body.Data.Repositories.Nodes, 1)
+	s.Equal("owner/repo", body.Data.Repositories.Nodes[0].FullName)
+}
+
+func (s *graphqlTestSuite) TestGet() {
+	query := url.Values{
+		"query":     {"query($first: Int) { repositories(first: $first) { nodes { fullName } } }"},
+		"variables": {`{"first": 1}`},
+	}
+	res, err := http.Get(s.server.URL + "/graphql?" + query.Encode())
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Len(s.decode(res).Data.Repositories.Nodes, 1)
+}
+
+func (s *graphqlTestSuite) TestRejectedQuery() {
+	query := url.Values{"query": {"{ repositories { nodes { owner { login } } } }"}}
+	res, err := http.Get(s.server.URL + "/graphql?" + query.Encode())
+	s.Require().NoError(err)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+
+	body := s.decode(res)
+	s.Require().Len(body.Errors, 1)
+	s.Equal("QUERY_TOO_COMPLEX", body.Errors[0].Extensions.Code)
+}
+
+func (s *graphqlTestSuite) TestInvalidRequest() {
+	for _, path := range []string{"/graphql", "/graphql?query=%7B%7D&variables=nope"} {
+		res, err := http.Get(s.server.URL + path)
+		s.Require().NoError(err)
+		res.Body.Close()
+		s.Equal(http.StatusBadRequest, res.StatusCode, path)
+	}
+
+	res, err := http.Post(s.server.URL+"/graphql", "application/json", strings.NewReader("{"))
+	s.Require().NoError(err)
+	res.Body.Close()
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+}
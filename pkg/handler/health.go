@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/github"
+)
+
+// TokenHealth reports the state of every github access token the client is pooling
+func TokenHealth(githubClient github.Client) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(githubClient.TokenHealth())
+		if err != nil {
+			log.WithError(err).Error("Failed to encode token health JSON")
+			return err
+		}
+		return nil
+	}
+}
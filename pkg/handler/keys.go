@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+)
+
+type appKeys struct {
+	AppID             string           `json:"app_id"`
+	ActiveFingerprint string           `json:"active_fingerprint"`
+	Keys              []auth.KeyStatus `json:"keys"`
+}
+
+// Keys reports which private key each github app is currently signing its tokens with
+func Keys(apps []auth.App) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+
+		out := make([]appKeys, 0, len(apps))
+		for _, app := range apps {
+			out = append(out, appKeys{
+				AppID:             app.ID,
+				ActiveFingerprint: app.Keys.Active(),
+				Keys:              app.Keys.Status(),
+			})
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err := json.NewEncoder(w).Encode(out)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode keys JSON")
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/openapi"
+	"github.com/sirupsen/logrus"
+)
+
+// OpenAPI serves the document describing the API
+func OpenAPI(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+	log := logger.Get(r.Context())
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	_, err := w.Write(openapi.Spec)
+	if err != nil {
+		log.WithError(err).Error("Failed to write openapi document")
+		return err
+	}
+	return nil
+}
+
+// ValidateRequest rejects the requests whose parameters don't match the OpenAPI document
+// with a 400 listing every offending parameter, before they reach the handlers
+func ValidateRequest(doc *openapi.Document) handlers.MiddlewareFunc {
+	return func(next handlers.HandlerFunc) handlers.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+			errs := doc.Validate(r)
+			if len(errs) == 0 {
+				return next(w, r, vars)
+			}
+
+			log := logger.Get(r.Context())
+			err := fmt.Errorf("%w: %w", errInvalidParameter, errs[0])
+			invalidParametersResponse(w, log, err, errs)
+			return err
+		}
+	}
+}
+
+func invalidParametersResponse(w http.ResponseWriter, log logrus.FieldLogger, err error, errs []openapi.ParameterError) {
+	log.WithError(err).Error("Request failed")
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	var body = struct {
+		Message string                   `json:"message"`
+		Errors  []openapi.ParameterError `json:"errors"`
+	}{Message: errInvalidParameter.Error(), Errors: errs}
+	err = json.NewEncoder(w).Encode(body)
+	if err != nil {
+		w.Write([]byte("failed to encode response body"))
+	}
+}
@@ -0,0 +1,98 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/openapi"
+	"github.com/stretchr/testify/suite"
+)
+
+type openapiTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+func TestOpenAPI(t *testing.T) {
+	suite.Run(t, new(openapiTestSuite))
+}
+
+func (s *openapiTestSuite) SetupTest() {
+	doc, err := openapi.Load()
+	s.Require().NoError(err)
+
+	router := handlers.NewRouter(logger.Default())
+	router.Use(handler.ValidateRequest(doc))
+	search := handler.Search{
+		Forges: map[string]forge.Forge{
+			"github": &forgetest.Stub{
+				Provider:  "github",
+				Projects:  []forge.Project{{ID: 1, FullName: "owner/repo", CreatedAt: time.Now()}},
+				Languages: map[string]model.Language{"Go": {Bytes: 100, Percent: 100}},
+			},
+		},
+		DefaultProvider: "github",
+		WorkerCount:     2,
+		SourceTimeout:   time.Second,
+	}
+	router.HandleFunc("/repos", handler.Repos(search))
+	router.HandleFunc("/openapi.json", handler.OpenAPI)
+	s.server = httptest.NewServer(router)
+}
+
+func (s *openapiTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *openapiTestSuite) get(path string) (*http.Response, []byte) {
+	res, err := http.Get(s.server.URL + path)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	s.Require().NoError(err)
+	return res, b
+}
+
+func (s *openapiTestSuite) TestOpenAPI_ServesDocument() {
+	res, body := s.get("/openapi.json")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("application/json", res.Header.Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+	}
+	s.Require().NoError(json.Unmarshal(body, &doc))
+	s.Equal("3.0.3", doc.OpenAPI)
+}
+
+// every parameter the handler reads is accepted by the document
+func (s *openapiTestSuite) TestValidateRequest_PassesDocumentedParameters() {
+	res, _ := s.get("/repos?provider=github&language=go&format=tsv&layout=long&excel=false")
+	s.Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *openapiTestSuite) TestValidateRequest_StructuredBadRequest() {
+	res, body := s.get("/repos?format=xlsx&per_page=10")
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+
+	var out struct {
+		Message string                   `json:"message"`
+		Errors  []openapi.ParameterError `json:"errors"`
+	}
+	s.Require().NoError(json.Unmarshal(body, &out))
+	s.Equal("invalid parameter", out.Message)
+	s.Equal([]openapi.ParameterError{
+		{Name: "format", In: "query", Reason: "must be one of json, csv, tsv"},
+		{Name: "per_page", In: "query", Reason: "is not a known parameter"},
+	}, out.Errors)
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+)
+
+const headerAPIKey = "X-API-Key"
+
+var errAdminKeyRequired = errors.New("an admin API key is required")
+
+// RequireAPIKey rejects the requests which don't carry a known key in the X-API-Key header or
+// as a bearer token, and the ones over the rate limit or the quota of their key. The calls made
+// to github while serving a request count against the quota of its key, which the X-RateLimit-*
+// headers of the response report. The public paths are served to everyone
+func RequireAPIKey(keyring *apikey.Keyring, public ...string) handlers.MiddlewareFunc {
+	open := make(map[string]struct{}, len(public))
+	for _, path := range public {
+		open[path] = struct{}{}
+	}
+
+	return func(next handlers.HandlerFunc) handlers.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+			if _, ok := open[r.URL.Path]; ok {
+				return next(w, r, vars)
+			}
+
+			log := logger.Get(r.Context())
+			client, err := keyring.Lookup(requestAPIKey(r))
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				errorResponse(w, log, http.StatusUnauthorized, err)
+				return err
+			}
+			ctx, log := logger.WithFieldToCtx(r.Context(), "api_key", client.Name)
+
+			wait, err := client.Allow()
+			if err != nil {
+				setRateLimitHeaders(w.Header(), client.Usage())
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				errorResponse(w, log, http.StatusTooManyRequests, err)
+				return err
+			}
+
+			w = &rateLimitWriter{ResponseWriter: w, client: client}
+			return next(w, r.WithContext(apikey.WithClient(ctx, client)), vars)
+		}
+	}
+}
+
+// RequireAdminKey turns away the keys which aren't admin keys from the paths, it is added
+// after RequireAPIKey which attaches the client of the key to the request
+func RequireAdminKey(paths ...string) handlers.MiddlewareFunc {
+	restricted := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		restricted[path] = struct{}{}
+	}
+
+	return func(next handlers.HandlerFunc) handlers.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, vars map[string]string) error {
+			if _, ok := restricted[r.URL.Path]; !ok {
+				return next(w, r, vars)
+			}
+			if client, ok := apikey.FromContext(r.Context()); ok && !client.Admin {
+				errorResponse(w, logger.Get(r.Context()), http.StatusForbidden, errAdminKeyRequired)
+				return errAdminKeyRequired
+			}
+			return next(w, r, vars)
+		}
+	}
+}
+
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get(headerAPIKey); key != "" {
+		return key
+	}
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// setRateLimitHeaders reports the quota the way github does, the limit and remaining
+// calls are left out for the keys without a quota
+func setRateLimitHeaders(header http.Header, usage apikey.Usage) {
+	if usage.Limit > 0 {
+		header.Set("X-RateLimit-Limit", strconv.Itoa(usage.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(usage.Remaining))
+	}
+	header.Set("X-RateLimit-Used", strconv.Itoa(usage.Used))
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(usage.Reset.Unix(), 10))
+}
+
+// rateLimitWriter sets the rate limit headers when the response starts, so that they
+// account for the calls the handler made upstream
+type rateLimitWriter struct {
+	http.ResponseWriter
+	client      *apikey.Client
+	wroteHeader bool
+}
+
+func (w *rateLimitWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		setRateLimitHeaders(w.Header(), w.client.Usage())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *rateLimitWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets the batches of export rows through the writer
+func (w *rateLimitWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,130 @@
+package handler_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/stretchr/testify/suite"
+)
+
+type rateLimitTestSuite struct {
+	suite.Suite
+	upstream *httptest.Server
+	server   *httptest.Server
+}
+
+func TestRateLimit(t *testing.T) {
+	suite.Run(t, new(rateLimitTestSuite))
+}
+
+func (s *rateLimitTestSuite) SetupTest() {
+	s.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	keyring, err := apikey.NewKeyring([]apikey.Key{
+		{Name: "ci", Secret: "s3cr3t"},
+		{Name: "slow", Secret: "slow", Limits: apikey.Limits{Rate: 0.01, Burst: 1}},
+		{Name: "ops", Secret: "admin", Admin: true},
+	}, apikey.Limits{Rate: 1000, Burst: 100, Quota: 5, Window: time.Hour})
+	s.Require().NoError(err)
+
+	upstream := &http.Client{Transport: apikey.Metered(nil)}
+	router := handlers.NewRouter(logger.Default())
+	router.Use(handler.RequireAPIKey(keyring, "/ping"))
+	router.Use(handler.RequireAdminKey("/admin/keys"))
+	router.HandleFunc("/ping", handler.Pong)
+	router.HandleFunc("/admin/keys", handler.Pong)
+	// each search makes two calls upstream
+	router.HandleFunc("/repos", func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		for i := 0; i < 2; i++ {
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, s.upstream.URL, nil)
+			s.Require().NoError(err)
+			res, err := upstream.Do(req)
+			s.Require().NoError(err)
+			res.Body.Close()
+		}
+		w.Write([]byte("[]"))
+		return nil
+	})
+	s.server = httptest.NewServer(router)
+}
+
+func (s *rateLimitTestSuite) TearDownTest() {
+	s.server.Close()
+	s.upstream.Close()
+}
+
+func (s *rateLimitTestSuite) get(path string, header ...string) *http.Response {
+	req, err := http.NewRequest(http.MethodGet, s.server.URL+path, nil)
+	s.Require().NoError(err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	res, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	res.Body.Close()
+	return res
+}
+
+func (s *rateLimitTestSuite) TestRequiresAKnownKey() {
+	res := s.get("/repos")
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+	s.Equal("Bearer", res.Header.Get("WWW-Authenticate"))
+	res = s.get("/repos", "X-API-Key", "wrong")
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	res = s.get("/ping")
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Empty(res.Header.Get("X-RateLimit-Used"))
+
+	res = s.get("/repos", "Authorization", "Bearer s3cr3t")
+	s.Equal(http.StatusOK, res.StatusCode)
+}
+
+func (s *rateLimitTestSuite) TestReportsTheQuotaOfUpstreamCalls() {
+	res := s.get("/repos", "X-API-Key", "s3cr3t")
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("5", res.Header.Get("X-RateLimit-Limit"))
+	s.Equal("2", res.Header.Get("X-RateLimit-Used"))
+	s.Equal("3", res.Header.Get("X-RateLimit-Remaining"))
+	reset, err := strconv.ParseInt(res.Header.Get("X-RateLimit-Reset"), 10, 64)
+	s.Require().NoError(err)
+	s.InDelta(time.Now().Add(time.Hour).Unix(), reset, 5)
+
+	res = s.get("/repos", "X-API-Key", "s3cr3t")
+	s.Equal("1", res.Header.Get("X-RateLimit-Remaining"))
+	// the last call left goes over the quota, the requests after it are turned away
+	res = s.get("/repos", "X-API-Key", "s3cr3t")
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("0", res.Header.Get("X-RateLimit-Remaining"))
+
+	res = s.get("/repos", "X-API-Key", "s3cr3t")
+	s.Equal(http.StatusTooManyRequests, res.StatusCode)
+	s.Equal("6", res.Header.Get("X-RateLimit-Used"))
+	retry, err := strconv.Atoi(res.Header.Get("Retry-After"))
+	s.Require().NoError(err)
+	s.InDelta(3600, retry, 5)
+}
+
+func (s *rateLimitTestSuite) TestRateLimitsEachKey() {
+	s.Equal(http.StatusOK, s.get("/repos", "X-API-Key", "slow").StatusCode)
+	res := s.get("/repos", "X-API-Key", "slow")
+	s.Equal(http.StatusTooManyRequests, res.StatusCode)
+	s.Equal("100", res.Header.Get("Retry-After"))
+
+	// the other keys have their own bucket
+	s.Equal(http.StatusOK, s.get("/repos", "X-API-Key", "s3cr3t").StatusCode)
+}
+
+func (s *rateLimitTestSuite) TestAdminKey() {
+	s.Equal(http.StatusForbidden, s.get("/admin/keys", "X-API-Key", "s3cr3t").StatusCode)
+	s.Equal(http.StatusUnauthorized, s.get("/admin/keys").StatusCode)
+	s.Equal(http.StatusOK, s.get("/admin/keys", "X-API-Key", "admin").StatusCode)
+	// the other paths are open to every key
+	s.Equal(http.StatusOK, s.get("/repos", "X-API-Key", "admin").StatusCode)
+}
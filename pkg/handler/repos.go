@@ -1,53 +1,343 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Scalingo/go-handlers"
 	"github.com/Scalingo/go-utils/logger"
-	"github.com/laouji/git-repo-searcher/pkg/github"
-	"github.com/laouji/git-repo-searcher/pkg/searcher"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/export"
+	"github.com/laouji/git-repo-searcher/pkg/facet"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/fulltext"
+	"github.com/laouji/git-repo-searcher/pkg/httpcache"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/laouji/git-repo-searcher/pkg/stats"
+	"github.com/laouji/git-repo-searcher/pkg/store"
 	"github.com/laouji/git-repo-searcher/pkg/subrequester"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
 	"github.com/sirupsen/logrus"
 )
 
-func Repos(
+const (
+	queryKeyProvider = "provider"
+	queryKeySort     = "sort"
+	queryKeyOrder    = "order"
+	queryKeyText     = "text"
+
+	queryKeyFacets     = "facets"
+	queryKeyFacetLimit = "facet_limit"
+	defaultFacetLimit  = 10
+	maxFacetLimit      = 100
+	// providerAll searches every configured forge
+	providerAll = "all"
+)
+
+var (
+	errInvalidPayload   = errors.New("invalid payload")
+	errInvalidParameter = errors.New("invalid parameter")
+)
+
+// federatedResponse is returned when several forges are searched at once, so that the
+// caller can tell an empty forge apart from one that failed, or when facets are requested
+type federatedResponse struct {
+	Repositories []model.Repository      `json:"repositories"`
+	Sources      []federation.Source     `json:"sources"`
+	Facets       map[string]facet.Result `json:"facets,omitempty"`
+}
+
+// resultSet is what the ETag of a /repos response is computed from. The sources are left out
+// since their durations change from one search to the next when the results don't
+type resultSet struct {
+	Repositories []model.Repository      `json:"repositories"`
+	Facets       map[string]facet.Result `json:"facets,omitempty"`
+}
+
+// Search holds what the HTTP handlers and the gRPC server serving search results need to run a search
+type Search struct {
+	Forges          map[string]forge.Forge
+	DefaultProvider string
+	WorkerCount     int
+	SourceTimeout   time.Duration
+	// Index records every repository found, it is optional
+	Index store.Store
+	// Flights lets identical searches running at the same time share their work, it is optional
+	Flights *federation.Flights
+	// MaxAge is how long clients and proxies may reuse a /repos response, they revalidate it when it is zero
+	MaxAge time.Duration
+	// Private marks the /repos responses as only reusable by the client which made the request,
+	// for when API keys are required and shared caches must not hand them to clients without one
+	Private bool
+	// Cache keeps the /repos responses for a short time, it is optional
+	Cache *httpcache.Cache
+	// Text answers text queries from the repositories of Index rather than from the forges, it is optional
+	Text *fulltext.Index
+	// Scorer ranks the results of text queries, the relevance computed by Text or
+	// ranking.DefaultScorer is used when it is nil
+	Scorer ranking.Scorer
+}
+
+// run searches the forges named in the provider query parameter.
+// When it returns an error the response was already written
+func (s Search) run(
+	w http.ResponseWriter,
+	r *http.Request,
+	log logrus.FieldLogger,
+	observers ...func(model.Repository),
+) (repos []model.Repository, sources []federation.Source, err error) {
+	searcher, err := s.Searcher(r.URL.Query().Get(queryKeyProvider), log)
+	if err != nil {
+		errorResponse(w, log, http.StatusBadRequest, err)
+		return repos, sources, err
+	}
+	repos, sources = searcher.Search(r.Context(), filters(r), observers...)
+	if status, err := failure(sources); err != nil {
+		errorResponse(w, log, status, err)
+		return repos, sources, err
+	}
+	if repos == nil {
+		repos = []model.Repository{}
+	}
+	return repos, sources, nil
+}
+
+// failure tells whether the search failed as a whole: a single forge fails like it always did,
+// several only fail if none of them answered
+func failure(sources []federation.Source) (status int, err error) {
+	if len(sources) == 1 {
+		return http.StatusInternalServerError, sources[0].Err
+	}
+	return http.StatusBadGateway, federation.AllFailed(sources)
+}
+
+// runText looks the text query up in the text index instead of searching the forges, so that
+// it covers every repository the service came across. Unless a scorer is configured, the
+// order ranks the repositories by the relevance the index computed
+func (s Search) runText(
+	w http.ResponseWriter,
+	r *http.Request,
 	log logrus.FieldLogger,
-	githubClient github.Client,
-	workerCount int,
-) handlers.HandlerFunc {
-	repoSearcher := searcher.NewSearcher(githubClient)
+	order *ranking.Order,
+	observers ...func(model.Repository),
+) (repos []model.Repository, err error) {
+	provider := strings.ToLower(r.URL.Query().Get(queryKeyProvider))
+	if provider == "" {
+		provider = s.DefaultProvider
+	}
+	selected, err := selectForges(s.Forges, provider)
+	if err != nil {
+		errorResponse(w, log, http.StatusBadRequest, err)
+		return repos, err
+	}
+	providers := make(map[string]struct{}, len(selected))
+	for _, f := range selected {
+		providers[f.Name()] = struct{}{}
+	}
+
+	filters := filters(r)
+	scores := make(map[string]float64)
+	repos = []model.Repository{}
+	for _, hit := range s.Text.Search(order.Text) {
+		if _, ok := providers[hit.Provider]; !ok {
+			continue
+		}
+		record, ok := s.Index.Get(hit.Provider, hit.ID)
+		if !ok || !subrequester.Relevant(record.Languages, filters) {
+			continue
+		}
+		repos = append(repos, record.Repository)
+		scores[textKey(record.Provider, record.ID)] = hit.Score
+	}
+
+	if s.Scorer == nil {
+		order.Scorer = ranking.ScorerFunc(func(_ string, repo model.Repository) float64 {
+			return scores[textKey(repo.Provider, repo.ID)]
+		})
+	}
+	for _, repo := range repos {
+		for _, observe := range observers {
+			observe(repo)
+		}
+	}
+	return repos, nil
+}
+
+func textKey(provider string, ID int64) string {
+	return provider + ":" + strconv.FormatInt(ID, 10)
+}
+
+// Searcher searches the forges named by provider, either a single name, a comma separated
+// list or "all". An empty provider searches the default ones
+func (s Search) Searcher(provider string, log logrus.FieldLogger) (*federation.Searcher, error) {
+	provider = strings.ToLower(provider)
+	if provider == "" {
+		provider = s.DefaultProvider
+	}
+	selected, err := selectForges(s.Forges, provider)
+	if err != nil {
+		return nil, err
+	}
+	searcher := federation.NewSearcher(selected, s.WorkerCount, s.SourceTimeout, s.Index, log)
+	if s.Flights != nil {
+		searcher.Coalesce(s.Flights)
+	}
+	return searcher, nil
+}
+
+// Repos responds with the most recent repositories of the searched forges. JSON responses carry
+// an ETag computed from the repositories and facets, and are kept in the cache when there is one
+func Repos(search Search) handlers.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request, vars map[string]string) error {
 		log := logger.Get(r.Context())
 
-		repos, err := repoSearcher.Search(r.Context())
+		exportOpts, exporting, err := exportOptions(r)
 		if err != nil {
-			errorResponse(w, log, http.StatusInternalServerError, err)
+			errorResponse(w, log, http.StatusBadRequest, err)
 			return err
 		}
 
-		subRequester := subrequester.NewSubRequester(workerCount, githubClient, log)
-		out, err := subRequester.Collect(r.Context(), repos, filters(r))
+		// exports are written to the client in batches rather than buffered, so they are left out of the cache
+		var cacheKey string
+		if search.Cache != nil && !exporting {
+			cacheKey = httpcache.Key(r.URL.Path, r.URL.Query(), subrequester.FilterKeyLanguage)
+			if entry, ok := search.Cache.Get(cacheKey); ok {
+				log.Debug("Serving repos from the cache")
+				return search.writeEntry(w, r, log, entry, true)
+			}
+		}
+		order, err := search.order(r)
 		if err != nil {
-			errorResponse(w, log, http.StatusInternalServerError, err)
+			errorResponse(w, log, http.StatusBadRequest, err)
 			return err
 		}
+		counter, err := facetCounter(r)
+		if err != nil {
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+		if exporting && streamable(r, exportOpts) {
+			return search.streamExport(w, r, log, exportOpts)
+		}
 
-		w.Header().Add("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		// facets are counted as the repositories are found, over the ones the text query keeps
+		var observers []func(model.Repository)
+		if counter != nil {
+			observers = append(observers, func(repo model.Repository) {
+				if order.Matches(repo) {
+					counter.Add(repo)
+				}
+			})
+		}
+		var repos []model.Repository
+		var sources []federation.Source
+		if order.Text != "" && search.Text != nil && search.Index != nil {
+			repos, err = search.runText(w, r, log, &order, observers...)
+		} else {
+			repos, sources, err = search.run(w, r, log, observers...)
+		}
+		if err != nil {
+			return err
+		}
+		repos = order.Apply(repos)
+		if exporting {
+			return writeExport(w, log, repos, sources, exportOpts)
+		}
+
+		results := resultSet{Repositories: repos}
+		if counter != nil {
+			results.Facets = counter.Results()
+		}
+		// a single forge keeps the plain list response unless facets are requested
+		var out interface{} = repos
+		if len(sources) > 1 || counter != nil {
+			out = federatedResponse{Repositories: repos, Sources: sources, Facets: results.Facets}
+		}
 
-		err = json.NewEncoder(w).Encode(out)
+		body := &bytes.Buffer{}
+		err = json.NewEncoder(body).Encode(out)
 		if err != nil {
 			log.WithError(err).Error("Failed to encode repos response JSON")
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+		tagged, err := json.Marshal(results)
+		if err != nil {
+			log.WithError(err).Error("Failed to encode repos result set JSON")
+			errorResponse(w, log, http.StatusInternalServerError, err)
 			return err
 		}
-		return nil
+
+		entry := httpcache.Entry{Body: body.Bytes(), ContentType: "application/json", ETag: httpcache.ETag(tagged)}
+		if cacheKey != "" {
+			entry = search.Cache.Set(cacheKey, entry)
+		}
+		return search.writeEntry(w, r, log, entry, false)
 	}
 }
 
+// order reads how the results are ranked from the sort, order and text query parameters
+func (s Search) order(r *http.Request) (ranking.Order, error) {
+	query := r.URL.Query()
+	return ranking.NewOrder(query.Get(queryKeySort), query.Get(queryKeyOrder), query.Get(queryKeyText), s.Scorer)
+}
+
+// facetCounter counts the facets named in the facets query parameter, it is nil when there are none
+func facetCounter(r *http.Request) (*facet.Counter, error) {
+	query := r.URL.Query()
+	facets, err := facet.Parse(query.Get(queryKeyFacets))
+	if err != nil || len(facets) == 0 {
+		return nil, err
+	}
+	limit := defaultFacetLimit
+	if raw := query.Get(queryKeyFacetLimit); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxFacetLimit {
+			return nil, fmt.Errorf("%w: facet_limit must be between 1 and %d", errInvalidParameter, maxFacetLimit)
+		}
+	}
+	return facet.NewCounter(facets, limit), nil
+}
+
+func selectForges(forges map[string]forge.Forge, provider string) (selected []forge.Forge, err error) {
+	if provider == providerAll {
+		names := make([]string, 0, len(forges))
+		for name := range forges {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			selected = append(selected, forges[name])
+		}
+		return selected, nil
+	}
+
+	seen := make(map[string]struct{})
+	for _, name := range strings.Split(provider, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		f, ok := forges[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", federation.ErrUnknownProvider, name)
+		}
+		seen[name] = struct{}{}
+		selected = append(selected, f)
+	}
+	return selected, nil
+}
+
 func filters(r *http.Request) map[string]string {
 	filters := make(map[string]string)
 
@@ -64,12 +354,42 @@ func filters(r *http.Request) map[string]string {
 func errorResponse(w http.ResponseWriter, log logrus.FieldLogger, status int, err error) {
 	var msg string
 	switch {
-	case errors.Is(err, github.ErrAuthentication):
+	case errors.Is(err, forge.ErrAuthentication):
+		status = http.StatusUnauthorized
+		msg = forge.ErrAuthentication.Error()
+	case errors.Is(err, forge.ErrRateLimit):
+		status = http.StatusForbidden
+		msg = forge.ErrRateLimit.Error()
+	case errors.Is(err, federation.ErrUnknownProvider),
+		errors.Is(err, export.ErrUnknownFormat),
+		errors.Is(err, export.ErrUnknownLayout),
+		errors.Is(err, ranking.ErrUnknownKey),
+		errors.Is(err, ranking.ErrUnknownDirection),
+		errors.Is(err, ranking.ErrMissingText),
+		errors.Is(err, facet.ErrUnknownFacet),
+		errors.Is(err, stats.ErrUnknownInterval),
+		errors.Is(err, stats.ErrInvalidRange),
+		errors.Is(err, errInvalidPayload),
+		errors.Is(err, errInvalidParameter),
+		errors.Is(err, errMissingDelivery):
+		msg = err.Error()
+	case errors.Is(err, apikey.ErrUnknownKey):
 		status = http.StatusUnauthorized
-		msg = github.ErrAuthentication.Error()
-	case errors.Is(err, github.ErrRateLimit):
+		msg = apikey.ErrUnknownKey.Error()
+	case errors.Is(err, apikey.ErrRateLimited), errors.Is(err, apikey.ErrQuotaExceeded):
+		status = http.StatusTooManyRequests
+		msg = err.Error()
+	case errors.Is(err, errAdminKeyRequired):
 		status = http.StatusForbidden
-		msg = github.ErrRateLimit.Error()
+		msg = err.Error()
+	case errors.Is(err, savedsearch.ErrNotFound):
+		status = http.StatusNotFound
+		msg = savedsearch.ErrNotFound.Error()
+	case errors.Is(err, savedsearch.ErrInvalid):
+		status = http.StatusBadRequest
+		msg = err.Error()
+	case errors.Is(err, webhook.ErrInvalidSignature):
+		msg = webhook.ErrInvalidSignature.Error()
 	default:
 		msg = "internal error"
 	}
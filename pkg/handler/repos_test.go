@@ -0,0 +1,291 @@
+package handler_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/fulltext"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type reposTestSuite struct {
+	suite.Suite
+	forges map[string]forge.Forge
+	server *httptest.Server
+}
+
+func TestRepos(t *testing.T) {
+	suite.Run(t, new(reposTestSuite))
+}
+
+func (s *reposTestSuite) SetupTest() {
+	created := time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC)
+	s.forges = map[string]forge.Forge{
+		"github": &forgetest.Stub{
+			Provider: "github",
+			Projects: []forge.Project{
+				{ID: 1, Name: "old", FullName: "owner/old", Owner: "owner", CreatedAt: created.Add(-time.Minute)},
+				{ID: 2, Name: "new", FullName: "owner/new", Owner: "owner", CreatedAt: created},
+			},
+			Languages: map[string]model.Language{"Go": {Bytes: 100, Percent: 100}},
+		},
+		"gitlab": &forgetest.Stub{Provider: "gitlab", Err: forge.ErrRateLimit},
+	}
+	router := handlers.NewRouter(logger.Default())
+	search := handler.Search{
+		Forges:          s.forges,
+		DefaultProvider: "github",
+		WorkerCount:     2,
+		SourceTimeout:   time.Second,
+		Index:           store.NewMemory(),
+	}
+	router.HandleFunc("/repos", handler.Repos(search))
+	router.HandleFunc("/repos/feed.atom", handler.ReposFeed(search, handler.FeedAtom))
+	router.HandleFunc("/repos/feed.rss", handler.ReposFeed(search, handler.FeedRSS))
+	s.server = httptest.NewServer(router)
+}
+
+func (s *reposTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *reposTestSuite) get(path string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, s.server.URL+path, nil)
+	s.Require().NoError(err)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	res, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	s.Require().NoError(err)
+	return res, string(b)
+}
+
+func (s *reposTestSuite) TestExport_CSVDownload() {
+	res, body := s.get("/repos?format=csv&layout=long", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("text/csv; charset=utf-8", res.Header.Get("Content-Type"))
+	s.True(strings.HasPrefix(res.Header.Get("Content-Disposition"), `attachment; filename=repos-long-`))
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	s.Require().Len(lines, 3)
+	s.True(strings.HasPrefix(lines[0], "provider,id,"))
+	// without a sort the rows are written in the order the repositories are found
+	s.Contains(body, "\ngithub,2,owner/new,")
+	s.Contains(body, "\ngithub,1,owner/old,")
+	s.True(strings.HasSuffix(lines[1], ",go,100,100.00"))
+}
+
+func (s *reposTestSuite) TestExport_Sorted() {
+	res, body := s.get("/repos?format=csv&layout=long&sort=created&order=asc", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	s.Require().Len(lines, 3)
+	s.True(strings.HasPrefix(lines[1], "github,1,owner/old,"))
+	s.True(strings.HasPrefix(lines[2], "github,2,owner/new,"))
+}
+
+func (s *reposTestSuite) TestExport_StreamsRowsAsTheyAreFound() {
+	s.forges["slow"] = &forgetest.Stub{
+		Provider: "slow",
+		Projects: []forge.Project{{ID: 3, Name: "late", FullName: "owner/late", Owner: "owner"}},
+		Delay:    500 * time.Millisecond,
+	}
+	start := time.Now()
+	res, err := http.Get(s.server.URL + "/repos?provider=github,slow&format=csv&layout=long")
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	// the rows of github are there before the slow forge is done
+	lines := bufio.NewScanner(res.Body)
+	for i := 0; i < 3; i++ {
+		s.Require().True(lines.Scan())
+	}
+	s.Less(time.Since(start), 500*time.Millisecond)
+
+	for lines.Scan() {
+		s.True(strings.HasPrefix(lines.Text(), "slow,3,owner/late,"))
+	}
+	s.Empty(res.Trailer.Get("X-Failed-Sources"))
+}
+
+func (s *reposTestSuite) TestExport_StreamReportsFailedSourcesInTrailer() {
+	res, body := s.get("/repos?provider=all&format=csv&layout=long", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Len(strings.Split(strings.TrimSpace(body), "\n"), 3)
+	s.Equal("gitlab", res.Trailer.Get("X-Failed-Sources"))
+}
+
+func (s *reposTestSuite) TestExport_StreamFailsBeforeFindingAnything() {
+	res, body := s.get("/repos?provider=gitlab&format=csv&layout=long", nil)
+	s.Equal(http.StatusForbidden, res.StatusCode)
+	s.Contains(body, forge.ErrRateLimit.Error())
+}
+
+func (s *reposTestSuite) TestExport_NegotiatedFromAcceptHeader() {
+	res, body := s.get("/repos", http.Header{"Accept": {"text/tab-separated-values, */*;q=0.1"}})
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("text/tab-separated-values; charset=utf-8", res.Header.Get("Content-Type"))
+	s.True(strings.HasPrefix(body, "provider\tid\t"))
+}
+
+func (s *reposTestSuite) TestExport_ReportsFailedSources() {
+	res, _ := s.get("/repos?provider=all&format=csv", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("gitlab", res.Header.Get("X-Failed-Sources"))
+}
+
+func (s *reposTestSuite) TestExport_UnknownFormat() {
+	res, body := s.get("/repos?format=xlsx", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	s.Contains(body, "unknown export format")
+}
+
+func (s *reposTestSuite) TestFeed_Atom() {
+	res, body := s.get("/repos/feed.atom?language=go", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("application/atom+xml; charset=utf-8", res.Header.Get("Content-Type"))
+	s.Contains(body, "<title>New repositories matching language=go</title>")
+	s.Contains(body, "<id>tag:github,2008:Repository/2</id>")
+	s.Contains(body, "<updated>2024-05-02T17:41:07Z</updated>")
+
+	// the feed is unchanged when nothing new matched since the previous fetch
+	_, again := s.get("/repos/feed.atom?language=go", nil)
+	s.Equal(body, again)
+}
+
+func (s *reposTestSuite) TestFeed_RSS() {
+	res, body := s.get("/repos/feed.rss", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("application/rss+xml; charset=utf-8", res.Header.Get("Content-Type"))
+	s.Contains(body, `<guid isPermaLink="false">tag:github,2008:Repository/1</guid>`)
+	s.Contains(body, "<pubDate>Thu, 02 May 2024 17:40:07 +0000</pubDate>")
+}
+
+func (s *reposTestSuite) TestFeed_UnknownProvider() {
+	res, _ := s.get("/repos/feed.atom?provider=bitbucket", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func (s *reposTestSuite) TestRepos_Sort() {
+	res, body := s.get("/repos?sort=id&order=asc", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Less(strings.Index(body, "owner/old"), strings.Index(body, "owner/new"))
+
+	res, body = s.get("/repos", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Less(strings.Index(body, "owner/new"), strings.Index(body, "owner/old"))
+}
+
+func (s *reposTestSuite) TestRepos_TextQuery() {
+	res, body := s.get("/repos?text=old", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Contains(body, "owner/old")
+	s.NotContains(body, "owner/new")
+}
+
+func (s *reposTestSuite) TestRepos_InvalidSort() {
+	res, body := s.get("/repos?sort=popularity", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	s.Contains(body, "unknown sort")
+
+	res, body = s.get("/repos?sort=relevance", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	s.Contains(body, "requires a text query")
+}
+
+func (s *reposTestSuite) TestRepos_Facets() {
+	res, body := s.get("/repos?facets=language,fork&text=new", nil)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var out struct {
+		Repositories []model.Repository `json:"repositories"`
+		Facets       map[string]struct {
+			Buckets []struct {
+				Value string `json:"value"`
+				Count int    `json:"count"`
+			} `json:"buckets"`
+		} `json:"facets"`
+	}
+	s.Require().NoError(json.Unmarshal([]byte(body), &out))
+	s.Require().Len(out.Repositories, 1)
+	s.Require().Len(out.Facets, 2)
+	s.Equal("go", out.Facets["language"].Buckets[0].Value)
+	// the repository the text query drops isn't counted
+	s.Equal(1, out.Facets["language"].Buckets[0].Count)
+	s.Equal("false", out.Facets["fork"].Buckets[0].Value)
+}
+
+func (s *reposTestSuite) TestRepos_UnknownFacet() {
+	res, body := s.get("/repos?facets=stars", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	s.Contains(body, "unknown facet")
+
+	res, _ = s.get("/repos?facets=fork&facet_limit=0", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+}
+
+func (s *reposTestSuite) TestRepos_TextQueryFromIndex() {
+	index := fulltext.New()
+	search := handler.Search{
+		Forges:          s.forges,
+		DefaultProvider: "github",
+		WorkerCount:     2,
+		SourceTimeout:   time.Second,
+		Index:           fulltext.Indexed(store.NewMemory(), index),
+		Text:            index,
+	}
+	search.Index.Upsert(model.Repository{
+		Provider:    "github",
+		ID:          42,
+		FullName:    "someone/toml-parser",
+		Repository:  "toml-parser",
+		Description: "Parses configuration",
+		Languages:   map[string]model.Language{"rust": {Percent: 100}},
+	})
+	search.Index.Upsert(model.Repository{
+		Provider:  "gitlab",
+		ID:        7,
+		FullName:  "group/parsers",
+		Languages: map[string]model.Language{"rust": {Percent: 100}},
+	})
+	router := handlers.NewRouter(logger.Default())
+	router.HandleFunc("/repos", handler.Repos(search))
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	get := func(query string) []model.Repository {
+		res, err := http.Get(server.URL + "/repos?" + query)
+		s.Require().NoError(err)
+		defer res.Body.Close()
+		s.Require().Equal(http.StatusOK, res.StatusCode)
+		var repos []model.Repository
+		s.Require().NoError(json.NewDecoder(res.Body).Decode(&repos))
+		return repos
+	}
+
+	// the indexed repositories are found without searching the forges
+	repos := get("text=pars&language=rust")
+	s.Require().Len(repos, 1)
+	s.Equal("someone/toml-parser", repos[0].FullName)
+
+	s.Empty(get("text=pars&language=go"))
+	s.Len(get("text=pars&provider=github,gitlab"), 2)
+}
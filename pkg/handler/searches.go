@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/sirupsen/logrus"
+)
+
+// maxSavedSearchRequest is far above any legitimate saved search
+const maxSavedSearchRequest = 64 << 10
+
+// CreateSearch saves a search and answers with its secret, which is never shown again
+func CreateSearch(registry *savedsearch.Registry) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+
+		search, err := savedSearchRequest(r)
+		if err != nil {
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+		search.Owner = ""
+		if client, ok := apikey.FromContext(r.Context()); ok {
+			search.Owner = client.Name
+		}
+
+		search, err = registry.Create(search)
+		if err != nil {
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+		log.WithField("saved_search", search.ID).Info("Saved search created")
+		return writeJSON(w, log, http.StatusCreated, search)
+	}
+}
+
+// ListSearches returns the saved searches the key of the request can see, without their secrets
+func ListSearches(registry *savedsearch.Registry) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+
+		searches := []savedsearch.SavedSearch{}
+		for _, search := range registry.List() {
+			if visible(r, search) {
+				search.Secret = ""
+				searches = append(searches, search)
+			}
+		}
+		return writeJSON(w, log, http.StatusOK, searches)
+	}
+}
+
+func GetSearch(registry *savedsearch.Registry) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		log := logger.Get(r.Context())
+
+		search, err := visibleSearch(registry, r, params["id"])
+		if err != nil {
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+		search.Secret = ""
+		return writeJSON(w, log, http.StatusOK, search)
+	}
+}
+
+// UpdateSearch replaces the name, filters and target of a saved search, its secret is
+// only rotated when a new one is sent. The repositories already delivered aren't sent again
+func UpdateSearch(registry *savedsearch.Registry) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		log := logger.Get(r.Context())
+
+		search, err := savedSearchRequest(r)
+		if err != nil {
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+		if _, err := visibleSearch(registry, r, params["id"]); err != nil {
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+
+		search, err = registry.Update(params["id"], search)
+		if err != nil {
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+		search.Secret = ""
+		return writeJSON(w, log, http.StatusOK, search)
+	}
+}
+
+func DeleteSearch(registry *savedsearch.Registry, deliveries *savedsearch.Log) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		log := logger.Get(r.Context())
+
+		_, err := visibleSearch(registry, r, params["id"])
+		if err == nil {
+			err = registry.Delete(params["id"])
+		}
+		if err != nil {
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+		deliveries.Forget(params["id"])
+		log.WithField("saved_search", params["id"]).Info("Saved search deleted")
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// SearchDeliveries returns the latest deliveries of a saved search, newest first. The status
+// parameter narrows them down, for instance to the dead letters
+func SearchDeliveries(registry *savedsearch.Registry, deliveries *savedsearch.Log) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, params map[string]string) error {
+		log := logger.Get(r.Context())
+
+		if _, err := visibleSearch(registry, r, params["id"]); err != nil {
+			errorResponse(w, log, http.StatusInternalServerError, err)
+			return err
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != savedsearch.StatusDelivered && status != savedsearch.StatusDeadLetter {
+			err := fmt.Errorf("%w: status must be %s or %s", errInvalidParameter, savedsearch.StatusDelivered, savedsearch.StatusDeadLetter)
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+		return writeJSON(w, log, http.StatusOK, deliveries.List(params["id"], status))
+	}
+}
+
+// visible tells whether the key of the request may see the search: when keys are required,
+// a search belongs to the key which created it and admin keys see all of them
+func visible(r *http.Request, search savedsearch.SavedSearch) bool {
+	client, ok := apikey.FromContext(r.Context())
+	return !ok || client.Admin || client.Name == search.Owner
+}
+
+// visibleSearch reports the searches of the other keys as not found, so that their IDs don't leak
+func visibleSearch(registry *savedsearch.Registry, r *http.Request, ID string) (savedsearch.SavedSearch, error) {
+	search, err := registry.Get(ID)
+	if err != nil {
+		return search, err
+	}
+	if !visible(r, search) {
+		return savedsearch.SavedSearch{}, savedsearch.ErrNotFound
+	}
+	return search, nil
+}
+
+func savedSearchRequest(r *http.Request) (search savedsearch.SavedSearch, err error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSavedSearchRequest))
+	if err != nil {
+		return search, fmt.Errorf("failed to read saved search: %w", err)
+	}
+	if err := json.Unmarshal(body, &search); err != nil {
+		return search, fmt.Errorf("%w: %w", errInvalidPayload, err)
+	}
+	return search, nil
+}
+
+func writeJSON(w http.ResponseWriter, log logrus.FieldLogger, status int, body interface{}) error {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.WithError(err).Error("Failed to encode saved search JSON")
+		return err
+	}
+	return nil
+}
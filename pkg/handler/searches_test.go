@@ -0,0 +1,190 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/stretchr/testify/suite"
+)
+
+type searchesTestSuite struct {
+	suite.Suite
+	registry   *savedsearch.Registry
+	deliveries *savedsearch.Log
+	server     *httptest.Server
+	// key is sent with the requests when set
+	key string
+}
+
+func TestSearches(t *testing.T) {
+	suite.Run(t, new(searchesTestSuite))
+}
+
+func (s *searchesTestSuite) SetupTest() {
+	s.registry = savedsearch.NewRegistry()
+	s.deliveries = savedsearch.NewLog()
+	s.key = ""
+	s.server = nil
+	s.serve()
+}
+
+// serve starts the server with the middlewares, replacing the one already running
+func (s *searchesTestSuite) serve(middlewares ...handlers.MiddlewareFunc) {
+	if s.server != nil {
+		s.server.Close()
+	}
+	router := handlers.NewRouter(logger.Default())
+	for _, middleware := range middlewares {
+		router.Use(middleware)
+	}
+	router.HandleFunc("/searches", handler.ListSearches(s.registry)).Methods(http.MethodGet)
+	router.HandleFunc("/searches", handler.CreateSearch(s.registry)).Methods(http.MethodPost)
+	router.HandleFunc("/searches/{id}", handler.GetSearch(s.registry)).Methods(http.MethodGet)
+	router.HandleFunc("/searches/{id}", handler.UpdateSearch(s.registry)).Methods(http.MethodPut)
+	router.HandleFunc("/searches/{id}", handler.DeleteSearch(s.registry, s.deliveries)).Methods(http.MethodDelete)
+	router.HandleFunc("/searches/{id}/deliveries", handler.SearchDeliveries(s.registry, s.deliveries)).Methods(http.MethodGet)
+	s.server = httptest.NewServer(router)
+}
+
+func (s *searchesTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *searchesTestSuite) do(method, path, body string, out interface{}) *http.Response {
+	req, err := http.NewRequest(method, s.server.URL+path, bytes.NewBufferString(body))
+	s.Require().NoError(err)
+	if s.key != "" {
+		req.Header.Set("X-API-Key", s.key)
+	}
+	res, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	s.Require().NoError(err)
+	if out != nil {
+		s.Require().NoError(json.Unmarshal(b, out), string(b))
+	}
+	return res
+}
+
+func (s *searchesTestSuite) TestCreate_ShowsTheSecretOnce() {
+	var created savedsearch.SavedSearch
+	res := s.do(http.MethodPost, "/searches", `{"name":"rust parsers","filters":{"language":"rust","text":"parser"},"target_url":"https://example.com/hook"}`, &created)
+	s.Equal(http.StatusCreated, res.StatusCode)
+	s.NotEmpty(created.ID)
+	s.NotEmpty(created.Secret)
+	s.Equal("rust", created.Filters.Language)
+
+	var got savedsearch.SavedSearch
+	res = s.do(http.MethodGet, "/searches/"+created.ID, "", &got)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal(created.Name, got.Name)
+	s.Empty(got.Secret)
+
+	var list []savedsearch.SavedSearch
+	res = s.do(http.MethodGet, "/searches", "", &list)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(list, 1)
+	s.Empty(list[0].Secret)
+}
+
+func (s *searchesTestSuite) TestCreate_RejectsInvalidSearches() {
+	res := s.do(http.MethodPost, "/searches", `{"name":"no target"}`, nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	res = s.do(http.MethodPost, "/searches", `{"name":`, nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	s.Empty(s.registry.List())
+}
+
+func (s *searchesTestSuite) TestUpdateAndDelete() {
+	search, err := s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: "https://example.com/hook"})
+	s.Require().NoError(err)
+	s.deliveries.Record(savedsearch.Delivery{ID: "1", SearchID: search.ID, Status: savedsearch.StatusDeadLetter})
+
+	var updated savedsearch.SavedSearch
+	res := s.do(http.MethodPut, "/searches/"+search.ID, `{"name":"renamed","target_url":"https://example.com/other"}`, &updated)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("renamed", updated.Name)
+	s.Empty(updated.Secret)
+	stored, err := s.registry.Get(search.ID)
+	s.Require().NoError(err)
+	s.Equal(search.Secret, stored.Secret)
+
+	res = s.do(http.MethodDelete, "/searches/"+search.ID, "", nil)
+	s.Equal(http.StatusNoContent, res.StatusCode)
+	s.Empty(s.deliveries.List(search.ID, ""))
+
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		res = s.do(method, "/searches/"+search.ID, "", nil)
+		s.Equal(http.StatusNotFound, res.StatusCode, method)
+	}
+	res = s.do(http.MethodPut, "/searches/"+search.ID, `{"name":"renamed","target_url":"https://example.com/other"}`, nil)
+	s.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *searchesTestSuite) TestDeliveries_FiltersByStatus() {
+	search, err := s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: "https://example.com/hook"})
+	s.Require().NoError(err)
+	s.deliveries.Record(savedsearch.Delivery{ID: "1", SearchID: search.ID, Status: savedsearch.StatusDelivered})
+	s.deliveries.Record(savedsearch.Delivery{ID: "2", SearchID: search.ID, Status: savedsearch.StatusDeadLetter, Payload: json.RawMessage(`{"delivery_id":"2"}`)})
+
+	var deliveries []savedsearch.Delivery
+	res := s.do(http.MethodGet, "/searches/"+search.ID+"/deliveries?status=dead_letter", "", &deliveries)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Require().Len(deliveries, 1)
+	s.Equal("2", deliveries[0].ID)
+	s.JSONEq(`{"delivery_id":"2"}`, string(deliveries[0].Payload))
+
+	res = s.do(http.MethodGet, "/searches/"+search.ID+"/deliveries", "", &deliveries)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Len(deliveries, 2)
+
+	res = s.do(http.MethodGet, "/searches/"+search.ID+"/deliveries?status=pending", "", nil)
+	s.Equal(http.StatusBadRequest, res.StatusCode)
+	res = s.do(http.MethodGet, "/searches/unknown/deliveries", "", nil)
+	s.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func (s *searchesTestSuite) TestOwnedByTheKeyWhichCreatedThem() {
+	keyring, err := apikey.NewKeyring([]apikey.Key{
+		{Name: "ci", Secret: "ci"},
+		{Name: "bot", Secret: "bot"},
+		{Name: "ops", Secret: "ops", Admin: true},
+	}, apikey.Limits{})
+	s.Require().NoError(err)
+	s.serve(handler.RequireAPIKey(keyring))
+
+	s.key = "ci"
+	var created savedsearch.SavedSearch
+	res := s.do(http.MethodPost, "/searches", `{"name":"mine","target_url":"https://example.com/hook","owner":"bot"}`, &created)
+	s.Require().Equal(http.StatusCreated, res.StatusCode)
+	s.Equal("ci", created.Owner)
+
+	// the other keys can't tell the search exists
+	s.key = "bot"
+	var list []savedsearch.SavedSearch
+	s.do(http.MethodGet, "/searches", "", &list)
+	s.Empty(list)
+	for _, req := range []struct{ method, path, body string }{
+		{http.MethodGet, "/searches/" + created.ID, ""},
+		{http.MethodPut, "/searches/" + created.ID, `{"name":"theirs","target_url":"https://example.com/hook"}`},
+		{http.MethodGet, "/searches/" + created.ID + "/deliveries", ""},
+		{http.MethodDelete, "/searches/" + created.ID, ""},
+	} {
+		s.Equal(http.StatusNotFound, s.do(req.method, req.path, req.body, nil).StatusCode, req.method+" "+req.path)
+	}
+
+	s.key = "ops"
+	s.do(http.MethodGet, "/searches", "", &list)
+	s.Len(list, 1)
+	s.Equal(http.StatusNoContent, s.do(http.MethodDelete, "/searches/"+created.ID, "", nil).StatusCode)
+}
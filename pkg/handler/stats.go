@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/stats"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+)
+
+const (
+	queryKeyInterval = "interval"
+	queryKeyFrom     = "from"
+	queryKeyTo       = "to"
+)
+
+// LanguageStats reports how many of the indexed repositories use each language, bucketed
+// by creation time, along with the languages gaining ground over the previous window
+func LanguageStats(index store.Store) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+
+		q, err := statsQuery(r, time.Now())
+		if err != nil {
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		err = json.NewEncoder(w).Encode(stats.Languages(index.List(), q))
+		if err != nil {
+			log.WithError(err).Error("Failed to encode language stats JSON")
+			return err
+		}
+		return nil
+	}
+}
+
+func statsQuery(r *http.Request, now time.Time) (q stats.Query, err error) {
+	query := r.URL.Query()
+	q.Interval = strings.ToLower(query.Get(queryKeyInterval))
+	if q.Interval == "" {
+		q.Interval = stats.IntervalDay
+	}
+
+	q.From, q.To = stats.DefaultRange(q.Interval, now)
+	if to := query.Get(queryKeyTo); to != "" {
+		if q.To, err = parseTime(to); err != nil {
+			return q, fmt.Errorf("%w: to %v", errInvalidParameter, err)
+		}
+		q.From, _ = stats.DefaultRange(q.Interval, q.To)
+	}
+	if from := query.Get(queryKeyFrom); from != "" {
+		if q.From, err = parseTime(from); err != nil {
+			return q, fmt.Errorf("%w: from %v", errInvalidParameter, err)
+		}
+	}
+
+	if provider := strings.ToLower(query.Get(queryKeyProvider)); provider != "" && provider != providerAll {
+		q.Providers = make(map[string]struct{})
+		for _, name := range strings.Split(provider, ",") {
+			q.Providers[strings.TrimSpace(name)] = struct{}{}
+		}
+	}
+	return q, q.Validate()
+}
+
+// parseTime accepts RFC 3339 timestamps as well as plain dates, which are taken as UTC midnight
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return t, fmt.Errorf("must be an RFC 3339 timestamp or a date, got %q", s)
+	}
+	return t, nil
+}
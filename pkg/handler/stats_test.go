@@ -0,0 +1,85 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/stats"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type statsTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+}
+
+func TestStats(t *testing.T) {
+	suite.Run(t, new(statsTestSuite))
+}
+
+func (s *statsTestSuite) SetupTest() {
+	index := store.NewMemory()
+	index.Upsert(model.Repository{
+		Provider:  "github",
+		ID:        1,
+		CreatedAt: time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC),
+		Languages: map[string]model.Language{"go": {Bytes: 100, Percent: 100}},
+	})
+
+	router := handlers.NewRouter(logger.Default())
+	router.HandleFunc("/stats/languages", handler.LanguageStats(index))
+	s.server = httptest.NewServer(router)
+}
+
+func (s *statsTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *statsTestSuite) get(path string) (*http.Response, []byte) {
+	res, err := http.Get(s.server.URL + path)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	s.Require().NoError(err)
+	return res, b
+}
+
+func (s *statsTestSuite) TestLanguageStats() {
+	res, body := s.get("/stats/languages?interval=hour&from=2024-05-02T12:00:00Z&to=2024-05-03")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var report stats.LanguageReport
+	s.Require().NoError(json.Unmarshal(body, &report))
+	s.Equal("hour", report.Interval)
+	s.Require().Len(report.Buckets, 12)
+	s.Equal(stats.Totals{Repositories: 1, Bytes: 100}, report.Buckets[5].Languages["go"])
+	s.Require().Len(report.Rising, 1)
+	s.Equal("go", report.Rising[0].Language)
+}
+
+func (s *statsTestSuite) TestLanguageStats_DefaultsToDays() {
+	res, body := s.get("/stats/languages?to=2024-05-03")
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	var report stats.LanguageReport
+	s.Require().NoError(json.Unmarshal(body, &report))
+	s.Equal("day", report.Interval)
+	s.Len(report.Buckets, 30)
+	s.Equal(1, report.Buckets[29].Repositories)
+}
+
+func (s *statsTestSuite) TestLanguageStats_InvalidParameters() {
+	for _, query := range []string{"interval=minute", "from=yesterday", "from=2024-05-03&to=2024-05-02", "interval=hour&from=2023-01-01&to=2024-01-01"} {
+		res, _ := s.get("/stats/languages?" + query)
+		s.Equal(http.StatusBadRequest, res.StatusCode, query)
+	}
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
+)
+
+// maxWebhookPayload is the size above which github stops delivering payloads
+const maxWebhookPayload = 25 << 20
+
+var errMissingDelivery = errors.New("missing X-GitHub-Delivery header")
+
+type webhookResponse struct {
+	Message string `json:"message"`
+	webhook.Result
+}
+
+// GithubWebhook ingests the repositories carried by the github app's webhook events into the index.
+// Payloads must be signed with the webhook secret and each delivery is only processed once
+func GithubWebhook(
+	secret []byte,
+	deliveries *webhook.Deliveries,
+	processor *webhook.Processor,
+) handlers.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, _ map[string]string) error {
+		log := logger.Get(r.Context())
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookPayload))
+		if err != nil {
+			err = fmt.Errorf("failed to read webhook payload: %w", err)
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+
+		err = webhook.Verify(secret, payload, r.Header.Get("X-Hub-Signature-256"))
+		if err != nil {
+			errorResponse(w, log, http.StatusUnauthorized, err)
+			return err
+		}
+
+		delivery := r.Header.Get("X-GitHub-Delivery")
+		if delivery == "" {
+			errorResponse(w, log, http.StatusBadRequest, errMissingDelivery)
+			return errMissingDelivery
+		}
+		event := r.Header.Get("X-GitHub-Event")
+		log = log.WithField("delivery", delivery).WithField("event", event)
+
+		if !deliveries.Claim(delivery) {
+			log.Info("Ignoring webhook delivery which was already processed")
+			return writeWebhookResponse(w, webhookResponse{Message: "duplicate delivery", Result: webhook.Result{Ignored: true}})
+		}
+
+		result, err := processor.Process(event, payload)
+		if err != nil {
+			deliveries.Release(delivery)
+			err = fmt.Errorf("%w: %w", errInvalidPayload, err)
+			errorResponse(w, log, http.StatusBadRequest, err)
+			return err
+		}
+		deliveries.Done(delivery)
+
+		message := "processed"
+		if event == webhook.EventPing {
+			message = "pong"
+		} else if result.Ignored {
+			message = "ignored"
+		}
+		return writeWebhookResponse(w, webhookResponse{Message: message, Result: result})
+	}
+}
+
+func writeWebhookResponse(w http.ResponseWriter, body webhookResponse) error {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	return json.NewEncoder(w).Encode(body)
+}
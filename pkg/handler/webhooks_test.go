@@ -0,0 +1,227 @@
+package handler_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
+	"github.com/stretchr/testify/suite"
+)
+
+const webhookSecret = "It's a Secret to Everybody"
+
+type webhooksTestSuite struct {
+	suite.Suite
+	index  store.Store
+	server *httptest.Server
+}
+
+func TestWebhooks(t *testing.T) {
+	suite.Run(t, new(webhooksTestSuite))
+}
+
+func (s *webhooksTestSuite) SetupTest() {
+	s.index = store.NewMemory()
+	processor := webhook.NewProcessor(s.index, "github", logger.Default())
+	router := handlers.NewRouter(logger.Default())
+	router.HandleFunc("/webhooks/github", handler.GithubWebhook([]byte(webhookSecret), webhook.NewDeliveries(time.Hour), processor))
+	s.server = httptest.NewServer(router)
+}
+
+func (s *webhooksTestSuite) TearDownTest() {
+	s.server.Close()
+}
+
+func (s *webhooksTestSuite) fixture(name string) []byte {
+	b, err := os.ReadFile(filepath.Join("testdata", "webhooks", name+".json"))
+	s.Require().NoError(err)
+	return b
+}
+
+// deliver sends the payload the way github does, signature is computed unless one is given
+func (s *webhooksTestSuite) deliver(event, delivery string, payload []byte, signature ...string) (*http.Response, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, s.server.URL+"/webhooks/github", bytes.NewReader(payload))
+	s.Require().NoError(err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", delivery)
+	if len(signature) > 0 {
+		req.Header.Set("X-Hub-Signature-256", signature[0])
+	} else {
+		req.Header.Set("X-Hub-Signature-256", webhook.Sign([]byte(webhookSecret), payload))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer res.Body.Close()
+	var body map[string]interface{}
+	s.Require().NoError(json.NewDecoder(res.Body).Decode(&body))
+	return res, body
+}
+
+func (s *webhooksTestSuite) TestSign_MatchesGithubExample() {
+	// example from https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
+	s.Equal(
+		"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17",
+		webhook.Sign([]byte(webhookSecret), []byte("Hello, World!")),
+	)
+}
+
+func (s *webhooksTestSuite) TestPing() {
+	res, body := s.deliver("ping", "delivery-ping", s.fixture("ping"))
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("pong", body["message"])
+}
+
+func (s *webhooksTestSuite) TestRejectsBadSignatures() {
+	payload := s.fixture("repository_created")
+
+	res, _ := s.deliver("repository", "delivery-1", payload, "")
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	res, _ = s.deliver("repository", "delivery-1", payload, webhook.Sign([]byte("wrong secret"), payload))
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	// the signature covers the exact bytes, so tampering with the payload invalidates it
+	tampered := bytes.Replace(payload, []byte(`"private": false`), []byte(`"private": true `), 1)
+	res, _ = s.deliver("repository", "delivery-1", tampered, webhook.Sign([]byte(webhookSecret), payload))
+	s.Equal(http.StatusUnauthorized, res.StatusCode)
+
+	s.Empty(s.index.List())
+}
+
+func (s *webhooksTestSuite) TestRepositoryCreated() {
+	res, body := s.deliver("repository", "delivery-1", s.fixture("repository_created"))
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal("processed", body["message"])
+	s.Equal(float64(1), body["upserted"])
+
+	record, ok := s.index.Get("github", 795134961)
+	s.Require().True(ok)
+	s.Equal("ownerName/repoName", record.FullName)
+	s.Equal("ownerName", record.Owner)
+	s.Equal("repoName", record.Repository.Repository)
+	s.Equal("MIT", record.License)
+	s.Equal(time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC), record.CreatedAt)
+}
+
+func (s *webhooksTestSuite) TestReplayedDeliveryIsIgnored() {
+	payload := s.fixture("repository_created")
+	res, _ := s.deliver("repository", "delivery-1", payload)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.index.Delete("github", 795134961)
+
+	res, body := s.deliver("repository", "delivery-1", payload)
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("duplicate delivery", body["message"])
+	_, ok := s.index.Get("github", 795134961)
+	s.False(ok)
+}
+
+func (s *webhooksTestSuite) TestFailedDeliveryCanBeRedelivered() {
+	res, _ := s.deliver("repository", "delivery-1", []byte(`{"action": "created", "repository": "not an object"}`))
+	s.Require().Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, body := s.deliver("repository", "delivery-1", s.fixture("repository_created"))
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("processed", body["message"])
+}
+
+func (s *webhooksTestSuite) TestRepositoryPrivatizedIsRemoved() {
+	s.deliver("repository", "delivery-1", s.fixture("repository_created"))
+	res, body := s.deliver("repository", "delivery-2", s.fixture("repository_privatized"))
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+	s.Equal(float64(1), body["deleted"])
+	s.Empty(s.index.List())
+}
+
+func (s *webhooksTestSuite) TestInstallationRepositories() {
+	s.deliver("repository", "delivery-1", s.fixture("repository_created"))
+	res, _ := s.deliver("installation_repositories", "delivery-2", s.fixture("installation_repositories"))
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	records := s.index.List()
+	s.Require().Len(records, 1)
+	s.Equal("ownerName/added-public", records[0].FullName)
+	s.Equal("ownerName", records[0].Owner)
+}
+
+func (s *webhooksTestSuite) TestRepositoryEditedClearsFields() {
+	s.deliver("repository", "delivery-1", s.fixture("repository_created"))
+	record, ok := s.index.Get("github", 795134961)
+	s.Require().True(ok)
+	s.Require().NotEmpty(record.License)
+
+	// fields present in the payload are authoritative, even when github cleared them
+	payload := []byte(`{"action": "edited", "repository": {"id": 795134961, "name": "repoName", "full_name": "ownerName/repoName",
+		"private": false, "description": null, "stargazers_count": 0, "license": null, "topics": []}}`)
+	res, _ := s.deliver("repository", "delivery-2", payload)
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	record, ok = s.index.Get("github", 795134961)
+	s.Require().True(ok)
+	s.Empty(record.Description)
+	s.Zero(record.Stars)
+	s.Empty(record.License)
+	s.Empty(record.Topics)
+	// the fields the payload doesn't carry are kept
+	s.Equal(time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC), record.CreatedAt)
+}
+
+func (s *webhooksTestSuite) TestInstallationRepositoriesKeepFields() {
+	s.index.Upsert(model.Repository{Provider: "github", ID: 795134970, FullName: "ownerName/added-public", Description: "kept", Stars: 4})
+	res, _ := s.deliver("installation_repositories", "delivery-1", s.fixture("installation_repositories"))
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	// the payload only names the repository, it knows nothing of its description or stars
+	record, ok := s.index.Get("github", 795134970)
+	s.Require().True(ok)
+	s.Equal("kept", record.Description)
+	s.Equal(4, record.Stars)
+}
+
+func (s *webhooksTestSuite) TestPushKeepsLanguageBreakdownFromSearches() {
+	s.index.Upsert(model.Repository{
+		Provider:  "github",
+		ID:        795134961,
+		FullName:  "ownerName/repoName",
+		Languages: map[string]model.Language{"go": {Bytes: 900, Percent: 90}, "shell": {Bytes: 100, Percent: 10}},
+	})
+
+	res, _ := s.deliver("push", "delivery-1", s.fixture("push"))
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	record, ok := s.index.Get("github", 795134961)
+	s.Require().True(ok)
+	s.Equal(3, record.Stars)
+	s.Equal([]string{"cli"}, record.Topics)
+	// push payloads carry unix timestamps
+	s.Equal(time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC), record.CreatedAt)
+	s.Len(record.Languages, 2)
+}
+
+func (s *webhooksTestSuite) TestPushIndexesPrimaryLanguage() {
+	res, _ := s.deliver("push", "delivery-1", s.fixture("push"))
+	s.Require().Equal(http.StatusOK, res.StatusCode)
+
+	record, ok := s.index.Get("github", 795134961)
+	s.Require().True(ok)
+	s.Contains(record.Languages, "go")
+}
+
+func (s *webhooksTestSuite) TestUnsupportedEventIsIgnored() {
+	res, body := s.deliver("star", "delivery-1", []byte(`{"action": "created"}`))
+	s.Equal(http.StatusOK, res.StatusCode)
+	s.Equal("ignored", body["message"])
+}
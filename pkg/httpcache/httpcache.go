@@ -0,0 +1,148 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ETag is a strong validator of the body, computed from its content
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NoneMatch reports whether the If-None-Match header lets the response through, that is
+// when none of the tags it lists matches. Tags are compared weakly as RFC 9110 requires
+func NoneMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return true
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return false
+		}
+	}
+	return true
+}
+
+// Key identifies a request by its path and parameters, whatever order they come in. The values of
+// the fold parameters are lists whose case and order don't matter, such as language=Go,rust
+func Key(path string, query url.Values, fold ...string) string {
+	folded := make(map[string]struct{}, len(fold))
+	for _, name := range fold {
+		folded[name] = struct{}{}
+	}
+
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	params := make(url.Values, len(query))
+	for _, name := range names {
+		var values []string
+		for _, value := range query[name] {
+			if _, ok := folded[name]; !ok {
+				values = append(values, value)
+				continue
+			}
+			for _, item := range strings.Split(strings.ToLower(value), ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					values = append(values, item)
+				}
+			}
+		}
+		sort.Strings(values)
+		params[name] = values
+	}
+	// Encode sorts by name
+	return path + "?" + params.Encode()
+}
+
+// Entry is a response kept in the cache
+type Entry struct {
+	Body        []byte
+	ContentType string
+	ETag        string
+	StoredAt    time.Time
+}
+
+// Cache keeps responses for a short time, the oldest ones are dropped when it is full
+type Cache struct {
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]Entry
+	// order lists the keys oldest first
+	order []string
+}
+
+func New(ttl time.Duration, size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{
+		ttl:     ttl,
+		size:    size,
+		now:     time.Now,
+		entries: make(map[string]Entry),
+	}
+}
+
+// Get returns the entry stored under the key unless it is older than the TTL
+func (c *Cache) Get(key string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || c.now().Sub(entry.StoredAt) >= c.ttl {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Set stores the entry, its StoredAt is set to now
+func (c *Cache) Set(key string, entry Entry) Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.StoredAt = c.now()
+	if _, ok := c.entries[key]; ok {
+		c.remove(key)
+	}
+	c.entries[key] = entry
+	c.order = append(c.order, key)
+
+	// expired entries are the oldest, they go before the live ones are evicted
+	for len(c.order) > 0 {
+		oldest := c.order[0]
+		if len(c.entries) <= c.size && c.now().Sub(c.entries[oldest].StoredAt) < c.ttl {
+			break
+		}
+		c.remove(oldest)
+	}
+	return entry
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func (c *Cache) remove(key string) {
+	delete(c.entries, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
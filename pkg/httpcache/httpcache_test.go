@@ -0,0 +1,90 @@
+package httpcache_test
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/httpcache"
+	"github.com/stretchr/testify/suite"
+)
+
+type httpcacheTestSuite struct {
+	suite.Suite
+}
+
+func TestHTTPCache(t *testing.T) {
+	suite.Run(t, new(httpcacheTestSuite))
+}
+
+func (s *httpcacheTestSuite) TestETag() {
+	etag := httpcache.ETag([]byte(`[{"full_name":"a/b"}]`))
+	s.Regexp(`^"[0-9a-f]{32}"$`, etag)
+	s.Equal(etag, httpcache.ETag([]byte(`[{"full_name":"a/b"}]`)))
+	s.NotEqual(etag, httpcache.ETag([]byte(`[]`)))
+}
+
+func (s *httpcacheTestSuite) TestNoneMatch() {
+	etag := `"abc"`
+	s.True(httpcache.NoneMatch("", etag))
+	s.True(httpcache.NoneMatch(`"other"`, etag))
+	s.False(httpcache.NoneMatch(`"abc"`, etag))
+	s.False(httpcache.NoneMatch(`W/"abc"`, etag))
+	s.False(httpcache.NoneMatch(`"other", "abc"`, etag))
+	s.False(httpcache.NoneMatch(`*`, etag))
+}
+
+func (s *httpcacheTestSuite) TestKey_IgnoresOrderAndFoldedCase() {
+	key := func(query string) string {
+		values, err := url.ParseQuery(query)
+		s.Require().NoError(err)
+		return httpcache.Key("/repos", values, "language")
+	}
+
+	s.Equal(key("language=go,rust&limit=10"), key("limit=10&language=Rust,Go"))
+	s.Equal(key("language=go&language=rust"), key("language=rust, go"))
+	// only the folded parameters ignore the case
+	s.NotEqual(key("name=Foo"), key("name=foo"))
+	s.NotEqual(key("language=go"), key("language=go&limit=10"))
+	s.NotEqual(key(""), httpcache.Key("/repos/feed.atom", nil))
+}
+
+func (s *httpcacheTestSuite) TestCache_ExpiresEntries() {
+	cache := httpcache.New(50*time.Millisecond, 10)
+	stored := cache.Set("a", httpcache.Entry{Body: []byte("a"), ETag: `"a"`})
+	s.False(stored.StoredAt.IsZero())
+
+	entry, ok := cache.Get("a")
+	s.Require().True(ok)
+	s.Equal([]byte("a"), entry.Body)
+	_, ok = cache.Get("b")
+	s.False(ok)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = cache.Get("a")
+	s.False(ok)
+	// expired entries go away with the next write
+	cache.Set("b", httpcache.Entry{})
+	s.Equal(1, cache.Len())
+}
+
+func (s *httpcacheTestSuite) TestCache_EvictsTheOldestEntries() {
+	cache := httpcache.New(time.Minute, 3)
+	for i := 0; i < 5; i++ {
+		cache.Set(fmt.Sprint(i), httpcache.Entry{})
+	}
+	s.Equal(3, cache.Len())
+	for i, kept := range []bool{false, false, true, true, true} {
+		_, ok := cache.Get(fmt.Sprint(i))
+		s.Equal(kept, ok, i)
+	}
+
+	// storing a key again makes it the newest
+	cache.Set("2", httpcache.Entry{})
+	cache.Set("5", httpcache.Entry{})
+	_, ok := cache.Get("2")
+	s.True(ok)
+	_, ok = cache.Get("3")
+	s.False(ok)
+}
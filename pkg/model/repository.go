@@ -1,12 +1,50 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
+// owner types of a repository, left empty when the forge doesn't tell
+const (
+	OwnerTypeUser         = "user"
+	OwnerTypeOrganization = "organization"
+)
+
+// NormalizeOwnerType maps the account kinds of the forges, such as github's "Organization"
+// or gitlab's "group", onto the owner types
+func NormalizeOwnerType(kind string) string {
+	switch strings.ToLower(kind) {
+	case "user":
+		return OwnerTypeUser
+	case "organization", "group":
+		return OwnerTypeOrganization
+	}
+	return ""
+}
+
+// Language is the use of a language in a repository. Forges which only report
+// shares, such as GitLab, leave Bytes at 0
 type Language struct {
-	Bytes int64 `json:"bytes"`
+	Bytes   int64   `json:"bytes"`
+	Percent float64 `json:"percent"`
 }
 
 type Repository struct {
-	FullName   string              `json:"full_name"`
-	Owner      string              `json:"owner"`
-	Repository string              `json:"repository"`
-	Languages  map[string]Language `json:"languages"`
+	Provider    string    `json:"provider"`
+	ID          int64     `json:"id"`
+	FullName    string    `json:"full_name"`
+	Owner       string    `json:"owner"`
+	OwnerType   string    `json:"owner_type,omitempty"`
+	Repository  string    `json:"repository"`
+	Description string    `json:"description,omitempty"`
+	HTMLURL     string    `json:"html_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// CreatedAtEstimated is set when the forge doesn't tell the creation time, which was guessed
+	CreatedAtEstimated bool                `json:"created_at_estimated,omitempty"`
+	Fork               bool                `json:"fork,omitempty"`
+	Stars              int                 `json:"stars,omitempty"`
+	License            string              `json:"license,omitempty"`
+	Topics             []string            `json:"topics,omitempty"`
+	Languages          map[string]Language `json:"languages"`
 }
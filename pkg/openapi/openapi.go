@@ -0,0 +1,223 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	InQuery  = "query"
+	InHeader = "header"
+
+	componentParameters = "#/components/parameters/"
+)
+
+// Spec is the OpenAPI 3 document describing the HTTP API, served as is at /openapi.json
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Document is the part of the OpenAPI document needed to validate requests
+type Document struct {
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components struct {
+		Parameters map[string]Parameter       `json:"parameters"`
+		Schemas    map[string]json.RawMessage `json:"schemas"`
+	} `json:"components"`
+}
+
+type Operation struct {
+	OperationID string      `json:"operationId"`
+	Parameters  []Parameter `json:"parameters"`
+}
+
+type Parameter struct {
+	Ref      string `json:"$ref,omitempty"`
+	Name     string `json:"name"`
+	In       string `json:"in"`
+	Required bool   `json:"required"`
+	Schema   Schema `json:"schema"`
+}
+
+type Schema struct {
+	Type    string   `json:"type"`
+	Enum    []string `json:"enum"`
+	Pattern string   `json:"pattern"`
+	Minimum *float64 `json:"minimum"`
+	Maximum *float64 `json:"maximum"`
+
+	pattern *regexp.Regexp
+}
+
+// ParameterError describes why a request parameter was rejected
+type ParameterError struct {
+	Name   string `json:"name"`
+	In     string `json:"in"`
+	Reason string `json:"reason"`
+}
+
+func (e ParameterError) Error() string {
+	return fmt.Sprintf("%s parameter %q %s", e.In, e.Name, e.Reason)
+}
+
+// Load parses the embedded document and resolves the parameters it references
+func Load() (*Document, error) {
+	return Parse(Spec)
+}
+
+// Parse reads an OpenAPI document, a parameter $ref can only point to the document's own components
+func Parse(spec []byte) (*Document, error) {
+	var doc Document
+	err := json.Unmarshal(spec, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse openapi document: %w", err)
+	}
+
+	for path, item := range doc.Paths {
+		for method, op := range item {
+			for i, param := range op.Parameters {
+				if param.Ref != "" {
+					resolved, ok := doc.Components.Parameters[strings.TrimPrefix(param.Ref, componentParameters)]
+					if !strings.HasPrefix(param.Ref, componentParameters) || !ok {
+						return nil, fmt.Errorf("unresolved parameter %s in %s %s", param.Ref, method, path)
+					}
+					param = resolved
+				}
+				if param.Schema.Pattern != "" {
+					param.Schema.pattern, err = regexp.Compile(param.Schema.Pattern)
+					if err != nil {
+						return nil, fmt.Errorf("invalid pattern of parameter %s in %s %s: %w", param.Name, method, path, err)
+					}
+				}
+				op.Parameters[i] = param
+			}
+		}
+	}
+	return &doc, nil
+}
+
+// Operation looks up the operation served at the path with the method. A path matches a
+// templated one such as /searches/{id} when every segment but the templated ones is the same
+func (d *Document) Operation(path, method string) (*Operation, bool) {
+	method = strings.ToLower(method)
+	if op, ok := d.Paths[path][method]; ok {
+		return op, true
+	}
+	for template, item := range d.Paths {
+		if !strings.Contains(template, "{") || !matchTemplate(template, path) {
+			continue
+		}
+		if op, ok := item[method]; ok {
+			return op, true
+		}
+	}
+	return nil, false
+}
+
+func matchTemplate(template, path string) bool {
+	templateSegments := strings.Split(template, "/")
+	pathSegments := strings.Split(path, "/")
+	if len(templateSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range templateSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks the query parameters of the request against the operation it targets. Query
+// parameters the operation doesn't declare are rejected so that typos don't silently match everything.
+// Requests to undocumented operations are left for the router to answer
+func (d *Document) Validate(r *http.Request) []ParameterError {
+	op, ok := d.Operation(r.URL.Path, r.Method)
+	if !ok {
+		return nil
+	}
+
+	var errs []ParameterError
+	query := r.URL.Query()
+	declared := make(map[string]struct{}, len(op.Parameters))
+	for _, param := range op.Parameters {
+		if param.In != InQuery {
+			continue
+		}
+		declared[param.Name] = struct{}{}
+
+		values, present := query[param.Name]
+		if !present {
+			if param.Required {
+				errs = append(errs, ParameterError{Name: param.Name, In: InQuery, Reason: "is required"})
+			}
+			continue
+		}
+		if len(values) > 1 {
+			errs = append(errs, ParameterError{Name: param.Name, In: InQuery, Reason: "must not be repeated"})
+			continue
+		}
+		if reason := param.Schema.check(values[0]); reason != "" {
+			errs = append(errs, ParameterError{Name: param.Name, In: InQuery, Reason: reason})
+		}
+	}
+
+	var unknown []string
+	for name := range query {
+		if _, ok := declared[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, ParameterError{Name: name, In: InQuery, Reason: "is not a known parameter"})
+	}
+	return errs
+}
+
+// check returns why the value doesn't match the schema, or an empty string when it does
+func (s Schema) check(value string) string {
+	switch s.Type {
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "must be a boolean"
+		}
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "must be an integer"
+		}
+		if s.Minimum != nil && float64(n) < *s.Minimum {
+			return fmt.Sprintf("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && float64(n) > *s.Maximum {
+			return fmt.Sprintf("must be at most %v", *s.Maximum)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		// the handlers lower case the values they compare, so the enum does too
+		for _, allowed := range s.Enum {
+			if strings.EqualFold(value, allowed) {
+				return ""
+			}
+		}
+		return "must be one of " + strings.Join(s.Enum, ", ")
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		return "must match " + s.Pattern
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/laouji/git-repo-searcher/pkg/facet"
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/github/auth"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/openapi"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/laouji/git-repo-searcher/pkg/stats"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
+	"github.com/stretchr/testify/suite"
+)
+
+type openapiTestSuite struct {
+	suite.Suite
+	doc *openapi.Document
+}
+
+func TestOpenAPI(t *testing.T) {
+	suite.Run(t, new(openapiTestSuite))
+}
+
+func (s *openapiTestSuite) SetupTest() {
+	var err error
+	s.doc, err = openapi.Load()
+	s.Require().NoError(err)
+}
+
+func (s *openapiTestSuite) validate(method, target string) []openapi.ParameterError {
+	return s.doc.Validate(httptest.NewRequest(method, target, nil))
+}
+
+func (s *openapiTestSuite) TestLoad_ResolvesParameterReferences() {
+	op, ok := s.doc.Operation("/repos/feed.atom", "GET")
+	s.Require().True(ok)
+	s.Require().Len(op.Parameters, 2)
+	s.Equal("provider", op.Parameters[0].Name)
+	s.Equal(openapi.InQuery, op.Parameters[0].In)
+}
+
+func (s *openapiTestSuite) TestParse_UnresolvedReference() {
+	_, err := openapi.Parse([]byte(`{"paths":{"/x":{"get":{"parameters":[{"$ref":"#/components/parameters/missing"}]}}}}`))
+	s.ErrorContains(err, "unresolved parameter")
+}
+
+func (s *openapiTestSuite) TestValidate_AcceptsDocumentedParameters() {
+	s.Empty(s.validate("GET", "/repos"))
+	s.Empty(s.validate("GET", "/repos?provider=all&language=go&format=CSV&layout=long&excel=true"))
+	s.Empty(s.validate("POST", "/webhooks/github"))
+}
+
+func (s *openapiTestSuite) TestValidate_RejectsMalformedParameters() {
+	errs := s.validate("GET", "/repos?format=xlsx&excel=maybe&language=go&language=rust")
+	s.Equal([]openapi.ParameterError{
+		{Name: "language", In: "query", Reason: "must not be repeated"},
+		{Name: "format", In: "query", Reason: "must be one of json, csv, tsv"},
+		{Name: "excel", In: "query", Reason: "must be a boolean"},
+	}, errs)
+}
+
+func (s *openapiTestSuite) TestValidate_RejectsUnknownParameters() {
+	errs := s.validate("GET", "/repos/feed.rss?lang=go&format=csv")
+	s.Equal([]openapi.ParameterError{
+		{Name: "format", In: "query", Reason: "is not a known parameter"},
+		{Name: "lang", In: "query", Reason: "is not a known parameter"},
+	}, errs)
+	s.Len(s.validate("GET", "/ping?verbose=1"), 1)
+}
+
+func (s *openapiTestSuite) TestOperation_MatchesTemplatedPaths() {
+	op, ok := s.doc.Operation("/searches/0123abcd/deliveries", "GET")
+	s.Require().True(ok)
+	s.Equal("searchDeliveries", op.OperationID)
+
+	_, ok = s.doc.Operation("/searches//deliveries", "GET")
+	s.False(ok)
+	_, ok = s.doc.Operation("/searches/0123abcd/other", "GET")
+	s.False(ok)
+
+	s.Equal([]openapi.ParameterError{
+		{Name: "status", In: openapi.InQuery, Reason: "must be one of delivered, dead_letter"},
+	}, s.validate("GET", "/searches/0123abcd/deliveries?status=pending"))
+}
+
+func (s *openapiTestSuite) TestValidate_IgnoresUndocumentedOperations() {
+	s.Empty(s.validate("GET", "/nowhere?x=1"))
+	s.Empty(s.validate("DELETE", "/repos?x=1"))
+}
+
+// the schemas must list exactly the fields the handlers encode
+func (s *openapiTestSuite) TestSchemas_MatchModels() {
+	for name, v := range map[string]interface{}{
+		"Repository":  model.Repository{},
+		"Language":    model.Language{},
+		"Source":      federation.Source{},
+		"TokenStatus": auth.TokenStatus{},
+		"KeyStatus":   auth.KeyStatus{},
+		"Facet":       facet.Result{},
+		"FacetBucket": facet.Bucket{},
+
+		"LanguageReport": stats.LanguageReport{},
+		"LanguageBucket": stats.Bucket{},
+		"LanguageTotals": stats.Totals{},
+		"LanguageTrend":  stats.Trend{},
+
+		"SavedSearch":        savedsearch.SavedSearch{},
+		"SavedSearchFilters": savedsearch.Filters{},
+		"Delivery":           savedsearch.Delivery{},
+		"DeliveryAttempt":    savedsearch.Attempt{},
+	} {
+		s.Equal(jsonFields(reflect.TypeOf(v)), s.properties(name), name)
+	}
+
+	// the webhook response adds a message to the processing result
+	s.ElementsMatch(append([]string{"message"}, jsonFields(reflect.TypeOf(webhook.Result{}))...), s.properties("WebhookResponse"))
+}
+
+func (s *openapiTestSuite) properties(schema string) []string {
+	raw, ok := s.doc.Components.Schemas[schema]
+	s.Require().True(ok, schema)
+	var out struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	s.Require().NoError(json.Unmarshal(raw, &out))
+
+	names := make([]string, 0, len(out.Properties))
+	for name := range out.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "-" || !t.Field(i).IsExported() {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,163 @@
+package ranking
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	KeyCreated      = "created"
+	KeyID           = "id"
+	KeyBytes        = "bytes"
+	KeyLanguages    = "languages"
+	KeyPrimaryShare = "primary_share"
+	KeyStars        = "stars"
+	KeyRelevance    = "relevance"
+
+	DirectionAsc  = "asc"
+	DirectionDesc = "desc"
+)
+
+var (
+	ErrUnknownKey       = errors.New("unknown sort")
+	ErrUnknownDirection = errors.New("unknown sort order")
+	ErrMissingText      = errors.New("sorting by relevance requires a text query")
+
+	keys = []string{KeyCreated, KeyID, KeyBytes, KeyLanguages, KeyPrimaryShare, KeyStars, KeyRelevance}
+)
+
+// Order describes how search results are ranked. Every key sorts in descending order
+// unless Ascending is set, ties are always broken newest first so the order is stable
+type Order struct {
+	Key       string
+	Ascending bool
+	// Text, when set, drops the repositories the scorer gives no relevance to
+	Text   string
+	Scorer Scorer
+}
+
+// NewOrder validates the sort key and direction, an empty key sorts by relevance when
+// there is a text query and by creation time otherwise
+func NewOrder(key, direction, text string, scorer Scorer) (Order, error) {
+	o := Order{Key: strings.ToLower(key), Text: strings.TrimSpace(text), Scorer: scorer}
+	if o.Scorer == nil {
+		o.Scorer = DefaultScorer
+	}
+	if o.Key == "" {
+		o.Key = KeyCreated
+		if o.Text != "" {
+			o.Key = KeyRelevance
+		}
+	}
+	if !known(o.Key) {
+		return o, fmt.Errorf("%w %q, expected one of %s", ErrUnknownKey, key, strings.Join(keys, ", "))
+	}
+	if o.Key == KeyRelevance && o.Text == "" {
+		return o, ErrMissingText
+	}
+
+	switch strings.ToLower(direction) {
+	case "", DirectionDesc:
+	case DirectionAsc:
+		o.Ascending = true
+	default:
+		return o, fmt.Errorf("%w %q, expected %s or %s", ErrUnknownDirection, direction, DirectionAsc, DirectionDesc)
+	}
+	return o, nil
+}
+
+// Apply filters the repositories on the text query if there is one and returns them sorted,
+// the given slice is left untouched
+func (o Order) Apply(repos []model.Repository) []model.Repository {
+	ranked := make([]ranked, 0, len(repos))
+	for _, repo := range repos {
+		var score float64
+		if o.Text != "" {
+			score = o.Scorer.Score(o.Text, repo)
+			if score <= 0 {
+				continue
+			}
+		}
+		ranked = append(ranked, newRanked(o.Key, repo, score))
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if o.Key == KeyCreated {
+			if !a.repo.CreatedAt.Equal(b.repo.CreatedAt) {
+				return a.repo.CreatedAt.After(b.repo.CreatedAt) != o.Ascending
+			}
+		} else if a.value != b.value {
+			return (a.value < b.value) == o.Ascending
+		}
+		return NewestFirst(a.repo, b.repo)
+	})
+
+	out := make([]model.Repository, 0, len(ranked))
+	for _, r := range ranked {
+		out = append(out, r.repo)
+	}
+	return out
+}
+
+// Matches reports whether the repository is kept by Apply
+func (o Order) Matches(repo model.Repository) bool {
+	return o.Text == "" || o.Scorer.Score(o.Text, repo) > 0
+}
+
+// NewestFirst orders by creation time, ties are broken by provider then ID
+func NewestFirst(a, b model.Repository) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	if a.Provider != b.Provider {
+		return a.Provider < b.Provider
+	}
+	return a.ID > b.ID
+}
+
+// ranked holds the value sorted on, so that it is only computed once per repository
+type ranked struct {
+	repo  model.Repository
+	value float64
+}
+
+func newRanked(key string, repo model.Repository, score float64) ranked {
+	r := ranked{repo: repo}
+	// creation times are compared as they are, nanoseconds don't fit in a float64
+	switch key {
+	case KeyID:
+		r.value = float64(repo.ID)
+	case KeyBytes:
+		for _, language := range repo.Languages {
+			r.value += float64(language.Bytes)
+		}
+	case KeyLanguages:
+		r.value = float64(len(repo.Languages))
+	case KeyPrimaryShare:
+		for _, language := range repo.Languages {
+			if language.Percent > r.value {
+				r.value = language.Percent
+			}
+		}
+	case KeyStars:
+		// only the forges which enrich their listing report stars, the others rank as unstarred
+		r.value = float64(repo.Stars)
+	case KeyRelevance:
+		r.value = score
+	}
+	return r
+}
+
+func known(key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
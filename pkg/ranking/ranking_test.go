@@ -0,0 +1,125 @@
+package ranking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
+	"github.com/stretchr/testify/suite"
+)
+
+type rankingTestSuite struct {
+	suite.Suite
+	created time.Time
+	repos   []model.Repository
+}
+
+func TestRanking(t *testing.T) {
+	suite.Run(t, new(rankingTestSuite))
+}
+
+func (s *rankingTestSuite) SetupTest() {
+	s.created = time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC)
+	s.repos = []model.Repository{
+		{
+			Provider:    "github",
+			ID:          10,
+			Repository:  "parser",
+			FullName:    "alice/parser",
+			Description: "A toml parser",
+			CreatedAt:   s.created,
+			Stars:       3,
+			Languages: map[string]model.Language{
+				"go":    {Bytes: 900, Percent: 90},
+				"shell": {Bytes: 100, Percent: 10},
+			},
+		},
+		{
+			Provider:    "gitlab",
+			ID:          7,
+			Repository:  "toml",
+			FullName:    "bob/toml",
+			Description: "Reads configuration files",
+			CreatedAt:   s.created,
+			Languages:   map[string]model.Language{"rust": {Bytes: 5000, Percent: 100}},
+		},
+		{
+			Provider:    "github",
+			ID:          12,
+			Repository:  "tomlkit",
+			FullName:    "carol/tomlkit",
+			Description: "Style preserving toml library",
+			CreatedAt:   s.created.Add(-time.Hour),
+			Stars:       3,
+			Languages: map[string]model.Language{
+				"python": {Bytes: 600, Percent: 60},
+				"c":      {Bytes: 300, Percent: 30},
+				"shell":  {Bytes: 100, Percent: 10},
+			},
+		},
+	}
+}
+
+func (s *rankingTestSuite) sorted(key, direction, text string) []string {
+	order, err := ranking.NewOrder(key, direction, text, nil)
+	s.Require().NoError(err)
+	var names []string
+	for _, repo := range order.Apply(s.repos) {
+		names = append(names, repo.FullName)
+	}
+	return names
+}
+
+func (s *rankingTestSuite) TestApply_Keys() {
+	// bob/toml and alice/parser were created at the same time, the provider breaks the tie
+	s.Equal([]string{"alice/parser", "bob/toml", "carol/tomlkit"}, s.sorted("", "", ""))
+	s.Equal([]string{"carol/tomlkit", "alice/parser", "bob/toml"}, s.sorted("created", "asc", ""))
+	s.Equal([]string{"carol/tomlkit", "alice/parser", "bob/toml"}, s.sorted("id", "", ""))
+	s.Equal([]string{"bob/toml", "alice/parser", "carol/tomlkit"}, s.sorted("bytes", "desc", ""))
+	s.Equal([]string{"carol/tomlkit", "alice/parser", "bob/toml"}, s.sorted("languages", "", ""))
+	s.Equal([]string{"bob/toml", "alice/parser", "carol/tomlkit"}, s.sorted("primary_share", "", ""))
+}
+
+func (s *rankingTestSuite) TestApply_TiesBrokenNewestFirst() {
+	// alice/parser and carol/tomlkit have as many stars, whichever direction the newest comes first
+	s.Equal([]string{"alice/parser", "carol/tomlkit", "bob/toml"}, s.sorted("stars", "", ""))
+	s.Equal([]string{"bob/toml", "alice/parser", "carol/tomlkit"}, s.sorted("STARS", "ASC", ""))
+}
+
+func (s *rankingTestSuite) TestApply_Relevance() {
+	// the repository named after the query comes first, then the name containing it, then the description
+	s.Equal([]string{"bob/toml", "carol/tomlkit", "alice/parser"}, s.sorted("", "", "toml"))
+	s.Equal([]string{"alice/parser"}, s.sorted("", "", "Toml parser"))
+	s.Empty(s.sorted("", "", "yaml"))
+
+	// text queries can be sorted on any other key
+	s.Equal([]string{"carol/tomlkit", "alice/parser", "bob/toml"}, s.sorted("created", "asc", "toml"))
+}
+
+func (s *rankingTestSuite) TestApply_CustomScorer() {
+	starred := ranking.ScorerFunc(func(text string, repo model.Repository) float64 {
+		return float64(repo.Stars)
+	})
+	order, err := ranking.NewOrder("", "", "anything", starred)
+	s.Require().NoError(err)
+	repos := order.Apply(s.repos)
+	s.Require().Len(repos, 2)
+	s.Equal("alice/parser", repos[0].FullName)
+	s.Equal("carol/tomlkit", repos[1].FullName)
+}
+
+func (s *rankingTestSuite) TestNewOrder_Invalid() {
+	_, err := ranking.NewOrder("popularity", "", "", nil)
+	s.ErrorIs(err, ranking.ErrUnknownKey)
+
+	_, err = ranking.NewOrder("stars", "up", "", nil)
+	s.ErrorIs(err, ranking.ErrUnknownDirection)
+
+	_, err = ranking.NewOrder("relevance", "", " ", nil)
+	s.ErrorIs(err, ranking.ErrMissingText)
+}
+
+func (s *rankingTestSuite) TestTokenize() {
+	s.Equal([]string{"git", "repo", "searcher", "v2"}, ranking.Tokenize("Git-Repo_Searcher v2!"))
+}
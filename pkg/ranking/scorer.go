@@ -0,0 +1,84 @@
+package ranking
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+// Scorer rates how relevant a repository is to a text query, zero meaning it doesn't match
+type Scorer interface {
+	Score(text string, repo model.Repository) float64
+}
+
+// ScorerFunc lets a plain function be used as a Scorer
+type ScorerFunc func(text string, repo model.Repository) float64
+
+func (f ScorerFunc) Score(text string, repo model.Repository) float64 {
+	return f(text, repo)
+}
+
+// DefaultScorer is used when no other scorer is configured
+var DefaultScorer Scorer = FieldScorer{}
+
+const (
+	nameWeight        = 3
+	fullNameWeight    = 1
+	descriptionWeight = 1
+	// partialMatch discounts terms only found inside a longer word
+	partialMatch = 0.5
+	// exactNameBonus puts the repository named after the query first
+	exactNameBonus = 5
+)
+
+// FieldScorer matches every term of the query against the name, full name and description of
+// the repository. A match in the name weighs more than one in the description, a whole word
+// more than part of one, and a repository missing any of the terms doesn't match at all
+type FieldScorer struct{}
+
+func (FieldScorer) Score(text string, repo model.Repository) float64 {
+	terms := Tokenize(text)
+	if len(terms) == 0 {
+		return 0
+	}
+	name := Tokenize(repo.Repository)
+	fullName := Tokenize(repo.FullName)
+	description := Tokenize(repo.Description)
+
+	var score float64
+	for _, term := range terms {
+		termScore := nameWeight*match(term, name) +
+			fullNameWeight*match(term, fullName) +
+			descriptionWeight*match(term, description)
+		if termScore == 0 {
+			return 0
+		}
+		score += termScore
+	}
+	if strings.EqualFold(strings.Join(terms, " "), strings.Join(name, " ")) {
+		score += exactNameBonus
+	}
+	return score
+}
+
+// match returns 1 if the term is one of the words, partialMatch if it is part of one
+func match(term string, words []string) float64 {
+	var best float64
+	for _, word := range words {
+		if word == term {
+			return 1
+		}
+		if strings.Contains(word, term) {
+			best = partialMatch
+		}
+	}
+	return best
+}
+
+// Tokenize lowercases the text and splits it into words, anything but letters and digits separates them
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// MetadataAPIKey carries the key of the client like the X-API-Key header of the HTTP API,
+	// a bearer token in the authorization metadata works as well
+	MetadataAPIKey = "x-api-key"
+	// MetadataRetryAfter is how many seconds a client turned away over its limits should wait
+	MetadataRetryAfter = "retry-after"
+)
+
+// UnaryAPIKey checks the key of every call and limits it the same way the HTTP API does,
+// the github calls made during the call count against the quota of the key
+func UnaryAPIKey(keyring *apikey.Keyring) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authorize(ctx, keyring, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAPIKey is UnaryAPIKey for the streaming calls
+func StreamAPIKey(keyring *apikey.Keyring) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(stream.Context(), keyring, stream.SetHeader)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &clientStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authorize attaches the client of the key to the context so that the github calls are metered
+func authorize(ctx context.Context, keyring *apikey.Keyring, setHeader func(metadata.MD) error) (context.Context, error) {
+	client, err := keyring.Lookup(callAPIKey(ctx))
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	wait, err := client.Allow()
+	if err != nil {
+		// the header is a hint, the call is refused whether or not it could be set
+		setHeader(metadata.Pairs(MetadataRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		return ctx, status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return apikey.WithClient(ctx, client), nil
+}
+
+func callAPIKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get(MetadataAPIKey); len(keys) > 0 && keys[0] != "" {
+		return keys[0]
+	}
+	for _, authorization := range md.Get("authorization") {
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
+// clientStream hands the context carrying the client of the key to the handler
+type clientStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *clientStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,4 @@
+// Package searcherpb holds the protobuf messages and gRPC stubs of the search API
+package searcherpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative searcher.proto
@@ -0,0 +1,180 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: searcher.proto
+
+package searcherpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	RepositorySearcher_SearchRepositories_FullMethodName = "/searcher.v1.RepositorySearcher/SearchRepositories"
+	RepositorySearcher_StreamRepositories_FullMethodName = "/searcher.v1.RepositorySearcher/StreamRepositories"
+)
+
+// RepositorySearcherClient is the client API for RepositorySearcher service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type RepositorySearcherClient interface {
+	// SearchRepositories responds with the repositories newest first once every forge answered
+	SearchRepositories(ctx context.Context, in *SearchRepositoriesRequest, opts ...grpc.CallOption) (*SearchRepositoriesResponse, error)
+	// StreamRepositories sends each repository as soon as its languages are known, so they
+	// aren't ordered. The providers which failed are listed in the x-failed-sources trailer
+	StreamRepositories(ctx context.Context, in *SearchRepositoriesRequest, opts ...grpc.CallOption) (RepositorySearcher_StreamRepositoriesClient, error)
+}
+
+type repositorySearcherClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRepositorySearcherClient(cc grpc.ClientConnInterface) RepositorySearcherClient {
+	return &repositorySearcherClient{cc}
+}
+
+func (c *repositorySearcherClient) SearchRepositories(ctx context.Context, in *SearchRepositoriesRequest, opts ...grpc.CallOption) (*SearchRepositoriesResponse, error) {
+	out := new(SearchRepositoriesResponse)
+	err := c.cc.Invoke(ctx, RepositorySearcher_SearchRepositories_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *repositorySearcherClient) StreamRepositories(ctx context.Context, in *SearchRepositoriesRequest, opts ...grpc.CallOption) (RepositorySearcher_StreamRepositoriesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &RepositorySearcher_ServiceDesc.Streams[0], RepositorySearcher_StreamRepositories_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &repositorySearcherStreamRepositoriesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RepositorySearcher_StreamRepositoriesClient interface {
+	Recv() (*Repository, error)
+	grpc.ClientStream
+}
+
+type repositorySearcherStreamRepositoriesClient struct {
+	grpc.ClientStream
+}
+
+func (x *repositorySearcherStreamRepositoriesClient) Recv() (*Repository, error) {
+	m := new(Repository)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RepositorySearcherServer is the server API for RepositorySearcher service.
+// All implementations must embed UnimplementedRepositorySearcherServer
+// for forward compatibility
+type RepositorySearcherServer interface {
+	// SearchRepositories responds with the repositories newest first once every forge answered
+	SearchRepositories(context.Context, *SearchRepositoriesRequest) (*SearchRepositoriesResponse, error)
+	// StreamRepositories sends each repository as soon as its languages are known, so they
+	// aren't ordered. The providers which failed are listed in the x-failed-sources trailer
+	StreamRepositories(*SearchRepositoriesRequest, RepositorySearcher_StreamRepositoriesServer) error
+	mustEmbedUnimplementedRepositorySearcherServer()
+}
+
+// UnimplementedRepositorySearcherServer must be embedded to have forward compatible implementations.
+type UnimplementedRepositorySearcherServer struct {
+}
+
+func (UnimplementedRepositorySearcherServer) SearchRepositories(context.Context, *SearchRepositoriesRequest) (*SearchRepositoriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchRepositories not implemented")
+}
+func (UnimplementedRepositorySearcherServer) StreamRepositories(*SearchRepositoriesRequest, RepositorySearcher_StreamRepositoriesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamRepositories not implemented")
+}
+func (UnimplementedRepositorySearcherServer) mustEmbedUnimplementedRepositorySearcherServer() {}
+
+// UnsafeRepositorySearcherServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RepositorySearcherServer will
+// result in compilation errors.
+type UnsafeRepositorySearcherServer interface {
+	mustEmbedUnimplementedRepositorySearcherServer()
+}
+
+func RegisterRepositorySearcherServer(s grpc.ServiceRegistrar, srv RepositorySearcherServer) {
+	s.RegisterService(&RepositorySearcher_ServiceDesc, srv)
+}
+
+func _RepositorySearcher_SearchRepositories_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRepositoriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RepositorySearcherServer).SearchRepositories(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RepositorySearcher_SearchRepositories_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RepositorySearcherServer).SearchRepositories(ctx, req.(*SearchRepositoriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RepositorySearcher_StreamRepositories_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchRepositoriesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RepositorySearcherServer).StreamRepositories(m, &repositorySearcherStreamRepositoriesServer{stream})
+}
+
+type RepositorySearcher_StreamRepositoriesServer interface {
+	Send(*Repository) error
+	grpc.ServerStream
+}
+
+type repositorySearcherStreamRepositoriesServer struct {
+	grpc.ServerStream
+}
+
+func (x *repositorySearcherStreamRepositoriesServer) Send(m *Repository) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// RepositorySearcher_ServiceDesc is the grpc.ServiceDesc for RepositorySearcher service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RepositorySearcher_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "searcher.v1.RepositorySearcher",
+	HandlerType: (*RepositorySearcherServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SearchRepositories",
+			Handler:    _RepositorySearcher_SearchRepositories_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamRepositories",
+			Handler:       _RepositorySearcher_StreamRepositories_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "searcher.proto",
+}
@@ -0,0 +1,184 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/laouji/git-repo-searcher/pkg/federation"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/rpc/searcherpb"
+	"github.com/laouji/git-repo-searcher/pkg/subrequester"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TrailerFailedSources lists the providers which failed during a stream, like the X-Failed-Sources header of exports
+const TrailerFailedSources = "x-failed-sources"
+
+// Server serves the search API over gRPC with the same forges and semantics as /repos
+type Server struct {
+	searcherpb.UnimplementedRepositorySearcherServer
+
+	search handler.Search
+	logger logrus.FieldLogger
+}
+
+func NewServer(search handler.Search, logger logrus.FieldLogger) *Server {
+	return &Server{
+		search: search,
+		logger: logger,
+	}
+}
+
+// Register adds the search service to the gRPC server
+func (s *Server) Register(server *grpc.Server) {
+	searcherpb.RegisterRepositorySearcherServer(server, s)
+}
+
+func (s *Server) SearchRepositories(
+	ctx context.Context,
+	req *searcherpb.SearchRepositoriesRequest,
+) (*searcherpb.SearchRepositoriesResponse, error) {
+	log := s.logger.WithField("rpc", "SearchRepositories")
+
+	searcher, err := s.search.Searcher(strings.Join(req.GetProviders(), ","), log)
+	if err != nil {
+		return nil, statusError(log, err, codes.InvalidArgument)
+	}
+	repos, sources := searcher.Search(ctx, filters(req))
+	if err := failure(log, sources); err != nil {
+		return nil, err
+	}
+
+	out := &searcherpb.SearchRepositoriesResponse{
+		Repositories: make([]*searcherpb.Repository, 0, len(repos)),
+		Sources:      make([]*searcherpb.Source, 0, len(sources)),
+	}
+	for _, repo := range repos {
+		out.Repositories = append(out.Repositories, repository(repo))
+	}
+	for _, source := range sources {
+		out.Sources = append(out.Sources, &searcherpb.Source{
+			Provider:   source.Provider,
+			Count:      int64(source.Count),
+			DurationMs: source.Duration,
+			Error:      source.Error,
+		})
+	}
+	return out, nil
+}
+
+func (s *Server) StreamRepositories(
+	req *searcherpb.SearchRepositoriesRequest,
+	stream searcherpb.RepositorySearcher_StreamRepositoriesServer,
+) error {
+	log := s.logger.WithField("rpc", "StreamRepositories")
+
+	searcher, err := s.search.Searcher(strings.Join(req.GetProviders(), ","), log)
+	if err != nil {
+		return statusError(log, err, codes.InvalidArgument)
+	}
+
+	// once the client is gone there is no point sending the rest, the search
+	// itself stops soon after since the stream's context is cancelled
+	var sendErr error
+	sources := searcher.Stream(stream.Context(), filters(req), func(repo model.Repository) {
+		if sendErr == nil {
+			sendErr = stream.Send(repository(repo))
+		}
+	})
+	if sendErr != nil {
+		log.WithError(sendErr).Info("Stream closed before the search ended")
+		return sendErr
+	}
+
+	var failed []string
+	for _, source := range sources {
+		if source.Err != nil {
+			failed = append(failed, source.Provider)
+		}
+	}
+	if len(failed) > 0 {
+		stream.SetTrailer(metadata.Pairs(TrailerFailedSources, strings.Join(failed, ",")))
+	}
+	return failure(log, sources)
+}
+
+// failure fails the call the same way /repos does: a single forge fails like it always did,
+// several only fail if none of them answered
+func failure(log logrus.FieldLogger, sources []federation.Source) error {
+	if len(sources) == 1 {
+		if err := sources[0].Err; err != nil {
+			return statusError(log, err, codes.Internal)
+		}
+		return nil
+	}
+	if err := federation.AllFailed(sources); err != nil {
+		return statusError(log, err, codes.Unavailable)
+	}
+	return nil
+}
+
+// statusError maps the errors of the forges onto gRPC codes, the errors
+// the caller can't act upon are reported with the fallback code only
+func statusError(log logrus.FieldLogger, err error, fallback codes.Code) error {
+	log.WithError(err).Error("Request failed")
+
+	switch {
+	case errors.Is(err, federation.ErrUnknownProvider):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, forge.ErrAuthentication):
+		return status.Error(codes.Unauthenticated, forge.ErrAuthentication.Error())
+	case errors.Is(err, forge.ErrRateLimit):
+		return status.Error(codes.ResourceExhausted, forge.ErrRateLimit.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+	if fallback == codes.Internal {
+		return status.Error(codes.Internal, "internal error")
+	}
+	return status.Error(fallback, "all sources failed")
+}
+
+func filters(req *searcherpb.SearchRepositoriesRequest) map[string]string {
+	filters := make(map[string]string)
+	if language := req.GetLanguage(); language != "" {
+		filters[subrequester.FilterKeyLanguage] = language
+	}
+	return filters
+}
+
+func repository(repo model.Repository) *searcherpb.Repository {
+	out := &searcherpb.Repository{
+		Provider:           repo.Provider,
+		Id:                 repo.ID,
+		FullName:           repo.FullName,
+		Owner:              repo.Owner,
+		OwnerType:          repo.OwnerType,
+		Repository:         repo.Repository,
+		Description:        repo.Description,
+		HtmlUrl:            repo.HTMLURL,
+		CreatedAtEstimated: repo.CreatedAtEstimated,
+		Stars:              int64(repo.Stars),
+		Fork:               repo.Fork,
+		License:            repo.License,
+		Topics:             repo.Topics,
+		Languages:          make(map[string]*searcherpb.Language, len(repo.Languages)),
+	}
+	if !repo.CreatedAt.IsZero() {
+		out.CreatedAt = timestamppb.New(repo.CreatedAt)
+	}
+	for name, language := range repo.Languages {
+		out.Languages[name] = &searcherpb.Language{Bytes: language.Bytes, Percent: language.Percent}
+	}
+	return out
+}
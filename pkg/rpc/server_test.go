@@ -0,0 +1,224 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/apikey"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
+	"github.com/laouji/git-repo-searcher/pkg/forgetest"
+	"github.com/laouji/git-repo-searcher/pkg/handler"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/rpc"
+	"github.com/laouji/git-repo-searcher/pkg/rpc/searcherpb"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type serverTestSuite struct {
+	suite.Suite
+	created time.Time
+	search  handler.Search
+	server  *grpc.Server
+	conn    *grpc.ClientConn
+	client  searcherpb.RepositorySearcherClient
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, new(serverTestSuite))
+}
+
+func (s *serverTestSuite) SetupTest() {
+	s.created = time.Date(2024, 5, 2, 17, 41, 7, 0, time.UTC)
+	s.search = handler.Search{
+		Forges: map[string]forge.Forge{
+			"github": &forgetest.Stub{
+				Provider: "github",
+				Projects: []forge.Project{
+					{ID: 1, Name: "old", FullName: "owner/old", Owner: "owner", CreatedAt: s.created.Add(-time.Minute)},
+					{
+						ID: 2, Name: "new", FullName: "owner/new", Owner: "owner", OwnerType: model.OwnerTypeOrganization,
+						CreatedAt: s.created, CreatedAtEstimated: true, Fork: true,
+					},
+				},
+				Languages: map[string]model.Language{"Go": {Bytes: 100, Percent: 100}},
+			},
+			"gitlab": &forgetest.Stub{Provider: "gitlab", Err: forge.ErrRateLimit},
+			"gitea":  &forgetest.Stub{Provider: "gitea", Err: forge.ErrAuthentication},
+		},
+		DefaultProvider: "github",
+		WorkerCount:     2,
+		SourceTimeout:   time.Second,
+	}
+	s.serve()
+}
+
+// serve starts the server over an in-memory listener, replacing the one already running
+func (s *serverTestSuite) serve(opts ...grpc.ServerOption) {
+	if s.server != nil {
+		s.TearDownTest()
+	}
+	listener := bufconn.Listen(1 << 20)
+	s.server = grpc.NewServer(opts...)
+	rpc.NewServer(s.search, logger.Default()).Register(s.server)
+	go s.server.Serve(listener)
+
+	var err error
+	s.conn, err = grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	s.Require().NoError(err)
+	s.client = searcherpb.NewRepositorySearcherClient(s.conn)
+}
+
+func (s *serverTestSuite) TearDownTest() {
+	s.conn.Close()
+	s.server.Stop()
+	s.server = nil
+}
+
+func (s *serverTestSuite) TestSearchRepositories_NewestFirst() {
+	res, err := s.client.SearchRepositories(context.Background(), &searcherpb.SearchRepositoriesRequest{Language: "go"})
+	s.Require().NoError(err)
+	s.Require().Len(res.Repositories, 2)
+
+	repo := res.Repositories[0]
+	s.Equal("owner/new", repo.FullName)
+	s.Equal(int64(2), repo.Id)
+	s.Equal(s.created, repo.CreatedAt.AsTime())
+	s.True(repo.CreatedAtEstimated)
+	s.Equal(model.OwnerTypeOrganization, repo.OwnerType)
+	s.True(repo.Fork)
+	s.Equal(100.0, repo.Languages["go"].Percent)
+	s.False(res.Repositories[1].Fork)
+	s.Require().Len(res.Sources, 1)
+	s.Equal(int64(2), res.Sources[0].Count)
+}
+
+func (s *serverTestSuite) TestSearchRepositories_ReportsFailedSources() {
+	res, err := s.client.SearchRepositories(context.Background(), &searcherpb.SearchRepositoriesRequest{
+		Providers: []string{"github", "gitlab"},
+	})
+	s.Require().NoError(err)
+	s.Len(res.Repositories, 2)
+	s.Require().Len(res.Sources, 2)
+	s.Equal("gitlab", res.Sources[1].Provider)
+	s.NotEmpty(res.Sources[1].Error)
+}
+
+func (s *serverTestSuite) TestSearchRepositories_ErrorCodes() {
+	for providers, code := range map[string]codes.Code{
+		"bitbucket": codes.InvalidArgument,
+		"gitlab":    codes.ResourceExhausted,
+		"gitea":     codes.Unauthenticated,
+	} {
+		_, err := s.client.SearchRepositories(context.Background(), &searcherpb.SearchRepositoriesRequest{
+			Providers: []string{providers},
+		})
+		s.Equal(code, status.Code(err), providers)
+	}
+
+	// several sources only fail when none of them answered
+	_, err := s.client.SearchRepositories(context.Background(), &searcherpb.SearchRepositoriesRequest{
+		Providers: []string{"gitea", "gitlab"},
+	})
+	s.Equal(codes.Unauthenticated, status.Code(err))
+}
+
+func (s *serverTestSuite) TestStreamRepositories() {
+	stream, err := s.client.StreamRepositories(context.Background(), &searcherpb.SearchRepositoriesRequest{
+		Providers: []string{"all"},
+	})
+	s.Require().NoError(err)
+
+	var names []string
+	for {
+		repo, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		s.Require().NoError(err)
+		names = append(names, repo.FullName)
+	}
+	s.ElementsMatch([]string{"owner/new", "owner/old"}, names)
+	s.Equal(metadata.MD{rpc.TrailerFailedSources: {"gitea,gitlab"}}, stream.Trailer())
+}
+
+func (s *serverTestSuite) TestStreamRepositories_Failure() {
+	stream, err := s.client.StreamRepositories(context.Background(), &searcherpb.SearchRepositoriesRequest{
+		Providers: []string{"gitlab"},
+	})
+	s.Require().NoError(err)
+
+	_, err = stream.Recv()
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+	s.Equal([]string{"gitlab"}, stream.Trailer().Get(rpc.TrailerFailedSources))
+}
+
+// meteredForge records the API key client of the searches which reached it
+type meteredForge struct {
+	forgetest.Stub
+	clients chan *apikey.Client
+}
+
+func (f *meteredForge) NewestProjectID(ctx context.Context) (int64, error) {
+	client, _ := apikey.FromContext(ctx)
+	f.clients <- client
+	return f.Stub.NewestProjectID(ctx)
+}
+
+func (s *serverTestSuite) TestAPIKey() {
+	keyring, err := apikey.NewKeyring([]apikey.Key{{Name: "ci", Secret: "s3cr3t"}}, apikey.Limits{Rate: 0.01, Burst: 2, Window: time.Hour})
+	s.Require().NoError(err)
+	github := &meteredForge{Stub: *s.search.Forges["github"].(*forgetest.Stub), clients: make(chan *apikey.Client, 2)}
+	s.search.Forges["github"] = github
+	s.serve(
+		grpc.ChainUnaryInterceptor(rpc.UnaryAPIKey(keyring)),
+		grpc.ChainStreamInterceptor(rpc.StreamAPIKey(keyring)),
+	)
+	req := &searcherpb.SearchRepositoriesRequest{Language: "go"}
+
+	_, err = s.client.SearchRepositories(context.Background(), req)
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), rpc.MetadataAPIKey, "wrong")
+	_, err = s.client.SearchRepositories(ctx, req)
+	s.Equal(codes.Unauthenticated, status.Code(err))
+	s.Empty(github.clients)
+
+	ctx = metadata.AppendToOutgoingContext(context.Background(), rpc.MetadataAPIKey, "s3cr3t")
+	_, err = s.client.SearchRepositories(ctx, req)
+	s.Require().NoError(err)
+	client := <-github.clients
+	s.Require().NotNil(client)
+	s.Equal("ci", client.Name)
+
+	stream, err := s.client.StreamRepositories(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer s3cr3t"), req)
+	s.Require().NoError(err)
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		s.Require().NoError(err)
+	}
+	s.Equal(client, <-github.clients)
+
+	// both tokens of the bucket are spent
+	var header metadata.MD
+	_, err = s.client.SearchRepositories(ctx, req, grpc.Header(&header))
+	s.Equal(codes.ResourceExhausted, status.Code(err))
+	s.Equal([]string{"100"}, header.Get(rpc.MetadataRetryAfter))
+}
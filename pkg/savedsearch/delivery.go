@@ -0,0 +1,206 @@
+package savedsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
+)
+
+const (
+	HeaderSignature = "X-Searcher-Signature-256"
+	HeaderDelivery  = "X-Searcher-Delivery"
+	HeaderEvent     = "X-Searcher-Event"
+
+	EventMatched = "saved_search.matched"
+
+	StatusDelivered  = "delivered"
+	StatusDeadLetter = "dead_letter"
+
+	// logSize is how many deliveries are remembered per saved search
+	logSize = 100
+)
+
+// Payload is the body posted to the target of a saved search
+type Payload struct {
+	DeliveryID   string             `json:"delivery_id"`
+	SearchID     string             `json:"search_id"`
+	SearchName   string             `json:"search_name"`
+	Repositories []model.Repository `json:"repositories"`
+	SentAt       time.Time          `json:"sent_at"`
+}
+
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// Delivery records how posting new matches to a target went. The payload of a dead
+// letter is kept so that it can be inspected and replayed by hand
+type Delivery struct {
+	ID           string          `json:"id"`
+	SearchID     string          `json:"search_id"`
+	Status       string          `json:"status"`
+	Repositories int             `json:"repositories"`
+	Attempts     []Attempt       `json:"attempts"`
+	CreatedAt    time.Time       `json:"created_at"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+}
+
+// Deliverer posts signed payloads, retrying with an exponential backoff when the target
+// is unreachable, answers with a 5xx or asks to slow down with a 429
+type Deliverer struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	now         func() time.Time
+}
+
+func NewDeliverer(client *http.Client, maxAttempts int, backoff time.Duration) *Deliverer {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Deliverer{
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		now:         func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Deliver posts the repositories to the target of the search, formatted by its notifier. The body is signed
+// with the secret of the search the same way github signs its webhooks, in the X-Searcher-Signature-256 header
+func (d *Deliverer) Deliver(ctx context.Context, search SavedSearch, repos []model.Repository) Delivery {
+	delivery := Delivery{SearchID: search.ID, Repositories: len(repos), CreatedAt: d.now(), Status: StatusDeadLetter}
+	var err error
+	delivery.ID, err = randomHex(16)
+	if err != nil {
+		delivery.Attempts = append(delivery.Attempts, Attempt{At: d.now(), Error: err.Error()})
+		return delivery
+	}
+
+	notifier, err := notifierFor(search)
+	if err != nil {
+		delivery.Attempts = append(delivery.Attempts, Attempt{At: d.now(), Error: err.Error()})
+		return delivery
+	}
+	body, err := notifier.Format(Payload{
+		DeliveryID:   delivery.ID,
+		SearchID:     search.ID,
+		SearchName:   search.Name,
+		Repositories: repos,
+		SentAt:       delivery.CreatedAt,
+	})
+	if err != nil {
+		delivery.Attempts = append(delivery.Attempts, Attempt{At: d.now(), Error: fmt.Sprintf("failed to encode payload: %v", err)})
+		return delivery
+	}
+	signature := webhook.Sign([]byte(search.Secret), body)
+
+	wait := d.backoff
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		result, retry := d.post(ctx, search.TargetURL, delivery.ID, signature, body)
+		delivery.Attempts = append(delivery.Attempts, result)
+		if result.Error == "" {
+			delivery.Status = StatusDelivered
+			return delivery
+		}
+		if !retry || attempt == d.maxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			delivery.Attempts = append(delivery.Attempts, Attempt{At: d.now(), Error: ctx.Err().Error()})
+			delivery.Payload = body
+			return delivery
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+	delivery.Payload = body
+	return delivery
+}
+
+// post makes a single attempt and reports whether it is worth retrying
+func (d *Deliverer) post(ctx context.Context, target, ID, signature string, body []byte) (attempt Attempt, retry bool) {
+	attempt.At = d.now()
+	defer func() {
+		attempt.DurationMs = d.now().Sub(attempt.At).Milliseconds()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = fmt.Sprintf("failed to create request: %v", err)
+		return attempt, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "git-repo-searcher")
+	req.Header.Set(HeaderSignature, signature)
+	req.Header.Set(HeaderDelivery, ID)
+	req.Header.Set(HeaderEvent, EventMatched)
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = fmt.Sprintf("failed to post delivery: %v", err)
+		return attempt, true
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16))
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return attempt, false
+	}
+	attempt.Error = fmt.Sprintf("target answered %d", res.StatusCode)
+	return attempt, res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests
+}
+
+// Log keeps the latest deliveries of each saved search, newest first
+type Log struct {
+	mu         sync.RWMutex
+	deliveries map[string][]Delivery
+}
+
+func NewLog() *Log {
+	return &Log{deliveries: make(map[string][]Delivery)}
+}
+
+func (l *Log) Record(delivery Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	deliveries := append([]Delivery{delivery}, l.deliveries[delivery.SearchID]...)
+	if len(deliveries) > logSize {
+		deliveries = deliveries[:logSize]
+	}
+	l.deliveries[delivery.SearchID] = deliveries
+}
+
+// List returns the deliveries of the search, only the ones with the given status when it isn't empty
+func (l *Log) List(searchID, status string) []Delivery {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := []Delivery{}
+	for _, delivery := range l.deliveries[searchID] {
+		if status == "" || delivery.Status == status {
+			out = append(out, delivery)
+		}
+	}
+	return out
+}
+
+// Forget drops the deliveries of a deleted search
+func (l *Log) Forget(searchID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.deliveries, searchID)
+}
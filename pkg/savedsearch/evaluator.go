@@ -0,0 +1,178 @@
+package savedsearch
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+// batchSize caps how many repositories a single delivery carries
+const batchSize = 100
+
+type repoKey struct {
+	provider string
+	ID       int64
+}
+
+// progress is how far the evaluation of a saved search went
+type progress struct {
+	// cursor is the latest update of the index the search was evaluated against, only repositories
+	// updated since are looked at. It follows the clock of the index rather than the evaluator's
+	cursor    time.Time
+	delivered map[repoKey]struct{}
+	// pending are the matches waiting for the batch interval of the search to be over
+	pending []model.Repository
+	// next is when the pending matches can be delivered
+	next time.Time
+}
+
+// Evaluator periodically looks for the repositories ingested since each saved search
+// was created which match it, and delivers each of them to the search's target once
+type Evaluator struct {
+	registry  *Registry
+	index     store.Store
+	deliverer *Deliverer
+	log       *Log
+	logger    logrus.FieldLogger
+	now       func() time.Time
+
+	mu       sync.Mutex
+	progress map[string]*progress
+}
+
+func NewEvaluator(registry *Registry, index store.Store, deliverer *Deliverer, log *Log, logger logrus.FieldLogger) *Evaluator {
+	return &Evaluator{
+		registry:  registry,
+		index:     index,
+		deliverer: deliverer,
+		log:       log,
+		logger:    logger,
+		now:       func() time.Time { return time.Now().UTC() },
+		progress:  make(map[string]*progress),
+	}
+}
+
+// WithClock replaces the clock deciding when batch intervals are over
+func (e *Evaluator) WithClock(now func() time.Time) *Evaluator {
+	e.now = now
+	return e
+}
+
+// Run evaluates the saved searches every interval until the context is cancelled
+func (e *Evaluator) Run(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			case <-ticker.C:
+				e.Evaluate(ctx)
+			}
+		}
+	}()
+}
+
+// Evaluate delivers the new matches of every saved search, the searches are delivered
+// concurrently so that a target being retried doesn't hold the others back
+func (e *Evaluator) Evaluate(ctx context.Context) {
+	now := e.now()
+	records := e.index.List()
+	searches := e.registry.List()
+
+	wg := sync.WaitGroup{}
+	for _, m := range e.matches(searches, records, now) {
+		wg.Add(1)
+		go func(m match) {
+			defer wg.Done()
+			e.deliver(ctx, m.search, m.repos)
+		}(m)
+	}
+	wg.Wait()
+}
+
+type match struct {
+	search SavedSearch
+	repos  []model.Repository
+}
+
+// matches picks the repositories each search wasn't delivered yet, and marks them as delivered
+// whatever happens to the delivery since a dead letter keeps them. The matches of a search
+// delivered less than its batch interval ago are held back until the interval is over
+func (e *Evaluator) matches(searches []SavedSearch, records []store.Record, now time.Time) []match {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []match
+	active := make(map[string]struct{}, len(searches))
+	for _, search := range searches {
+		active[search.ID] = struct{}{}
+		p, ok := e.progress[search.ID]
+		if !ok {
+			p = &progress{cursor: search.CreatedAt, delivered: make(map[repoKey]struct{})}
+			e.progress[search.ID] = p
+		}
+
+		cursor := p.cursor
+		for _, record := range records {
+			// repositories updated at the very time of the cursor are looked at again, the ones
+			// already delivered are skipped below
+			if record.IndexedAt.Before(search.CreatedAt) || record.UpdatedAt.Before(p.cursor) {
+				continue
+			}
+			if record.UpdatedAt.After(cursor) {
+				cursor = record.UpdatedAt
+			}
+			key := repoKey{provider: record.Provider, ID: record.ID}
+			if _, ok := p.delivered[key]; ok || !search.Filters.Matches(record.Repository) {
+				continue
+			}
+			p.delivered[key] = struct{}{}
+			p.pending = append(p.pending, record.Repository)
+		}
+		p.cursor = cursor
+		if len(p.pending) == 0 || now.Before(p.next) {
+			continue
+		}
+
+		interval, _ := search.batchInterval()
+		out = append(out, match{search: search, repos: p.pending})
+		p.pending = nil
+		p.next = now.Add(interval)
+	}
+
+	for ID := range e.progress {
+		if _, ok := active[ID]; !ok {
+			delete(e.progress, ID)
+		}
+	}
+	return out
+}
+
+func (e *Evaluator) deliver(ctx context.Context, search SavedSearch, repos []model.Repository) {
+	log := e.logger.WithField("saved_search", search.ID)
+	sort.SliceStable(repos, func(i, j int) bool {
+		return ranking.NewestFirst(repos[i], repos[j])
+	})
+
+	for start := 0; start < len(repos); start += batchSize {
+		end := start + batchSize
+		if end > len(repos) {
+			end = len(repos)
+		}
+		delivery := e.deliverer.Deliver(ctx, search, repos[start:end])
+		e.log.Record(delivery)
+		if delivery.Status == StatusDeadLetter {
+			log.WithField("delivery", delivery.ID).Error("Saved search delivery failed, kept as a dead letter")
+			continue
+		}
+		log.WithField("delivery", delivery.ID).WithField("repositories", delivery.Repositories).Info("Saved search delivered")
+	}
+}
@@ -0,0 +1,150 @@
+package savedsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+const (
+	NotifierWebhook = "webhook"
+	NotifierSlack   = "slack"
+	NotifierMatrix  = "matrix"
+	NotifierChat    = "chat"
+
+	// messageSize is how many repositories a chat message lists, the others are only counted
+	messageSize = 10
+)
+
+// Notifier formats the new matches of a saved search into the body posted to its target
+type Notifier interface {
+	Format(payload Payload) ([]byte, error)
+}
+
+var notifiers = map[string]Notifier{
+	NotifierWebhook: webhookNotifier{},
+	NotifierSlack:   slackNotifier{},
+	NotifierMatrix:  matrixNotifier{},
+	NotifierChat:    chatNotifier{},
+}
+
+// notifierFor returns the notifier of the search, raw webhooks when it doesn't name one
+func notifierFor(search SavedSearch) (Notifier, error) {
+	kind := search.Notifier
+	if kind == "" {
+		kind = NotifierWebhook
+	}
+	notifier, ok := notifiers[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown notifier %q", ErrInvalid, kind)
+	}
+	return notifier, nil
+}
+
+// webhookNotifier posts the payload itself, for targets which process the repositories
+type webhookNotifier struct{}
+
+func (webhookNotifier) Format(payload Payload) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// slackNotifier posts to Slack incoming webhooks and the chat tools compatible with them,
+// such as Mattermost and Rocket.Chat, with the links in Slack's mrkdwn
+type slackNotifier struct{}
+
+func (slackNotifier) Format(payload Payload) ([]byte, error) {
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+	return json.Marshal(map[string]string{
+		"text": message(payload, escape, func(repo model.Repository) string {
+			if repo.HTMLURL == "" {
+				return escape(repo.FullName)
+			}
+			return fmt.Sprintf("<%s|%s>", repo.HTMLURL, escape(repo.FullName))
+		}),
+	})
+}
+
+// matrixNotifier posts to the generic webhooks of matrix-hookshot, which sends the html
+// to the room and falls back on the text for clients which don't render it
+type matrixNotifier struct{}
+
+func (matrixNotifier) Format(payload Payload) ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"text": message(payload, identity, plainLink),
+		"html": strings.ReplaceAll(message(payload, html.EscapeString, func(repo model.Repository) string {
+			if repo.HTMLURL == "" {
+				return html.EscapeString(repo.FullName)
+			}
+			return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(repo.HTMLURL), html.EscapeString(repo.FullName))
+		}), "\n", "<br>"),
+		"username": "git-repo-searcher",
+	})
+}
+
+// chatNotifier posts plain text in a text field, which is what Google Chat, Zulip and
+// most other incoming webhooks accept
+type chatNotifier struct{}
+
+func (chatNotifier) Format(payload Payload) ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"text": message(payload, identity, plainLink),
+	})
+}
+
+// message lists the first repositories of the payload one per line under a header naming the search
+func message(payload Payload, escape func(string) string, link func(model.Repository) string) string {
+	noun := "repositories"
+	if len(payload.Repositories) == 1 {
+		noun = "repository"
+	}
+	lines := []string{fmt.Sprintf("%d new %s matching %s", len(payload.Repositories), noun, escape(payload.SearchName))}
+
+	for i, repo := range payload.Repositories {
+		if i == messageSize {
+			lines = append(lines, fmt.Sprintf("and %d more", len(payload.Repositories)-messageSize))
+			break
+		}
+		line := "• " + link(repo)
+		if language := mainLanguage(repo); language != "" {
+			line += " [" + escape(language) + "]"
+		}
+		if repo.Description != "" {
+			line += " - " + escape(repo.Description)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func plainLink(repo model.Repository) string {
+	if repo.HTMLURL == "" {
+		return repo.FullName
+	}
+	return repo.FullName + " " + repo.HTMLURL
+}
+
+func identity(s string) string {
+	return s
+}
+
+// mainLanguage is the language with the most code, ties are broken by name
+func mainLanguage(repo model.Repository) string {
+	names := make([]string, 0, len(repo.Languages))
+	for name := range repo.Languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var main string
+	for _, name := range names {
+		language, current := repo.Languages[name], repo.Languages[main]
+		if main == "" || language.Percent > current.Percent || (language.Percent == current.Percent && language.Bytes > current.Bytes) {
+			main = name
+		}
+	}
+	return main
+}
@@ -0,0 +1,117 @@
+package savedsearch_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
+)
+
+var parser = model.Repository{
+	Provider:    "gitlab",
+	ID:          3,
+	FullName:    "alice/parser",
+	Repository:  "parser",
+	Description: "Reads <toml> & friends",
+	HTMLURL:     "https://gitlab.com/alice/parser",
+	Languages:   map[string]model.Language{"rust": {Percent: 80}, "c": {Percent: 20}},
+}
+
+// notify delivers the repositories through the notifier and decodes what the target received
+func (s *savedSearchTestSuite) notify(notifier string, repos ...model.Repository) map[string]string {
+	search, err := s.registry.Create(savedsearch.SavedSearch{Name: "rust & co", TargetURL: s.target.URL, Notifier: notifier})
+	s.Require().NoError(err)
+
+	delivery := savedsearch.NewDeliverer(http.DefaultClient, 1, time.Millisecond).Deliver(context.Background(), search, repos)
+	s.Require().Equal(savedsearch.StatusDelivered, delivery.Status)
+	s.Require().Len(s.received, 1)
+	got := s.received[0]
+	// chat messages are signed too, for the targets which can check it
+	s.NoError(webhook.Verify([]byte(search.Secret), got.body, got.header.Get(savedsearch.HeaderSignature)))
+
+	var body map[string]string
+	s.Require().NoError(json.Unmarshal(got.body, &body))
+	return body
+}
+
+func (s *savedSearchTestSuite) TestNotify_Slack() {
+	body := s.notify(savedsearch.NotifierSlack, parser)
+	s.Equal(map[string]string{
+		"text": "1 new repository matching rust &amp; co\n" +
+			"• <https://gitlab.com/alice/parser|alice/parser> [rust] - Reads &lt;toml&gt; &amp; friends",
+	}, body)
+}
+
+func (s *savedSearchTestSuite) TestNotify_Matrix() {
+	body := s.notify(savedsearch.NotifierMatrix, parser, model.Repository{FullName: "bob/toml"})
+	s.Equal("2 new repositories matching rust & co\n"+
+		"• alice/parser https://gitlab.com/alice/parser [rust] - Reads <toml> & friends\n"+
+		"• bob/toml", body["text"])
+	s.Equal("2 new repositories matching rust &amp; co<br>"+
+		`• <a href="https://gitlab.com/alice/parser">alice/parser</a> [rust] - Reads &lt;toml&gt; &amp; friends<br>`+
+		"• bob/toml", body["html"])
+	s.NotEmpty(body["username"])
+}
+
+func (s *savedSearchTestSuite) TestNotify_ChatListsTheFirstRepositories() {
+	repos := make([]model.Repository, 12)
+	for i := range repos {
+		repos[i] = model.Repository{FullName: fmt.Sprintf("alice/repo%d", i)}
+	}
+	body := s.notify(savedsearch.NotifierChat, repos...)
+	s.Len(body, 1)
+	s.Contains(body["text"], "12 new repositories matching rust & co\n• alice/repo0\n")
+	s.Contains(body["text"], "• alice/repo9\nand 2 more")
+	s.NotContains(body["text"], "alice/repo10")
+}
+
+func (s *savedSearchTestSuite) TestNotify_Validates() {
+	_, err := s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: s.target.URL, Notifier: "irc"})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+	_, err = s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: s.target.URL, BatchInterval: "soon"})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+	_, err = s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: s.target.URL, BatchInterval: "-1m"})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+}
+
+func (s *savedSearchTestSuite) TestEvaluate_BatchesPerInterval() {
+	index := store.NewMemory()
+	_, err := s.registry.Create(savedsearch.SavedSearch{
+		Name:          "watch",
+		TargetURL:     s.target.URL,
+		Notifier:      savedsearch.NotifierChat,
+		BatchInterval: "15m",
+	})
+	s.Require().NoError(err)
+	now := time.Now().UTC()
+	evaluator := savedsearch.NewEvaluator(s.registry, index, savedsearch.NewDeliverer(http.DefaultClient, 1, time.Millisecond), savedsearch.NewLog(), logger.Default()).
+		WithClock(func() time.Time { return now })
+
+	// the first matches go out straight away
+	index.Upsert(model.Repository{Provider: "github", ID: 1, FullName: "alice/one"})
+	evaluator.Evaluate(context.Background())
+	s.Require().Len(s.received, 1)
+
+	// the next ones wait for the interval to be over and are sent together
+	index.Upsert(model.Repository{Provider: "github", ID: 2, FullName: "alice/two"})
+	evaluator.Evaluate(context.Background())
+	index.Upsert(model.Repository{Provider: "github", ID: 3, FullName: "alice/three"})
+	evaluator.Evaluate(context.Background())
+	now = now.Add(14 * time.Minute)
+	evaluator.Evaluate(context.Background())
+	s.Len(s.received, 1)
+
+	now = now.Add(time.Minute)
+	evaluator.Evaluate(context.Background())
+	s.Require().Len(s.received, 2)
+	var body map[string]string
+	s.Require().NoError(json.Unmarshal(s.received[1].body, &body))
+	s.Equal("2 new repositories matching watch\n• alice/three\n• alice/two", body["text"])
+}
@@ -0,0 +1,229 @@
+package savedsearch
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
+	"github.com/laouji/git-repo-searcher/pkg/subrequester"
+)
+
+var (
+	ErrNotFound = errors.New("saved search not found")
+	ErrInvalid  = errors.New("invalid saved search")
+)
+
+// Filters select the repositories a saved search is notified about, with the same meaning as on /repos
+type Filters struct {
+	Providers []string `json:"providers,omitempty"`
+	Language  string   `json:"language,omitempty"`
+	Text      string   `json:"text,omitempty"`
+}
+
+// SavedSearch posts the newly ingested repositories matching its filters to its target
+type SavedSearch struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Filters   Filters `json:"filters"`
+	TargetURL string  `json:"target_url"`
+	// Notifier is how the matches are formatted for the target, raw webhooks by default
+	Notifier string `json:"notifier,omitempty"`
+	// BatchInterval is the least time between two deliveries, the matches found
+	// in between are sent together. Every evaluation is delivered when it is empty
+	BatchInterval string `json:"batch_interval,omitempty"`
+	// Secret signs the deliveries, it is only shown when the search is created
+	Secret string `json:"secret,omitempty"`
+	// Owner is the name of the API key which created the search, empty when keys aren't required
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Matches reports whether the repository passes every filter of the search
+func (f Filters) Matches(repo model.Repository) bool {
+	if len(f.Providers) > 0 {
+		found := false
+		for _, provider := range f.Providers {
+			if provider == "all" || strings.EqualFold(provider, repo.Provider) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Language != "" && !subrequester.Relevant(repo.Languages, map[string]string{subrequester.FilterKeyLanguage: f.Language}) {
+		return false
+	}
+	return f.Text == "" || ranking.DefaultScorer.Score(f.Text, repo) > 0
+}
+
+// Validate checks what the caller sent, the ID, secret and dates are set by the registry
+func (s SavedSearch) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	target, err := url.Parse(s.TargetURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: target_url must be an absolute http or https URL", ErrInvalid)
+	}
+	if _, err := notifierFor(s); err != nil {
+		return err
+	}
+	if _, err := s.batchInterval(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s SavedSearch) batchInterval() (time.Duration, error) {
+	if s.BatchInterval == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(s.BatchInterval)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("%w: batch_interval must be a positive duration such as 15m", ErrInvalid)
+	}
+	return interval, nil
+}
+
+// Registry holds the saved searches in memory
+type Registry struct {
+	mu            sync.RWMutex
+	searches      map[string]SavedSearch
+	now           func() time.Time
+	allowInternal bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		searches: make(map[string]SavedSearch),
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// AllowInternalTargets lets searches target loopback, link-local and private addresses,
+// which is only meant for trusted deployments and tests
+func (r *Registry) AllowInternalTargets() *Registry {
+	r.allowInternal = true
+	return r
+}
+
+// validate checks the search along with whether its target is one the registry accepts
+func (r *Registry) validate(s SavedSearch) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if r.allowInternal {
+		return nil
+	}
+	target, _ := url.Parse(s.TargetURL)
+	if err := checkTargetHost(target.Hostname()); err != nil {
+		return fmt.Errorf("%w: target_url must not point to an internal address", ErrInvalid)
+	}
+	return nil
+}
+
+// Create registers the search under a new ID, a secret is generated unless one is given
+func (r *Registry) Create(s SavedSearch) (SavedSearch, error) {
+	if err := r.validate(s); err != nil {
+		return s, err
+	}
+	var err error
+	s.ID, err = randomHex(8)
+	if err != nil {
+		return s, err
+	}
+	if s.Secret == "" {
+		s.Secret, err = randomHex(32)
+		if err != nil {
+			return s, err
+		}
+	}
+	s.CreatedAt = r.now()
+	s.UpdatedAt = s.CreatedAt
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.searches[s.ID] = s
+	return s, nil
+}
+
+func (r *Registry) Get(ID string) (SavedSearch, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.searches[ID]
+	if !ok {
+		return s, ErrNotFound
+	}
+	return s, nil
+}
+
+// List returns every saved search, oldest first
+func (r *Registry) List() []SavedSearch {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]SavedSearch, 0, len(r.searches))
+	for _, s := range r.searches {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Update replaces the name, filters, target and notifier of the search. Its secret is kept unless a new one is given
+func (r *Registry) Update(ID string, s SavedSearch) (SavedSearch, error) {
+	if err := r.validate(s); err != nil {
+		return s, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.searches[ID]
+	if !ok {
+		return s, ErrNotFound
+	}
+	existing.Name = s.Name
+	existing.Filters = s.Filters
+	existing.TargetURL = s.TargetURL
+	existing.Notifier = s.Notifier
+	existing.BatchInterval = s.BatchInterval
+	if s.Secret != "" {
+		existing.Secret = s.Secret
+	}
+	existing.UpdatedAt = r.now()
+	r.searches[ID] = existing
+	return existing, nil
+}
+
+func (r *Registry) Delete(ID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.searches[ID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.searches, ID)
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
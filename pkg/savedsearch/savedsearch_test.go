@@ -0,0 +1,283 @@
+package savedsearch_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Scalingo/go-utils/logger"
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/savedsearch"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/laouji/git-repo-searcher/pkg/webhook"
+	"github.com/stretchr/testify/suite"
+)
+
+type received struct {
+	header  http.Header
+	body    []byte
+	payload savedsearch.Payload
+}
+
+type savedSearchTestSuite struct {
+	suite.Suite
+	registry *savedsearch.Registry
+	target   *httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	received []received
+}
+
+func TestSavedSearch(t *testing.T) {
+	suite.Run(t, new(savedSearchTestSuite))
+}
+
+func (s *savedSearchTestSuite) SetupTest() {
+	// the target runs on the loopback
+	s.registry = savedsearch.NewRegistry().AllowInternalTargets()
+	s.statuses = nil
+	s.received = nil
+	s.target = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var payload savedsearch.Payload
+		json.Unmarshal(body, &payload)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.received = append(s.received, received{header: r.Header, body: body, payload: payload})
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+func (s *savedSearchTestSuite) TearDownTest() {
+	s.target.Close()
+}
+
+func (s *savedSearchTestSuite) create(filters savedsearch.Filters) savedsearch.SavedSearch {
+	search, err := s.registry.Create(savedsearch.SavedSearch{Name: "watch", Filters: filters, TargetURL: s.target.URL})
+	s.Require().NoError(err)
+	return search
+}
+
+func (s *savedSearchTestSuite) TestFilters_Matches() {
+	repo := model.Repository{
+		Provider:    "gitlab",
+		Repository:  "parser",
+		Description: "A toml parser",
+		Languages:   map[string]model.Language{"rust": {Bytes: 100}},
+	}
+	s.True(savedsearch.Filters{}.Matches(repo))
+	s.True(savedsearch.Filters{Providers: []string{"github", "GitLab"}, Language: "rust", Text: "toml"}.Matches(repo))
+	s.True(savedsearch.Filters{Providers: []string{"all"}}.Matches(repo))
+	s.False(savedsearch.Filters{Providers: []string{"github"}}.Matches(repo))
+	s.False(savedsearch.Filters{Language: "go"}.Matches(repo))
+	s.False(savedsearch.Filters{Text: "website"}.Matches(repo))
+}
+
+func (s *savedSearchTestSuite) TestRegistry_CreateValidates() {
+	_, err := s.registry.Create(savedsearch.SavedSearch{Name: " ", TargetURL: s.target.URL})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+	_, err = s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: "ftp://example.com"})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+	_, err = s.registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: "/relative"})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+	s.Empty(s.registry.List())
+}
+
+func (s *savedSearchTestSuite) TestRegistry_RefusesInternalTargets() {
+	registry := savedsearch.NewRegistry()
+	for _, target := range []string{
+		s.target.URL,
+		"http://localhost:8080/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.1.1]/hook",
+		"http://100.64.0.1/hook",
+	} {
+		_, err := registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: target})
+		s.ErrorIs(err, savedsearch.ErrInvalid, target)
+	}
+	search, err := registry.Create(savedsearch.SavedSearch{Name: "watch", TargetURL: "https://example.com/hook"})
+	s.Require().NoError(err)
+	_, err = registry.Update(search.ID, savedsearch.SavedSearch{Name: "watch", TargetURL: "http://127.0.0.1/hook"})
+	s.ErrorIs(err, savedsearch.ErrInvalid)
+}
+
+func (s *savedSearchTestSuite) TestTargetClient_RefusesInternalAddresses() {
+	// a name which passed validation may resolve to an internal address by the time of the delivery
+	search := savedsearch.SavedSearch{ID: "1", Name: "watch", TargetURL: strings.Replace(s.target.URL, "127.0.0.1", "localhost", 1)}
+	client := savedsearch.TargetClient(time.Second, false)
+	delivery := savedsearch.NewDeliverer(client, 1, time.Millisecond).Deliver(context.Background(), search, nil)
+	s.Equal(savedsearch.StatusDeadLetter, delivery.Status)
+	s.Require().Len(delivery.Attempts, 1)
+	s.Contains(delivery.Attempts[0].Error, savedsearch.ErrInternalTarget.Error())
+	s.Empty(s.received)
+
+	client = savedsearch.TargetClient(time.Second, true)
+	delivery = savedsearch.NewDeliverer(client, 1, time.Millisecond).Deliver(context.Background(), search, nil)
+	s.Equal(savedsearch.StatusDelivered, delivery.Status)
+}
+
+func (s *savedSearchTestSuite) TestRegistry_Lifecycle() {
+	search := s.create(savedsearch.Filters{Language: "go"})
+	s.NotEmpty(search.ID)
+	s.Len(search.Secret, 64)
+	s.False(search.CreatedAt.IsZero())
+
+	updated, err := s.registry.Update(search.ID, savedsearch.SavedSearch{Name: "renamed", TargetURL: s.target.URL})
+	s.Require().NoError(err)
+	s.Equal("renamed", updated.Name)
+	s.Empty(updated.Filters.Language)
+	// the secret is kept unless a new one is given
+	s.Equal(search.Secret, updated.Secret)
+	s.Equal(search.CreatedAt, updated.CreatedAt)
+
+	updated, err = s.registry.Update(search.ID, savedsearch.SavedSearch{Name: "renamed", TargetURL: s.target.URL, Secret: "rotated"})
+	s.Require().NoError(err)
+	s.Equal("rotated", updated.Secret)
+
+	got, err := s.registry.Get(search.ID)
+	s.Require().NoError(err)
+	s.Equal(updated, got)
+
+	s.Require().NoError(s.registry.Delete(search.ID))
+	_, err = s.registry.Get(search.ID)
+	s.ErrorIs(err, savedsearch.ErrNotFound)
+	s.ErrorIs(s.registry.Delete(search.ID), savedsearch.ErrNotFound)
+	_, err = s.registry.Update(search.ID, updated)
+	s.ErrorIs(err, savedsearch.ErrNotFound)
+}
+
+func (s *savedSearchTestSuite) TestDeliver_SignsThePayload() {
+	search := s.create(savedsearch.Filters{})
+	repos := []model.Repository{{Provider: "github", ID: 1, Repository: "toml"}}
+
+	delivery := savedsearch.NewDeliverer(http.DefaultClient, 3, time.Millisecond).Deliver(context.Background(), search, repos)
+	s.Equal(savedsearch.StatusDelivered, delivery.Status)
+	s.Equal(1, delivery.Repositories)
+	s.Require().Len(delivery.Attempts, 1)
+	s.Equal(http.StatusNoContent, delivery.Attempts[0].StatusCode)
+	s.Empty(delivery.Payload)
+
+	s.Require().Len(s.received, 1)
+	got := s.received[0]
+	s.NoError(webhook.Verify([]byte(search.Secret), got.body, got.header.Get(savedsearch.HeaderSignature)))
+	s.Equal(delivery.ID, got.header.Get(savedsearch.HeaderDelivery))
+	s.Equal(savedsearch.EventMatched, got.header.Get(savedsearch.HeaderEvent))
+	s.Equal(search.ID, got.payload.SearchID)
+	s.Equal(repos, got.payload.Repositories)
+}
+
+func (s *savedSearchTestSuite) TestDeliver_RetriesServerErrors() {
+	s.statuses = []int{http.StatusBadGateway, http.StatusTooManyRequests}
+	search := s.create(savedsearch.Filters{})
+
+	delivery := savedsearch.NewDeliverer(http.DefaultClient, 3, time.Millisecond).Deliver(context.Background(), search, nil)
+	s.Equal(savedsearch.StatusDelivered, delivery.Status)
+	s.Require().Len(delivery.Attempts, 3)
+	s.Equal(http.StatusBadGateway, delivery.Attempts[0].StatusCode)
+	s.NotEmpty(delivery.Attempts[0].Error)
+	s.Equal(http.StatusTooManyRequests, delivery.Attempts[1].StatusCode)
+	s.Empty(delivery.Attempts[2].Error)
+	// every attempt is the same delivery
+	s.Require().Len(s.received, 3)
+	s.Equal(s.received[0].header.Get(savedsearch.HeaderDelivery), s.received[2].header.Get(savedsearch.HeaderDelivery))
+}
+
+func (s *savedSearchTestSuite) TestDeliver_DeadLetters() {
+	search := s.create(savedsearch.Filters{})
+	deliverer := savedsearch.NewDeliverer(http.DefaultClient, 3, time.Millisecond)
+
+	// client errors aren't retried
+	s.statuses = []int{http.StatusGone}
+	delivery := deliverer.Deliver(context.Background(), search, nil)
+	s.Equal(savedsearch.StatusDeadLetter, delivery.Status)
+	s.Len(delivery.Attempts, 1)
+	s.NotEmpty(delivery.Payload)
+
+	// server errors are retried until the attempts run out
+	s.statuses = []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}
+	delivery = deliverer.Deliver(context.Background(), search, nil)
+	s.Equal(savedsearch.StatusDeadLetter, delivery.Status)
+	s.Len(delivery.Attempts, 3)
+
+	var payload savedsearch.Payload
+	s.Require().NoError(json.Unmarshal(delivery.Payload, &payload))
+	s.Equal(delivery.ID, payload.DeliveryID)
+}
+
+func (s *savedSearchTestSuite) TestLog_FiltersByStatus() {
+	log := savedsearch.NewLog()
+	log.Record(savedsearch.Delivery{ID: "1", SearchID: "a", Status: savedsearch.StatusDelivered})
+	log.Record(savedsearch.Delivery{ID: "2", SearchID: "a", Status: savedsearch.StatusDeadLetter})
+	log.Record(savedsearch.Delivery{ID: "3", SearchID: "b", Status: savedsearch.StatusDelivered})
+
+	ids := func(deliveries []savedsearch.Delivery) []string {
+		out := []string{}
+		for _, delivery := range deliveries {
+			out = append(out, delivery.ID)
+		}
+		return out
+	}
+	s.Equal([]string{"2", "1"}, ids(log.List("a", "")))
+	s.Equal([]string{"2"}, ids(log.List("a", savedsearch.StatusDeadLetter)))
+
+	log.Forget("a")
+	s.Empty(log.List("a", ""))
+	s.Len(log.List("b", ""), 1)
+}
+
+func (s *savedSearchTestSuite) TestEvaluate_DeliversNewMatchesOnce() {
+	index := store.NewMemory()
+	index.Upsert(model.Repository{Provider: "github", ID: 1, Repository: "before", Languages: map[string]model.Language{"go": {Bytes: 1}}})
+
+	search := s.create(savedsearch.Filters{Language: "go"})
+	log := savedsearch.NewLog()
+	evaluator := savedsearch.NewEvaluator(s.registry, index, savedsearch.NewDeliverer(http.DefaultClient, 1, time.Millisecond), log, logger.Default())
+
+	index.Upsert(model.Repository{Provider: "github", ID: 2, Repository: "after", Languages: map[string]model.Language{"go": {Bytes: 1}}})
+	index.Upsert(model.Repository{Provider: "github", ID: 3, Repository: "other", Languages: map[string]model.Language{"rust": {Bytes: 1}}})
+	evaluator.Evaluate(context.Background())
+
+	// the repository ingested before the search was created isn't delivered
+	s.Require().Len(s.received, 1)
+	s.Require().Len(s.received[0].payload.Repositories, 1)
+	s.Equal(int64(2), s.received[0].payload.Repositories[0].ID)
+
+	// an update of a delivered repository isn't delivered again
+	index.Upsert(model.Repository{Provider: "github", ID: 2, Repository: "after", Description: "updated"})
+	evaluator.Evaluate(context.Background())
+	s.Len(s.received, 1)
+
+	deliveries := log.List(search.ID, "")
+	s.Require().Len(deliveries, 1)
+	s.Equal(savedsearch.StatusDelivered, deliveries[0].Status)
+}
+
+func (s *savedSearchTestSuite) TestEvaluate_KeepsDeadLetters() {
+	s.statuses = []int{http.StatusBadRequest}
+	index := store.NewMemory()
+	search := s.create(savedsearch.Filters{})
+	log := savedsearch.NewLog()
+	evaluator := savedsearch.NewEvaluator(s.registry, index, savedsearch.NewDeliverer(http.DefaultClient, 3, time.Millisecond), log, logger.Default())
+
+	index.Upsert(model.Repository{Provider: "github", ID: 1, Repository: "new"})
+	evaluator.Evaluate(context.Background())
+	evaluator.Evaluate(context.Background())
+
+	s.Len(s.received, 1)
+	s.Len(log.List(search.ID, savedsearch.StatusDeadLetter), 1)
+	s.Empty(log.List(search.ID, savedsearch.StatusDelivered))
+}
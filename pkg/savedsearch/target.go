@@ -0,0 +1,70 @@
+package savedsearch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrInternalTarget = errors.New("target is an internal address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which like the private ranges isn't reachable from the internet
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// internalAddr reports whether the address is one the service shouldn't post to on behalf of a client,
+// such as its own loopback, the cloud metadata endpoint at 169.254.169.254 or the private network it runs in
+func internalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsValid() ||
+		addr.IsUnspecified() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+// checkTargetHost refuses the hosts which are internal without having to be resolved. Names are
+// checked again when the deliveries connect, since what they resolve to can change in between
+func checkTargetHost(host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrInternalTarget
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && internalAddr(addr) {
+		return ErrInternalTarget
+	}
+	return nil
+}
+
+// TargetClient returns the client deliveries are posted with. Unless internal targets are allowed,
+// it refuses to connect to internal addresses whatever the name of the target or of the redirects
+// it answers with resolved to. Proxies are left out so that the check applies to the target itself
+func TargetClient(timeout time.Duration, allowInternal bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowInternal {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("failed to parse target address %s: %w", address, err)
+			}
+			if internalAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrInternalTarget, addrPort.Addr())
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
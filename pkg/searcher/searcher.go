@@ -4,64 +4,25 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
 )
 
-const (
-	expectedResults = 100
-	wantedType      = "CreateEvent"
-	wantedRefType   = "repository"
-)
+const expectedResults = 100
 
 type Searcher struct {
-	client github.Client
+	forge forge.Forge
 }
 
-func NewSearcher(client github.Client) *Searcher {
+func NewSearcher(f forge.Forge) *Searcher {
 	return &Searcher{
-		client: client,
+		forge: f,
 	}
 }
 
-func (s *Searcher) Search(ctx context.Context) (out []github.Repository, err error) {
-	lastID, err := s.lastRepoID(ctx)
+func (s *Searcher) Search(ctx context.Context) (out []forge.Project, err error) {
+	lastID, err := s.forge.NewestProjectID(ctx)
 	if err != nil {
 		return out, fmt.Errorf("failed to fetch last repo ID: %w", err)
 	}
-	return s.client.ListPublicRepos(ctx, lastID-int64(expectedResults))
-}
-
-func (s *Searcher) lastRepoID(ctx context.Context) (ID int64, err error) {
-	page := 0
-	for {
-		select {
-		case <-ctx.Done():
-			return 0, fmt.Errorf("aborted searching for repos: %w", ctx.Err())
-		default:
-			recentEvents, err := s.client.ListPublicEvents(ctx, expectedResults, page)
-			if err != nil {
-				return ID, fmt.Errorf("failed to list public events: %w", err)
-			}
-
-			// if we didn't find a valid Repo ID then we increment the page and keep looking back
-			ID = s.validate(ctx, recentEvents)
-			if ID > 0 {
-				return ID, nil
-			}
-			page++
-		}
-	}
-	return 0, nil
-}
-
-func (s *Searcher) validate(ctx context.Context, events []github.Event) (ID int64) {
-	for _, event := range events {
-		if event.Type != wantedType {
-			continue
-		}
-		if event.Payload.RefType == wantedRefType {
-			return event.Repo.ID
-		}
-	}
-	return 0
+	return s.forge.ListProjects(ctx, lastID-int64(expectedResults), expectedResults)
 }
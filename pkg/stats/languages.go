@@ -0,0 +1,219 @@
+package stats
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/store"
+)
+
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+
+	// MaxBuckets keeps a fine interval over a long range from building a huge response
+	MaxBuckets = 1000
+	// risingLimit is how many languages the rising view lists at most
+	risingLimit = 10
+)
+
+var (
+	ErrUnknownInterval = errors.New("unknown interval")
+	ErrInvalidRange    = errors.New("invalid time range")
+
+	intervals = map[string]time.Duration{
+		IntervalHour: time.Hour,
+		IntervalDay:  24 * time.Hour,
+		IntervalWeek: 7 * 24 * time.Hour,
+	}
+)
+
+// Query selects the repositories created within [From, To) and how they are bucketed
+type Query struct {
+	Interval string
+	From     time.Time
+	To       time.Time
+	// Providers restricts the repositories counted, all of them are when it is empty
+	Providers map[string]struct{}
+}
+
+// Totals is how many repositories use a language and how many bytes of it they hold.
+// Forges which only report shares don't add to the bytes
+type Totals struct {
+	Repositories int   `json:"repositories"`
+	Bytes        int64 `json:"bytes"`
+}
+
+type Bucket struct {
+	Start        time.Time         `json:"start"`
+	Repositories int               `json:"repositories"`
+	Languages    map[string]Totals `json:"languages"`
+}
+
+// Trend compares the share of the repositories using a language in the queried
+// window with its share in the window of the same length just before it
+type Trend struct {
+	Language string `json:"language"`
+	Current  int    `json:"current"`
+	Previous int    `json:"previous"`
+	// ShareChange is in percentage points
+	ShareChange float64 `json:"share_change"`
+}
+
+type LanguageReport struct {
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Buckets  []Bucket  `json:"buckets"`
+	Rising   []Trend   `json:"rising"`
+}
+
+// DefaultRange is the window reported when none is given, it ends at now
+func DefaultRange(interval string, now time.Time) (from, to time.Time) {
+	to = now.UTC()
+	switch interval {
+	case IntervalHour:
+		return to.Add(-24 * time.Hour), to
+	case IntervalWeek:
+		return to.AddDate(0, 0, -7*12), to
+	}
+	return to.AddDate(0, 0, -30), to
+}
+
+// Validate checks the interval and that the range is made of at most MaxBuckets buckets
+func (q Query) Validate() error {
+	step, ok := intervals[q.Interval]
+	if !ok {
+		return fmt.Errorf("%w %q, expected %s, %s or %s", ErrUnknownInterval, q.Interval, IntervalHour, IntervalDay, IntervalWeek)
+	}
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+	if q.To.Sub(truncate(q.From, q.Interval))/step >= MaxBuckets {
+		return fmt.Errorf("%w: more than %d %s buckets", ErrInvalidRange, MaxBuckets, q.Interval)
+	}
+	return nil
+}
+
+// Languages buckets the indexed repositories by creation time and totals their languages.
+// Repositories the forges didn't date are counted from when the service indexed them
+func Languages(records []store.Record, q Query) LanguageReport {
+	report := LanguageReport{Interval: q.Interval, From: q.From.UTC(), To: q.To.UTC(), Buckets: []Bucket{}}
+
+	buckets := make(map[time.Time]*Bucket)
+	for start := truncate(report.From, q.Interval); start.Before(report.To); start = next(start, q.Interval) {
+		report.Buckets = append(report.Buckets, Bucket{Start: start, Languages: map[string]Totals{}})
+	}
+	for i := range report.Buckets {
+		buckets[report.Buckets[i].Start] = &report.Buckets[i]
+	}
+
+	previousFrom := report.From.Add(-report.To.Sub(report.From))
+	current, previous := newWindow(), newWindow()
+	for _, record := range records {
+		if _, ok := q.Providers[record.Provider]; !ok && len(q.Providers) > 0 {
+			continue
+		}
+		created := record.CreatedAt
+		if created.IsZero() {
+			created = record.IndexedAt
+		}
+		created = created.UTC()
+
+		switch {
+		case !created.Before(report.From) && created.Before(report.To):
+			current.add(record)
+			bucket := buckets[truncate(created, q.Interval)]
+			bucket.Repositories++
+			for name, language := range record.Languages {
+				totals := bucket.Languages[name]
+				totals.Repositories++
+				totals.Bytes += language.Bytes
+				bucket.Languages[name] = totals
+			}
+		case !created.Before(previousFrom) && created.Before(report.From):
+			previous.add(record)
+		}
+	}
+
+	report.Rising = rising(current, previous)
+	return report
+}
+
+// window counts the repositories using each language over a whole range
+type window struct {
+	repositories int
+	languages    map[string]int
+}
+
+func newWindow() *window {
+	return &window{languages: make(map[string]int)}
+}
+
+func (w *window) add(record store.Record) {
+	w.repositories++
+	for name := range record.Languages {
+		w.languages[name]++
+	}
+}
+
+func (w *window) share(language string) float64 {
+	if w.repositories == 0 {
+		return 0
+	}
+	return 100 * float64(w.languages[language]) / float64(w.repositories)
+}
+
+// rising lists the languages whose share grew the most, shares rather than counts are
+// compared so that a busier window doesn't make every language look like it is rising
+func rising(current, previous *window) []Trend {
+	trends := []Trend{}
+	for language, count := range current.languages {
+		change := current.share(language) - previous.share(language)
+		if change <= 0 {
+			continue
+		}
+		trends = append(trends, Trend{
+			Language:    language,
+			Current:     count,
+			Previous:    previous.languages[language],
+			ShareChange: float64(int(change*100+0.5)) / 100,
+		})
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].ShareChange != trends[j].ShareChange {
+			return trends[i].ShareChange > trends[j].ShareChange
+		}
+		return trends[i].Language < trends[j].Language
+	})
+	if len(trends) > risingLimit {
+		trends = trends[:risingLimit]
+	}
+	return trends
+}
+
+// truncate returns the start of the bucket holding t, weeks start on Monday
+func truncate(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case IntervalHour:
+		return t.Truncate(time.Hour)
+	case IntervalWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func next(start time.Time, interval string) time.Time {
+	switch interval {
+	case IntervalHour:
+		return start.Add(time.Hour)
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,107 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/stats"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/stretchr/testify/suite"
+)
+
+type languagesTestSuite struct {
+	suite.Suite
+	from time.Time
+}
+
+func TestLanguages(t *testing.T) {
+	suite.Run(t, new(languagesTestSuite))
+}
+
+func (s *languagesTestSuite) SetupTest() {
+	s.from = time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC)
+}
+
+func (s *languagesTestSuite) record(provider string, created time.Time, languages ...string) store.Record {
+	repo := model.Repository{Provider: provider, CreatedAt: created, Languages: map[string]model.Language{}}
+	for _, language := range languages {
+		repo.Languages[language] = model.Language{Bytes: 100}
+	}
+	return store.Record{Repository: repo}
+}
+
+func (s *languagesTestSuite) TestLanguages_Buckets() {
+	records := []store.Record{
+		s.record("github", s.from.Add(10*time.Minute), "go", "shell"),
+		s.record("github", s.from.Add(50*time.Minute), "go"),
+		s.record("gitlab", s.from.Add(2*time.Hour+time.Minute), "rust"),
+		// outside of the window
+		s.record("github", s.from.Add(3*time.Hour), "go"),
+		// undated repositories are counted from when they were indexed
+		{Repository: model.Repository{Provider: "gitea", Languages: map[string]model.Language{"c": {}}}, IndexedAt: s.from.Add(time.Hour)},
+	}
+	report := stats.Languages(records, stats.Query{Interval: stats.IntervalHour, From: s.from, To: s.from.Add(3 * time.Hour)})
+
+	s.Require().Len(report.Buckets, 3)
+	s.Equal(s.from, report.Buckets[0].Start)
+	s.Equal(2, report.Buckets[0].Repositories)
+	s.Equal(stats.Totals{Repositories: 2, Bytes: 200}, report.Buckets[0].Languages["go"])
+	s.Equal(stats.Totals{Repositories: 1, Bytes: 100}, report.Buckets[0].Languages["shell"])
+	s.Equal(stats.Totals{Repositories: 1}, report.Buckets[1].Languages["c"])
+	s.Equal(stats.Totals{Repositories: 1, Bytes: 100}, report.Buckets[2].Languages["rust"])
+
+	report = stats.Languages(records, stats.Query{
+		Interval:  stats.IntervalHour,
+		From:      s.from,
+		To:        s.from.Add(3 * time.Hour),
+		Providers: map[string]struct{}{"gitlab": {}},
+	})
+	s.Equal(0, report.Buckets[0].Repositories)
+	s.Equal(1, report.Buckets[2].Repositories)
+}
+
+func (s *languagesTestSuite) TestLanguages_WeeksStartOnMonday() {
+	// the 2nd of May 2024 is a Thursday
+	report := stats.Languages(nil, stats.Query{Interval: stats.IntervalWeek, From: s.from, To: s.from.AddDate(0, 0, 7)})
+	s.Require().Len(report.Buckets, 2)
+	s.Equal(time.Date(2024, 4, 29, 0, 0, 0, 0, time.UTC), report.Buckets[0].Start)
+	s.Equal(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC), report.Buckets[1].Start)
+	s.Empty(report.Rising)
+}
+
+func (s *languagesTestSuite) TestLanguages_Rising() {
+	previous := s.from.AddDate(0, 0, -1)
+	records := []store.Record{
+		// go is used by half of the repositories in both windows, it isn't rising
+		s.record("github", previous, "go"),
+		s.record("github", previous, "python"),
+		s.record("github", previous, "python"),
+		s.record("github", previous, "go", "zig"),
+		s.record("github", s.from, "go"),
+		s.record("github", s.from, "zig"),
+		s.record("github", s.from, "go", "zig"),
+		s.record("github", s.from, "rust"),
+	}
+	report := stats.Languages(records, stats.Query{Interval: stats.IntervalDay, From: s.from, To: s.from.AddDate(0, 0, 1)})
+
+	// both gained 25 points, the tie is broken by name
+	s.Equal([]stats.Trend{
+		{Language: "rust", Current: 1, Previous: 0, ShareChange: 25},
+		{Language: "zig", Current: 2, Previous: 1, ShareChange: 25},
+	}, report.Rising)
+}
+
+func (s *languagesTestSuite) TestQuery_Validate() {
+	q := stats.Query{Interval: stats.IntervalDay, From: s.from, To: s.from.AddDate(0, 0, 30)}
+	s.NoError(q.Validate())
+
+	q.Interval = "minute"
+	s.ErrorIs(q.Validate(), stats.ErrUnknownInterval)
+
+	q = stats.Query{Interval: stats.IntervalDay, From: s.from, To: s.from}
+	s.ErrorIs(q.Validate(), stats.ErrInvalidRange)
+
+	q = stats.Query{Interval: stats.IntervalHour, From: s.from, To: s.from.AddDate(0, 0, 60)}
+	s.ErrorIs(q.Validate(), stats.ErrInvalidRange)
+}
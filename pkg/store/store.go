@@ -0,0 +1,167 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+)
+
+// Store is the local index of repositories the service has learnt about,
+// either through searches or through events pushed by the forges
+type Store interface {
+	// Upsert adds the repository or merges it into the one already indexed, it reports whether it is new.
+	// Empty fields leave the indexed ones alone unless they are listed as authoritative
+	Upsert(repo model.Repository, authoritative ...Field) (created bool)
+	// Delete removes the repository and reports whether it was indexed
+	Delete(provider string, ID int64) (deleted bool)
+	Get(provider string, ID int64) (record Record, ok bool)
+	// List returns every indexed repository, most recently created first
+	List() []Record
+}
+
+// Record is a repository as last seen by the service
+type Record struct {
+	model.Repository
+	IndexedAt time.Time `json:"indexed_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Field names a field of a repository whose value a source knows for sure, even when it is empty,
+// such as the description of a webhook payload which is null once it was cleared
+type Field int
+
+const (
+	FieldDescription Field = iota
+	FieldHTMLURL
+	FieldFork
+	FieldStars
+	FieldLicense
+	FieldTopics
+)
+
+type key struct {
+	provider string
+	ID       int64
+}
+
+type memory struct {
+	mu    sync.RWMutex
+	repos map[key]Record
+	now   func() time.Time
+}
+
+// NewMemory keeps the index in memory, so it starts out empty on every restart
+func NewMemory() Store {
+	return &memory{
+		repos: make(map[key]Record),
+		now:   func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Upsert only overwrites the fields that are set on the given repository, or listed as authoritative,
+// since some sources such as webhooks only know part of what a search found out
+func (m *memory) Upsert(repo model.Repository, authoritative ...Field) (created bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	k := key{provider: repo.Provider, ID: repo.ID}
+	existing, ok := m.repos[k]
+	if !ok {
+		m.repos[k] = Record{Repository: repo, IndexedAt: now, UpdatedAt: now}
+		return true
+	}
+
+	merged := existing.Repository
+	if repo.FullName != "" {
+		merged.FullName = repo.FullName
+	}
+	if repo.Owner != "" {
+		merged.Owner = repo.Owner
+	}
+	if repo.Repository != "" {
+		merged.Repository = repo.Repository
+	}
+	known := func(field Field) bool {
+		for _, f := range authoritative {
+			if f == field {
+				return true
+			}
+		}
+		return false
+	}
+	if repo.Description != "" || known(FieldDescription) {
+		merged.Description = repo.Description
+	}
+	if repo.OwnerType != "" {
+		merged.OwnerType = repo.OwnerType
+	}
+	if repo.HTMLURL != "" || known(FieldHTMLURL) {
+		merged.HTMLURL = repo.HTMLURL
+	}
+	// an estimate of the creation time changes from one search to the next, the first one is kept
+	// until the exact time is known, which an estimate never replaces
+	if !repo.CreatedAt.IsZero() && (merged.CreatedAt.IsZero() || merged.CreatedAtEstimated && !repo.CreatedAtEstimated) {
+		merged.CreatedAt = repo.CreatedAt
+		merged.CreatedAtEstimated = repo.CreatedAtEstimated
+	}
+	// partial payloads can't tell a repository isn't a fork
+	if repo.Fork || known(FieldFork) {
+		merged.Fork = repo.Fork
+	}
+	if repo.Stars != 0 || known(FieldStars) {
+		merged.Stars = repo.Stars
+	}
+	if repo.License != "" || known(FieldLicense) {
+		merged.License = repo.License
+	}
+	if repo.Topics != nil || known(FieldTopics) {
+		merged.Topics = repo.Topics
+	}
+	if len(repo.Languages) > 0 {
+		merged.Languages = repo.Languages
+	}
+	m.repos[k] = Record{Repository: merged, IndexedAt: existing.IndexedAt, UpdatedAt: now}
+	return false
+}
+
+func (m *memory) Delete(provider string, ID int64) (deleted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key{provider: provider, ID: ID}
+	if _, ok := m.repos[k]; !ok {
+		return false
+	}
+	delete(m.repos, k)
+	return true
+}
+
+func (m *memory) Get(provider string, ID int64) (record Record, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	record, ok = m.repos[key{provider: provider, ID: ID}]
+	return record, ok
+}
+
+func (m *memory) List() []Record {
+	m.mu.RLock()
+	records := make([]Record, 0, len(m.repos))
+	for _, record := range m.repos {
+		records = append(records, record)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.ID > b.ID
+	})
+	return records
+}
@@ -2,11 +2,13 @@ package subrequester
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"sync"
 
-	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
 	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/ranking"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,23 +24,23 @@ type SubRequester struct {
 	workerCount int
 
 	logger logrus.FieldLogger
-	client github.Client
-	input  chan github.Repository
+	forge  forge.Forge
+	input  chan forge.Project
 	output chan model.Repository
 	errs   chan error
 }
 
 func NewSubRequester(
 	workerCount int,
-	client github.Client,
+	f forge.Forge,
 	logger logrus.FieldLogger,
 ) *SubRequester {
-	input := make(chan github.Repository, workerCount)
+	input := make(chan forge.Project, workerCount)
 	output := make(chan model.Repository, workerCount)
 	errs := make(chan error, workerCount)
 	return &SubRequester{
 		workerCount: workerCount,
-		client:      client,
+		forge:       f,
 		input:       input,
 		output:      output,
 		errs:        errs,
@@ -46,13 +48,32 @@ func NewSubRequester(
 	}
 }
 
+// Collect returns the repositories matching the filters newest first, rather than in the
+// order the workers happened to finish in
 func (s *SubRequester) Collect(
 	ctx context.Context,
-	in []github.Repository,
+	in []forge.Project,
 	filters map[string]string,
 ) (out []model.Repository, err error) {
-	wg := &sync.WaitGroup{}
 	out = make([]model.Repository, 0, len(in))
+	err = s.Stream(ctx, in, filters, func(repo model.Repository) {
+		out = append(out, repo)
+	})
+	sort.SliceStable(out, func(i, j int) bool {
+		return ranking.NewestFirst(out[i], out[j])
+	})
+	return out, err
+}
+
+// Stream hands each repository matching the filters to emit as soon as its languages are known.
+// emit is only ever called from one goroutine at a time
+func (s *SubRequester) Stream(
+	ctx context.Context,
+	in []forge.Project,
+	filters map[string]string,
+	emit func(model.Repository),
+) error {
+	wg := &sync.WaitGroup{}
 
 	// fan out to multiple workers to make time consuming requests
 	s.logger.Debugf("spawning %d workers", s.workerCount)
@@ -64,7 +85,7 @@ func (s *SubRequester) Collect(
 	done := make(chan struct{})
 	go func() {
 		for repo := range s.output {
-			out = append(out, repo)
+			emit(repo)
 		}
 		close(done)
 	}()
@@ -93,9 +114,9 @@ func (s *SubRequester) Collect(
 	s.logger.Debug("subrequests done")
 
 	if len(errs) > 0 {
-		return out, errs[0]
+		return errs[0]
 	}
-	return out, nil
+	return nil
 }
 
 func (s *SubRequester) runWorker(
@@ -117,10 +138,10 @@ func (s *SubRequester) runWorker(
 
 func (s *SubRequester) fetchSingle(
 	ctx context.Context,
-	repo github.Repository,
+	repo forge.Project,
 	filters map[string]string,
 ) {
-	attrs, err := s.client.FetchAttribute(ctx, repo.LanguagesURL)
+	attrs, err := s.forge.FetchLanguages(ctx, repo)
 	if err != nil {
 		s.errs <- err
 	}
@@ -128,31 +149,44 @@ func (s *SubRequester) fetchSingle(
 	languages := make(map[string]model.Language)
 	for k, val := range attrs {
 		key := strings.ToLower(k)
-		languages[key] = model.Language{Bytes: val}
-	}
-
-	relevant := true
-
-	// if a language filter is set check if this entry is relevant
-	if langs, ok := filters[FilterKeyLanguage]; ok {
-		relevant = false
-		for _, l := range strings.Split(strings.ToLower(langs), ",") {
-			if _, found := languages[l]; found {
-				relevant = true
-				break
-			}
-		}
+		languages[key] = val
 	}
 
 	// discard any entries that don't match the filters
-	if !relevant {
+	if !Relevant(languages, filters) {
 		return
 	}
 
 	s.output <- model.Repository{
-		FullName:   repo.FullName,
-		Owner:      repo.Owner.Login,
-		Repository: repo.Name,
-		Languages:  languages,
+		Provider:           s.forge.Name(),
+		ID:                 repo.ID,
+		FullName:           repo.FullName,
+		Owner:              repo.Owner,
+		OwnerType:          repo.OwnerType,
+		Repository:         repo.Name,
+		Description:        repo.Description,
+		HTMLURL:            repo.HTMLURL,
+		CreatedAt:          repo.CreatedAt,
+		CreatedAtEstimated: repo.CreatedAtEstimated,
+		Fork:               repo.Fork,
+		Stars:              repo.Stars,
+		License:            repo.License,
+		Topics:             repo.Topics,
+		Languages:          languages,
+	}
+}
+
+// Relevant reports whether a repository using the languages, keyed in lower case, matches the filters.
+// The language filter is a comma separated list of which any one language is enough
+func Relevant(languages map[string]model.Language, filters map[string]string) bool {
+	langs, ok := filters[FilterKeyLanguage]
+	if !ok {
+		return true
+	}
+	for _, l := range strings.Split(strings.ToLower(langs), ",") {
+		if _, found := languages[l]; found {
+			return true
+		}
 	}
+	return false
 }
@@ -6,7 +6,7 @@ import (
 	"testing"
 
 	"github.com/Scalingo/go-utils/logger"
-	"github.com/laouji/git-repo-searcher/pkg/github"
+	"github.com/laouji/git-repo-searcher/pkg/forge"
 	mock_github "github.com/laouji/git-repo-searcher/pkg/github/mocks"
 	"github.com/laouji/git-repo-searcher/pkg/subrequester"
 	"github.com/stretchr/testify/suite"
@@ -29,13 +29,13 @@ func (s *subRequesterTestSuite) SetupTest() {
 }
 
 func (s *subRequesterTestSuite) TestCollect_NoFilters() {
-	repos := []github.Repository{
+	repos := []forge.Project{
 		{FullName: "RepoFName1", Name: "RepoName1", LanguagesURL: "http://url.com/1"},
 		{FullName: "RepoFName2", Name: "RepoName2", LanguagesURL: "http://url.com/2"},
 		{FullName: "RepoFName3", Name: "RepoName3", LanguagesURL: "http://url.com/3"},
 		{FullName: "RepoFName4", Name: "RepoName4", LanguagesURL: "http://url.com/4"},
 	}
-	subRequester := subrequester.NewSubRequester(3, s.clientMock, logger.Default())
+	subRequester := subrequester.NewSubRequester(3, forge.NewGitHub(s.clientMock), logger.Default())
 
 	sampleAttribute := map[string]int64{}
 	s.clientMock.EXPECT().FetchAttribute(gomock.Any(), repos[0].LanguagesURL).Return(sampleAttribute, nil)
@@ -46,12 +46,13 @@ func (s *subRequesterTestSuite) TestCollect_NoFilters() {
 	out, err := subRequester.Collect(context.Background(), repos, map[string]string{})
 	s.NoError(err)
 	s.Require().Len(out, len(repos))
+	s.Equal(forge.ProviderGitHub, out[0].Provider)
 }
 
 func (s *subRequesterTestSuite) TestCollect_APIErrors() {
 	expectedURL := "expectedURL"
-	subRequester := subrequester.NewSubRequester(3, s.clientMock, logger.Default())
-	repos := []github.Repository{
+	subRequester := subrequester.NewSubRequester(3, forge.NewGitHub(s.clientMock), logger.Default())
+	repos := []forge.Project{
 		{FullName: "RepoFName1", Name: "RepoName1", LanguagesURL: expectedURL},
 	}
 
@@ -63,13 +64,13 @@ func (s *subRequesterTestSuite) TestCollect_APIErrors() {
 }
 
 func (s *subRequesterTestSuite) TestCollect_FilterByLanguage() {
-	repos := []github.Repository{
+	repos := []forge.Project{
 		{FullName: "RepoFName1", Name: "RepoName1", LanguagesURL: "http://url.com/1"},
 		{FullName: "RepoFName2", Name: "RepoName2", LanguagesURL: "http://url.com/2"},
 		{FullName: "RepoFName3", Name: "RepoName3", LanguagesURL: "http://url.com/3"},
 		{FullName: "RepoFName4", Name: "RepoName4", LanguagesURL: "http://url.com/4"},
 	}
-	subRequester := subrequester.NewSubRequester(3, s.clientMock, logger.Default())
+	subRequester := subrequester.NewSubRequester(3, forge.NewGitHub(s.clientMock), logger.Default())
 
 	s.clientMock.EXPECT().FetchAttribute(gomock.Any(), repos[0].LanguagesURL).Return(map[string]int64{
 		"Ruby":       3434,
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"sync"
+	"time"
+)
+
+// Deliveries remembers the X-GitHub-Delivery IDs that were processed so a captured
+// payload can't be replayed. IDs are forgotten after ttl, which should outlast the
+// window in which github allows a delivery to be redelivered
+type Deliveries struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+	// pending holds the deliveries being processed, so that concurrent copies are turned away
+	pending map[string]struct{}
+}
+
+func NewDeliveries(ttl time.Duration) *Deliveries {
+	return &Deliveries{
+		ttl:     ttl,
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+		pending: make(map[string]struct{}),
+	}
+}
+
+// Claim reports whether the delivery should be processed. A claimed delivery must be
+// passed to either Done once processed or Release if it failed so that github can redeliver it
+func (d *Deliveries) Claim(ID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.expire()
+
+	if _, ok := d.seen[ID]; ok {
+		return false
+	}
+	if _, ok := d.pending[ID]; ok {
+		return false
+	}
+	d.pending[ID] = struct{}{}
+	return true
+}
+
+func (d *Deliveries) Done(ID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, ID)
+	d.seen[ID] = d.now()
+}
+
+func (d *Deliveries) Release(ID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, ID)
+}
+
+func (d *Deliveries) expire() {
+	cutoff := d.now().Add(-d.ttl)
+	for ID, at := range d.seen {
+		if at.Before(cutoff) {
+			delete(d.seen, ID)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/laouji/git-repo-searcher/pkg/model"
+	"github.com/laouji/git-repo-searcher/pkg/store"
+)
+
+const (
+	EventPing                     = "ping"
+	EventRepository               = "repository"
+	EventInstallationRepositories = "installation_repositories"
+	EventPush                     = "push"
+)
+
+// timestamp decodes both of the formats github uses for dates, push events
+// carry unix timestamps where every other event has RFC 3339 strings
+type timestamp time.Time
+
+func (t *timestamp) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	var seconds int64
+	if err := json.Unmarshal(b, &seconds); err == nil {
+		*t = timestamp(time.Unix(seconds, 0).UTC())
+		return nil
+	}
+	var parsed time.Time
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return fmt.Errorf("failed to parse timestamp %s: %w", b, err)
+	}
+	*t = timestamp(parsed.UTC())
+	return nil
+}
+
+type account struct {
+	Login string `json:"login"`
+	Type  string `json:"type"`
+}
+
+type license struct {
+	SpdxID string `json:"spdx_id"`
+}
+
+// repository is the repository object embedded in webhook payloads, installation events
+// only carry the ID and names so every other field may be empty
+type repository struct {
+	ID              int64     `json:"id"`
+	NodeID          string    `json:"node_id"`
+	Name            string    `json:"name"`
+	FullName        string    `json:"full_name"`
+	Owner           account   `json:"owner"`
+	Private         bool      `json:"private"`
+	Fork            bool      `json:"fork"`
+	Description     string    `json:"description"`
+	HTMLURL         string    `json:"html_url"`
+	CreatedAt       timestamp `json:"created_at"`
+	Language        string    `json:"language"`
+	StargazersCount int       `json:"stargazers_count"`
+	Topics          []string  `json:"topics"`
+	License         *license  `json:"license"`
+
+	// present are the keys of the payload, a null description is a cleared one while a missing one is unknown
+	present map[string]bool
+}
+
+// payloadFields are the keys of the payload which are authoritative for a field of the index when present
+var payloadFields = map[string]store.Field{
+	"description":      store.FieldDescription,
+	"html_url":         store.FieldHTMLURL,
+	"fork":             store.FieldFork,
+	"stargazers_count": store.FieldStars,
+	"license":          store.FieldLicense,
+	"topics":           store.FieldTopics,
+}
+
+func (r *repository) UnmarshalJSON(b []byte) error {
+	type plain repository
+	if err := json.Unmarshal(b, (*plain)(r)); err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	r.present = make(map[string]bool, len(keys))
+	for key := range keys {
+		r.present[key] = true
+	}
+	return nil
+}
+
+// authoritative lists the fields the payload carries, so that what was cleared on github is cleared in the index
+func (r repository) authoritative() (fields []store.Field) {
+	for key, field := range payloadFields {
+		if r.present[key] {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (r repository) model(provider string) model.Repository {
+	repo := model.Repository{
+		Provider:    provider,
+		ID:          r.ID,
+		FullName:    r.FullName,
+		Owner:       r.Owner.Login,
+		OwnerType:   model.NormalizeOwnerType(r.Owner.Type),
+		Repository:  r.Name,
+		Description: r.Description,
+		HTMLURL:     r.HTMLURL,
+		CreatedAt:   time.Time(r.CreatedAt),
+		Fork:        r.Fork,
+		Stars:       r.StargazersCount,
+		Topics:      r.Topics,
+	}
+	if repo.Owner == "" {
+		repo.Owner, _, _ = strings.Cut(r.FullName, "/")
+	}
+	if r.License != nil {
+		repo.License = r.License.SpdxID
+	}
+	// payloads only name the primary language, the breakdown is left to searches
+	if r.Language != "" {
+		repo.Languages = map[string]model.Language{strings.ToLower(r.Language): {}}
+	}
+	return repo
+}
+
+type repositoryEvent struct {
+	Action     string     `json:"action"`
+	Repository repository `json:"repository"`
+}
+
+type installationRepositoriesEvent struct {
+	Action              string       `json:"action"`
+	RepositoriesAdded   []repository `json:"repositories_added"`
+	RepositoriesRemoved []repository `json:"repositories_removed"`
+}
+
+type pushEvent struct {
+	Ref        string     `json:"ref"`
+	Repository repository `json:"repository"`
+}
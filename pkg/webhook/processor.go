@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/laouji/git-repo-searcher/pkg/store"
+	"github.com/sirupsen/logrus"
+)
+
+// Result summarizes what an event changed in the index
+type Result struct {
+	Upserted int  `json:"upserted"`
+	Deleted  int  `json:"deleted"`
+	Ignored  bool `json:"ignored,omitempty"`
+}
+
+// Processor applies github webhook events to the local index. Private repositories
+// are never indexed since the service only surfaces public ones
+type Processor struct {
+	store    store.Store
+	provider string
+	logger   logrus.FieldLogger
+}
+
+func NewProcessor(s store.Store, provider string, logger logrus.FieldLogger) *Processor {
+	return &Processor{
+		store:    s,
+		provider: provider,
+		logger:   logger,
+	}
+}
+
+// Process decodes the payload of the given X-GitHub-Event type, events the index
+// doesn't care about are reported as ignored rather than failing
+func (p *Processor) Process(event string, payload []byte) (result Result, err error) {
+	switch event {
+	case EventRepository:
+		var e repositoryEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return result, fmt.Errorf("failed to unmarshal %s event: %w", event, err)
+		}
+		switch e.Action {
+		case "deleted", "privatized":
+			p.delete(&result, e.Repository)
+		default:
+			p.upsert(&result, e.Repository)
+		}
+	case EventInstallationRepositories:
+		var e installationRepositoriesEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return result, fmt.Errorf("failed to unmarshal %s event: %w", event, err)
+		}
+		for _, repo := range e.RepositoriesAdded {
+			p.upsert(&result, repo)
+		}
+		for _, repo := range e.RepositoriesRemoved {
+			p.delete(&result, repo)
+		}
+	case EventPush:
+		var e pushEvent
+		if err := json.Unmarshal(payload, &e); err != nil {
+			return result, fmt.Errorf("failed to unmarshal %s event: %w", event, err)
+		}
+		p.upsert(&result, e.Repository)
+	default:
+		result.Ignored = true
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"event":    event,
+		"upserted": result.Upserted,
+		"deleted":  result.Deleted,
+	}).Debug("Processed webhook event")
+	return result, nil
+}
+
+func (p *Processor) upsert(result *Result, repo repository) {
+	if repo.ID == 0 {
+		return
+	}
+	if repo.Private {
+		p.delete(result, repo)
+		return
+	}
+
+	indexed := repo.model(p.provider)
+	// keep the full language breakdown a search found over the primary language from the payload
+	if existing, ok := p.store.Get(p.provider, repo.ID); ok && len(existing.Languages) > 0 {
+		indexed.Languages = nil
+	}
+	p.store.Upsert(indexed, repo.authoritative()...)
+	result.Upserted++
+}
+
+func (p *Processor) delete(result *Result, repo repository) {
+	if p.store.Delete(p.provider, repo.ID) {
+		result.Deleted++
+	}
+}
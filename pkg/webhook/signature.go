@@ -0,0 +1,33 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const signaturePrefix = "sha256="
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign computes the X-Hub-Signature-256 header github sends along with a payload
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the X-Hub-Signature-256 header against the payload in constant time
+// https://docs.github.com/en/webhooks/using-webhooks/validating-webhook-deliveries
+func Verify(secret, payload []byte, signature string) error {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return fmt.Errorf("%w: missing %s prefix", ErrInvalidSignature, signaturePrefix)
+	}
+	if !hmac.Equal([]byte(Sign(secret, payload)), []byte(signature)) {
+		return fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+	return nil
+}